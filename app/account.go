@@ -0,0 +1,258 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"tbm/scraper"
+	"time"
+)
+
+// DefaultAccount is the name of the account configured by the "scraper" section, if no accounts are configured
+const DefaultAccount = "default"
+
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Account is a named twitter account, whose bookmarks are fetched by a scraper of its own. The "scraper" section of
+// the config provides the defaults of every account, e.g. the proxy or the delay.
+type Account struct {
+	Name    string           `json:"name"`
+	Scraper *scraper.Scraper `json:"-"`
+
+	raw json.RawMessage
+}
+
+// AccountStatus describes the state of the scraper of a single account
+type AccountStatus struct {
+	Name        string              `json:"name"`
+	Running     bool                `json:"running"`
+	Paused      bool                `json:"paused"`
+	Cursor      string              `json:"cursor"`
+	NextRun     time.Time           `json:"next_run"`
+	NextRequest time.Time           `json:"next_request"`
+	RateLimits  []scraper.RateLimit `json:"rate_limits"`
+}
+
+func (ac *Account) UnmarshalJSON(b []byte) error {
+	v := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ac.Name = v.Name
+	ac.raw = append(json.RawMessage{}, b...)
+	return nil
+}
+
+func (ac *Account) MarshalJSON() ([]byte, error) {
+	if ac.Scraper == nil {
+		return ac.raw, nil
+	}
+	b, err := json.Marshal(ac.Scraper)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	fields["name"], _ = json.Marshal(ac.Name)
+	return json.Marshal(fields)
+}
+
+// loadAccounts creates the scraper of every configured account. The scraper of the "scraper" section is used as
+// default account if no accounts are configured.
+func (a *Application) loadAccounts() error {
+	if len(a.Accounts) == 0 {
+		a.accounts = []*Account{{Name: DefaultAccount, Scraper: a.Scraper}}
+		return nil
+	}
+
+	accounts := make([]*Account, 0, len(a.Accounts))
+	names := map[string]bool{}
+	for _, ac := range a.Accounts {
+		if !accountNamePattern.MatchString(ac.Name) {
+			return errors.New("invalid account name \"" + ac.Name + "\", use lowercase letters, digits, - and _ only")
+		}
+		if names[ac.Name] {
+			return errors.New("account \"" + ac.Name + "\" is configured twice")
+		}
+		names[ac.Name] = true
+
+		sc, err := a.newAccountScraper(ac.Name, ac.raw)
+		if err != nil {
+			return errors.New("invalid config of account \"" + ac.Name + "\": " + err.Error())
+		}
+		ac.Scraper = sc
+		accounts = append(accounts, ac)
+	}
+	a.accounts = accounts
+	return nil
+}
+
+// newAccountScraper creates a scraper using the "scraper" section as defaults, overwritten by the account config
+func (a *Application) newAccountScraper(name string, config json.RawMessage) (*scraper.Scraper, error) {
+	sc := scraper.NewScraper(func(ct *scraper.CachedTweet) bool {
+		return a.onNewTweet(name, ct)
+	})
+	sc.OnProgress = func(p scraper.Progress) {
+		a.onProgress(name, p)
+	}
+	sc.LegacyCursorFile = ".cursor." + name + ".tmp"
+
+	if err := a.configureAccountScraper(sc, config); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// configureAccountScraper applies the "scraper" section and the account config on top of it to the scraper of an
+// account
+func (a *Application) configureAccountScraper(sc *scraper.Scraper, config json.RawMessage) error {
+	sc.AccessToken = a.Scraper.AccessToken
+	sc.Sections = a.Scraper.Sections
+	sc.Urls = a.Scraper.Urls
+	sc.Proxy = a.Scraper.Proxy
+	sc.Delay = a.Scraper.Delay
+	sc.Timeout = a.Scraper.Timeout
+	sc.Cookie = ""
+	sc.RawTimeout = ""
+	sc.RawDelay = ""
+
+	if err := json.Unmarshal(config, sc); err != nil {
+		return err
+	}
+	var err error
+	if sc.RawTimeout != "" {
+		if sc.Timeout, err = time.ParseDuration(sc.RawTimeout); err != nil {
+			return err
+		}
+	}
+	if sc.RawDelay != "" {
+		if sc.Delay, err = time.ParseDuration(sc.RawDelay); err != nil {
+			return err
+		}
+	}
+	return validateProxy(sc.Proxy)
+}
+
+// validateProxy fails on an invalid proxy, which would otherwise stop all requests of the scraper
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	if _, err := scraper.ParseProxy(proxy); err != nil {
+		return errors.New("invalid proxy \"" + proxy + "\": " + err.Error())
+	}
+	return nil
+}
+
+// startScrapers starts the scheduled runs of all accounts
+func (a *Application) startScrapers() {
+	for _, ac := range a.accounts {
+		ac.Scraper.Start(a.Danger.RemoveBookmarks)
+	}
+}
+
+// stopScrapers ends the scheduled and active runs of all accounts
+func (a *Application) stopScrapers() {
+	for _, ac := range a.accounts {
+		ac.Scraper.Stop()
+	}
+}
+
+// primaryScraper returns the scraper of the first account, which is used for requests not related to a single
+// account, such as enriching imported tweets
+func (a *Application) primaryScraper() *scraper.Scraper {
+	if len(a.accounts) == 0 {
+		return a.Scraper
+	}
+	return a.accounts[0].Scraper
+}
+
+// accountScraper returns the scraper of the first configured account out of the given ones, e.g. the accounts which
+// have bookmarked a tweet and are able to see it. The primary scraper is used if none of them is configured.
+func (a *Application) accountScraper(accounts []string) *scraper.Scraper {
+	for _, name := range accounts {
+		if ac, ok := a.account(name); ok {
+			return ac.Scraper
+		}
+	}
+	return a.primaryScraper()
+}
+
+// selectAccounts returns the account with the given name or all accounts, if no name is given
+func (a *Application) selectAccounts(name string) ([]*Account, error) {
+	if name == "" {
+		return a.accounts, nil
+	}
+	if ac, ok := a.account(name); ok {
+		return []*Account{ac}, nil
+	}
+	return nil, errors.New("unknown account \"" + name + "\"")
+}
+
+// account returns the configured account with the given name
+func (a *Application) account(name string) (*Account, bool) {
+	for _, ac := range a.accounts {
+		if ac.Name == name {
+			return ac, true
+		}
+	}
+	return nil, false
+}
+
+// AccountNames returns the names of all configured accounts
+func (a *Application) AccountNames() []string {
+	names := make([]string, 0, len(a.accounts))
+	for _, ac := range a.accounts {
+		names = append(names, ac.Name)
+	}
+	return names
+}
+
+// scrapersRunning reports whether any account is fetching its bookmark timeline
+func (a *Application) scrapersRunning() bool {
+	for _, ac := range a.accounts {
+		if ac.Scraper.IsRunning() {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapersPaused reports whether the scheduled runs of all accounts are paused
+func (a *Application) scrapersPaused() bool {
+	for _, ac := range a.accounts {
+		if !ac.Scraper.IsPaused() {
+			return false
+		}
+	}
+	return len(a.accounts) > 0
+}
+
+func (a *Application) accountStatus() []AccountStatus {
+	status := make([]AccountStatus, 0, len(a.accounts))
+	for _, ac := range a.accounts {
+		status = append(status, AccountStatus{
+			Name:        ac.Name,
+			Running:     ac.Scraper.IsRunning(),
+			Paused:      ac.Scraper.IsPaused(),
+			Cursor:      ac.Scraper.GetCursor(),
+			NextRun:     ac.Scraper.NextRun(),
+			NextRequest: ac.Scraper.NextRequest(),
+			RateLimits:  ac.Scraper.RateLimits(),
+		})
+	}
+	return status
+}
+
+// drifts returns the deviations from the known response schema found within the bookmark timelines of all accounts
+func (a *Application) drifts() []scraper.Drift {
+	drifts := make([]scraper.Drift, 0)
+	for _, ac := range a.accounts {
+		drifts = append(drifts, ac.Scraper.Drifts()...)
+	}
+	return drifts
+}
@@ -12,8 +12,12 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"tbm/downloader"
 	"tbm/scraper"
+	"tbm/search"
 	"tbm/server"
+	"tbm/snapshot"
+	"tbm/store"
 	"tbm/utils/filesystem"
 	"tbm/utils/log"
 	"time"
@@ -21,6 +25,7 @@ import (
 
 type Application struct {
 	DataDir string          `json:"data_dir"`
+	Storage string          `json:"storage"`
 	Mode    ApplicationMode `json:"mode"`
 	Danger  DangerOptions   `json:"danger"`
 	SortBy  string          `json:"sort_by"`
@@ -28,12 +33,28 @@ type Application struct {
 	Build          Build  `json:"-"`
 	ConfigFileName string `json:"-"`
 
-	Server  *server.Server   `json:"server"`
-	Scraper *scraper.Scraper `json:"scraper"`
-
-	mx     sync.RWMutex
-	tweets map[string]*scraper.CachedTweet
-	state  map[string]interface{}
+	Server  *server.Server     `json:"server"`
+	Scraper *scraper.Scraper   `json:"scraper"`
+	Media   *downloader.Queue  `json:"media"`
+	Archive *snapshot.Archiver `json:"archive"`
+
+	Accounts []*Account `json:"accounts,omitempty"`
+
+	mx       sync.RWMutex
+	tmx      sync.Mutex
+	accounts []*Account
+	store    store.Store
+	index    *search.Index
+	enrich   *enrichQueue
+	state    map[string]interface{}
+	pmx      sync.Mutex
+	progress map[string]*SyncProgress
+	// cmx serializes config changes, pendingDataDir is a saved data directory used after a restart. Saved configs are
+	// queued within configQueue and applied in the background while applying is set.
+	cmx            sync.Mutex
+	pendingDataDir string
+	configQueue    []*configForm
+	applying       bool
 }
 
 type Build struct {
@@ -62,21 +83,35 @@ func NewApplication(assets embed.FS) *Application {
 	a := &Application{
 		SortBy:         "date",
 		DataDir:        path.Join(dir, "data"),
+		Storage:        store.JsonDriver,
 		ConfigFileName: path.Join(dir, "config.json"),
-		tweets:         map[string]*scraper.CachedTweet{},
 		Mode:           OnlineMode,
+		index:          search.NewIndex(),
+		enrich:         newEnrichQueue(),
 		Danger: DangerOptions{
 			RemoveBookmarks: false,
 		},
-		state: map[string]interface{}{},
+		state:    map[string]interface{}{},
+		progress: map[string]*SyncProgress{},
 	}
 
-	a.Scraper = scraper.NewScraper(a.onNewTweet)
+	a.Scraper = scraper.NewScraper(func(ct *scraper.CachedTweet) bool {
+		return a.onNewTweet(DefaultAccount, ct)
+	})
+	a.Scraper.OnProgress = func(p scraper.Progress) {
+		a.onProgress(DefaultAccount, p)
+	}
+	a.Media = downloader.NewQueue(a.Scraper.Fetch)
+	a.Media.OnFinished = a.onDownloaded
+	a.Archive = snapshot.NewArchiver(a.Scraper.FetchPage)
+	a.Archive.OnArchived = a.onArchived
 	a.Server = server.NewServer(a.websocketCallback, assets, map[string]interface{}{
 		"html":       a.renderHtml,
+		"markdown":   a.renderMarkdown,
 		"GetState":   a.GetState,
 		"FormatTime": a.FormatTime,
 	})
+	a.Server.Hub().DefaultTopics = []string{TopicTweets}
 	a.Server.Route(func(r *httprouter.Router) {
 		r.GET("/", a.Server.CreateViewHandler("tweet.index", a.tweetsView))
 		r.GET("/status", a.Server.CreateViewHandler("status.index", a.statusView))
@@ -85,11 +120,37 @@ func NewApplication(assets embed.FS) *Application {
 		r.POST("/config", a.Server.CreateViewHandler("config.show", a.updateConfigView))
 
 		r.GET("/tweet/:id", a.Server.CreateViewHandler("tweet.show", a.tweetView))
+		r.GET("/snapshot/:id", a.Server.CreateHandler(a.snapshotEndpoint))
 
 		r.GET("/api/state", a.Server.CreateJsonHandler(a.stateEndpoint))
 		r.GET("/api/status", a.Server.CreateJsonHandler(a.statusEndpoint))
 		r.GET("/api/tweet", a.Server.CreateJsonHandler(a.tweetsEndpoint))
 		r.GET("/api/tweet/:id", a.Server.CreateJsonHandler(a.tweetEndpoint))
+		r.POST("/api/tweet/:id/labels", a.Server.CreateJsonHandler(a.addLabelsEndpoint))
+		r.DELETE("/api/tweet/:id/labels", a.Server.CreateJsonHandler(a.removeLabelsEndpoint))
+		r.DELETE("/api/tweet/:id/tags/:tag", a.Server.CreateJsonHandler(a.removeTagEndpoint))
+		r.DELETE("/api/tweet/:id/collections/:collection", a.Server.CreateJsonHandler(a.removeCollectionEndpoint))
+		r.POST("/api/tweet/:id/notes", a.Server.CreateJsonHandler(a.addNoteEndpoint))
+		r.PUT("/api/tweet/:id/notes/:note", a.Server.CreateJsonHandler(a.updateNoteEndpoint))
+		r.DELETE("/api/tweet/:id/notes/:note", a.Server.CreateJsonHandler(a.removeNoteEndpoint))
+
+		r.GET("/api/export", a.Server.CreateHandler(a.exportEndpoint))
+		r.POST("/api/import", a.Server.CreateJsonHandler(a.importEndpoint))
+		r.GET("/api/media", a.Server.CreateJsonHandler(a.mediaEndpoint))
+		r.POST("/api/media/retry", a.Server.CreateJsonHandler(a.retryMediaEndpoint))
+		r.GET("/api/maintenance/verify", a.Server.CreateJsonHandler(a.verifyEndpoint))
+		r.POST("/api/maintenance/verify", a.Server.CreateJsonHandler(a.verifyEndpoint))
+
+		r.GET("/api/scraper", a.Server.CreateJsonHandler(a.scraperEndpoint))
+		r.POST("/api/scraper/pause", a.Server.CreateJsonHandler(a.pauseEndpoint))
+		r.POST("/api/scraper/resume", a.Server.CreateJsonHandler(a.resumeEndpoint))
+		r.POST("/api/scraper/run", a.Server.CreateJsonHandler(a.runEndpoint))
+		r.POST("/api/scraper/cancel", a.Server.CreateJsonHandler(a.cancelEndpoint))
+		r.POST("/api/scraper/resync", a.Server.CreateJsonHandler(a.resyncEndpoint))
+		r.GET("/api/sync/runs", a.Server.CreateJsonHandler(a.syncRunsEndpoint))
+
+		r.GET("/api/tags", a.Server.CreateJsonHandler(a.tagsEndpoint))
+		r.GET("/api/collections", a.Server.CreateJsonHandler(a.collectionsEndpoint))
 	})
 
 	return a
@@ -110,106 +171,142 @@ func (a *Application) loadConfigFile() error {
 		if a.Scraper.RawDelay != "" {
 			a.Scraper.Delay, err = time.ParseDuration(a.Scraper.RawDelay)
 		}
+		if a.Media.RawBackoff != "" {
+			if a.Media.Backoff, err = time.ParseDuration(a.Media.RawBackoff); err != nil {
+				return err
+			}
+		}
+		if a.Archive.RawTimeout != "" {
+			if a.Archive.Timeout, err = time.ParseDuration(a.Archive.RawTimeout); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (a *Application) Load() error {
+func (a *Application) LoadConfig() error {
 	if err := a.loadConfigFile(); err != nil {
 		return err
 	}
+	if err := validateProxy(a.Scraper.Proxy); err != nil {
+		return err
+	}
+	if err := a.loadAccounts(); err != nil {
+		return err
+	}
 	filesystem.CreateDirectory(a.DataDir)
 	filesystem.CreateDirectory(path.Join(a.DataDir, "media"))
+
+	a.Media.Dir = path.Join(a.DataDir, "media")
+	a.Media.StateFile = path.Join(a.DataDir, downloader.StateFilename)
+	a.Archive.Dir = path.Join(a.DataDir, snapshot.Directory)
+
+	if err := a.loadSyncState(); err != nil {
+		return err
+	}
+	return a.Media.Load()
+}
+
+func (a *Application) Load() error {
+	if err := a.LoadConfig(); err != nil {
+		return err
+	}
 	a.Server.MediaDir = path.Join(a.DataDir, "media")
 	a.Server.Load()
-	a.LoadTweetCache()
+
+	return a.LoadStore()
+}
+
+func (a *Application) LoadStore() error {
+	s, err := store.New(a.Storage, a.DataDir)
+	if err != nil {
+		return err
+	}
+	if err := s.Open(); err != nil {
+		return err
+	}
+	a.store = s
+	log.Info("Storage \"%s\" loaded with %d tweets", a.Storage, s.Count())
+
+	go a.buildSearchIndex()
 
 	return nil
 }
 
-func (a *Application) LoadTweetCache() {
-	items, _ := ioutil.ReadDir(a.DataDir)
-	for _, item := range items {
-		if item.IsDir() == false {
-			dat, err := os.ReadFile(path.Join(a.DataDir, item.Name()))
-			if err == nil {
-				ct := &scraper.CachedTweet{}
-				if err := json.Unmarshal(dat, ct); err == nil {
-					ct.Version = a.Build.Version
-					a.tweets[ct.Tweet.IdStr] = ct
-				}
-			}
-		}
+// Migrate copies all tweets from one storage driver into another one
+func (a *Application) Migrate(from, to string) error {
+	if from == to {
+		return errors.New("source and target storage are identical")
+	}
+	src, err := store.New(from, a.DataDir)
+	if err != nil {
+		return err
+	}
+	dst, err := store.New(to, a.DataDir)
+	if err != nil {
+		return err
+	}
+	if err := src.Open(); err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := dst.Open(); err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	count, err := store.Migrate(src, dst)
+	if err != nil {
+		return err
 	}
+	log.Success("%d tweets migrated from \"%s\" to \"%s\"", count, from, to)
+
+	return nil
 }
 
 func (a *Application) Start() error {
 	a.AddState("mode", a.Mode)
 
 	if a.Mode == OnlineMode {
-		a.Scraper.Start(a.Danger.RemoveBookmarks)
+		a.startSync()
 	}
 
 	return a.Server.Start()
 }
 
 func (a *Application) Stop() error {
-	a.Scraper.Stop()
-	return a.Server.Stop()
-}
-
-func (a *Application) websocketCallback(m *server.Message) {
-	t := &Task{}
-	r := NewResponse()
-	if err := json.Unmarshal(m.Content, t); err != nil {
-		r.SetErrorStr("failed to decode message")
-	}
-
-	switch t.Command {
-	default:
-		r.SetErrorStr("unknown command")
-	}
-
-	if b, err := r.Encode(); err == nil {
-		m.Client.Send(b)
-	} else {
-		log.Error("failed to encode response: %s", err.Error())
+	a.stopSync()
+	if err := a.Server.Stop(); err != nil {
+		return err
 	}
+	return a.store.Close()
 }
 
-func (a *Application) SearchTweets(query string) []*scraper.CachedTweet {
-	query = strings.ToLower(query)
-	tweets := make([]*scraper.CachedTweet, 0)
-	for _, tweet := range a.GetTweets() {
-		add := strings.Contains(strings.ToLower(tweet.Tweet.FullText), query)
-		if add == false {
-			for _, u := range tweet.Tweet.Entities.Urls {
-				if strings.Contains(strings.ToLower(u.ExpandedUrl), query) {
-					add = true
-					break
-				}
-			}
+// startSync starts the scrapers of all accounts and the background queues, which are only active in online mode
+func (a *Application) startSync() {
+	a.startScrapers()
+	a.startEnrichment()
+	a.Media.Start()
+	a.startArchiver()
+}
 
-			if add == false {
-				if strings.Contains(strings.ToLower(tweet.User.Legacy.ScreenName), query) {
-					add = true
-				} else if strings.Contains(strings.ToLower(tweet.User.Legacy.Name), query) {
-					add = true
-				}
-			}
-		}
+func (a *Application) stopSync() {
+	a.stopScrapers()
+	a.stopEnrichment()
+	a.Media.Stop()
+	a.Archive.Stop()
+}
 
-		if add {
-			tweets = append(tweets, tweet)
-		}
+// onNewTweet stores a tweet found within the bookmark timeline of the given account
+func (a *Application) onNewTweet(account string, ct *scraper.CachedTweet) bool {
+	sc := a.Scraper
+	if ac, ok := a.account(account); ok {
+		sc = ac.Scraper
 	}
-	return tweets
-}
 
-func (a *Application) onNewTweet(ct *scraper.CachedTweet) bool {
-	filename := path.Join(a.DataDir, ct.Tweet.IdStr+".json")
-	if filesystem.Exist(filename) == false {
-		conversation, err := a.Scraper.TweetDetail(ct.Tweet.IdStr)
+	if a.store.Has(ct.Tweet.IdStr) == false {
+		conversation, err := sc.TweetDetail(ct.Tweet.IdStr)
 		if err != nil {
 			log.Error("Failed to fetch conversation %s: %s", ct.Tweet.IdStr, err.Error())
 			return false
@@ -217,104 +314,175 @@ func (a *Application) onNewTweet(ct *scraper.CachedTweet) bool {
 
 		ct.Conversation = *conversation
 		ct.Version = a.Build.Version
+		ct.AddAccount(account)
 
-		d, err := json.Marshal(ct)
-		if err == nil {
-			err = ioutil.WriteFile(filename, d, 0644)
-			if err == nil {
-				a.tweets[ct.Tweet.IdStr] = ct
-
-				ext, _ := GetFileExtensionFromUrl(ct.User.Legacy.ProfileImageUrlHttps)
-				if ext == "" {
-					ext = "blob"
-				}
-				userImageFilename := path.Join(a.DataDir, "media", ct.User.RestId+"."+ext)
-
-				_ = a.Scraper.Download(ct.User.Legacy.ProfileImageUrlHttps, userImageFilename)
-
-				for _, tweet := range conversation.GlobalObjects.Tweets {
-					for _, ctm := range tweet.ExtendedEntities.Media {
-						ext, _ = GetFileExtensionFromUrl(ctm.MediaUrlHttps)
-						if ext == "" {
-							ext = "blob"
-						}
-						mediaImageFilename := path.Join(a.DataDir, "media", ctm.IdStr+"."+ext)
-
-						_ = a.Scraper.Download(ctm.MediaUrlHttps, mediaImageFilename)
-
-						if ctm.Type == "video" {
-							maxBitrate := 0
-							videoUrl := ""
-							for _, variant := range ctm.VideoInfo.Variants {
-								if variant.Bitrate > maxBitrate {
-									videoUrl = strings.TrimSuffix(variant.Url, "?tag=10")
-									maxBitrate = variant.Bitrate
-								}
-							}
-
-							if videoUrl != "" {
-								ext, _ = GetFileExtensionFromUrl(videoUrl)
-								if ext == "" {
-									ext = "blob"
-								}
-								mediaVideoFilename := path.Join(a.DataDir, "media", ctm.IdStr+"."+ext)
-
-								_ = a.Scraper.Download(videoUrl, mediaVideoFilename)
-							}
-						}
-					}
-				}
-
-				r := NewResponse()
-				r.Data["user"] = ct.User
-				r.Data["tweet"] = ct.Tweet
-				r.Data["conversation"] = ct.Conversation
-
-				if b, e := r.Encode(); e == nil {
-					a.Server.Hub().Broadcast(b)
-				} else {
-					log.Error("Failed to encode response: %s", e.Error())
-					return false
-				}
-			}
-		}
-
+		inserted, err := a.AddTweet(ct)
 		if err != nil {
 			log.Error("Failed to save tweet data: %s", err.Error())
 			return false
-		} else {
+		}
+		if inserted {
+			a.saveRaw(ct.Tweet.IdStr, ct.Raw, conversation)
+			a.saveLinked(ct, append(ct.Linked, conversation.Linked...))
+			a.index.Add(a.tweetDocument(ct))
+			queued := a.downloadMedia(ct)
+			a.archiveLinks(ct)
+
+			a.publish(TopicTweets, EventTweetNew, map[string]interface{}{
+				"user":         ct.User,
+				"tweet":        ct.Tweet,
+				"conversation": ct.Conversation,
+			})
+			a.onSynced(account, ct.Tweet.IdStr, queued)
 			log.Success("New tweet fetched: %s posted on %s", ct.Tweet.IdStr, ct.Tweet.CreatedAt)
-
-			if a.Danger.RemoveBookmarks {
-				r, err := a.Scraper.DeleteBookmarkDetail(ct.Tweet.IdStr)
-				if err != nil {
-					log.Error("Failed to remove remote bookmark %s: %s", ct.Tweet.IdStr, err.Error())
-				} else if r.Data.TweetBookmarkDelete != "Done" {
-					log.Info("Bookmark %s was already removed", ct.Tweet.IdStr)
-				} else {
-					log.Success("Bookmark removed: %s posted on %s", ct.Tweet.IdStr, ct.Tweet.CreatedAt)
-				}
-			}
+		} else {
+			// Another account has stored the tweet in the meantime and took care of everything else
+			log.Info("Tweet %s has been stored by another account in the meantime", ct.Tweet.IdStr)
+		}
+	} else if stored, ok := a.GetTweet(ct.Tweet.IdStr); ok && stored.IsIncomplete() {
+		// Imported tweets are completed as soon as they show up in the bookmark timeline
+		ct.AddAccount(account)
+		if err := a.EnrichTweet(ct); err != nil {
+			log.Error("Failed to enrich tweet %s: %s", ct.Tweet.IdStr, err.Error())
+			return false
+		}
+		log.Success("Imported tweet enriched: %s posted on %s", ct.Tweet.IdStr, ct.Tweet.CreatedAt)
+	} else if ok && stored.BookmarkedBy(account) == false {
+		if _, err := a.UpdateTweet(ct.Tweet.IdStr, func(ct *scraper.CachedTweet) error {
+			ct.AddAccount(account)
+			return nil
+		}); err != nil {
+			log.Error("Failed to add account %s to tweet %s: %s", account, ct.Tweet.IdStr, err.Error())
+			return false
 		}
 	} else {
 		//log.Info("Tweet skipped (already fetched): %s posted on %s", ct.Tweet.IdStr, ct.Tweet.CreatedAt)
+		return true
+	}
+
+	// Every account removes its own bookmark, no matter which account has stored the tweet
+	if a.Danger.RemoveBookmarks {
+		a.removeBookmark(sc, ct)
 	}
 
 	return true
 }
 
-func (a *Application) GetTweets() map[string]*scraper.CachedTweet {
-	a.mx.RLock()
-	defer a.mx.RUnlock()
+// removeBookmark removes the remote bookmark of a tweet from the account of the given scraper
+func (a *Application) removeBookmark(sc *scraper.Scraper, ct *scraper.CachedTweet) {
+	r, err := sc.DeleteBookmarkDetail(ct.Tweet.IdStr)
+	if err != nil {
+		log.Error("Failed to remove remote bookmark %s: %s", ct.Tweet.IdStr, err.Error())
+	} else if r.Data.TweetBookmarkDelete != "Done" {
+		log.Info("Bookmark %s was already removed", ct.Tweet.IdStr)
+	} else {
+		log.Success("Bookmark removed: %s posted on %s", ct.Tweet.IdStr, ct.Tweet.CreatedAt)
+	}
+}
 
-	return a.tweets
+// downloadMedia queues the avatar of the author and all media files of a given tweet and its conversation and
+// returns the number of queued files
+func (a *Application) downloadMedia(ct *scraper.CachedTweet) int {
+	return a.queueMedia(ct.Tweet.IdStr, mediaFiles(ct))
 }
 
-func (a *Application) AddTweet(ct *scraper.CachedTweet) {
-	a.mx.RLock()
-	defer a.mx.RUnlock()
+// queueMedia queues media files as part of the given tweet and returns the number of files, which weren't queued or
+// downloaded before
+func (a *Application) queueMedia(tweetId string, files []mediaFile) int {
+	queued := 0
+	for _, mf := range files {
+		if a.Media.Add(tweetId, mf.Url, mf.Target) {
+			queued++
+		}
+	}
+	return queued
+}
+
+func (a *Application) GetTweet(id string) (*scraper.CachedTweet, bool) {
+	ct, err := a.store.Get(id)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Error("Failed to load tweet %s: %s", id, err.Error())
+		}
+		return nil, false
+	}
+	return ct, true
+}
+
+// EachTweet calls fn for every stored tweet, starting with the newest one
+func (a *Application) EachTweet(fn func(ct *scraper.CachedTweet) bool) {
+	if err := a.store.Iterate(store.Descending, fn); err != nil {
+		log.Error("Failed to iterate tweets: %s", err.Error())
+	}
+}
+
+// tweetRange returns the creation time of the newest and the oldest tweet
+func (a *Application) tweetRange() (time.Time, time.Time) {
+	newest := time.Time{}
+	oldest := time.Time{}
+	if tweets, err := a.store.List(store.Descending, 0, 1); err == nil && len(tweets) > 0 {
+		newest = tweets[0].CreatedAt()
+	}
+	if tweets, err := a.store.List(store.Ascending, 0, 1); err == nil && len(tweets) > 0 {
+		oldest = tweets[0].CreatedAt()
+	}
+	return newest, oldest
+}
+
+func (a *Application) CountTweets() int {
+	return a.store.Count()
+}
+
+// AddTweet stores a new tweet and reports whether it has been inserted. If the tweet has been stored in the meantime,
+// e.g. by another account, only the accounts of the given tweet are added to the stored one.
+func (a *Application) AddTweet(ct *scraper.CachedTweet) (bool, error) {
+	a.tmx.Lock()
+	defer a.tmx.Unlock()
+
+	if stored, err := a.store.Get(ct.Tweet.IdStr); err == nil {
+		for _, account := range ct.Accounts {
+			stored.AddAccount(account)
+		}
+		return false, a.store.Put(stored)
+	}
+	return true, a.store.Put(ct)
+}
+
+// UpdateTweet applies fn to a stored tweet and persists the result
+func (a *Application) UpdateTweet(id string, fn func(ct *scraper.CachedTweet) error) (*scraper.CachedTweet, error) {
+	a.tmx.Lock()
+	defer a.tmx.Unlock()
+
+	ct, err := a.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(ct); err != nil {
+		return nil, err
+	}
+	if err := a.store.Put(ct); err != nil {
+		return nil, err
+	}
+	a.index.Add(a.tweetDocument(ct))
 
-	a.tweets[ct.Tweet.IdStr] = ct
+	return ct, nil
+}
+
+// DeleteTweet removes a tweet and its raw payloads from the store and the search index. Media files and linked
+// tweets are kept, since they may be shared with other tweets.
+func (a *Application) DeleteTweet(id string) error {
+	a.tmx.Lock()
+	defer a.tmx.Unlock()
+
+	if !a.store.Has(id) {
+		return store.ErrNotFound
+	}
+	if err := a.store.Delete(id); err != nil {
+		return err
+	}
+	a.index.Remove(id)
+
+	return nil
 }
 
 func (a *Application) SetState(state map[string]interface{}) {
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"os"
+	"path"
+	"tbm/downloader"
+	"tbm/scraper"
+	"tbm/scrapertest"
+	"testing"
+	"time"
+)
+
+// newTestApplication creates an application storing its data in a temporary directory. The scraper uses the
+// credentials accepted by the fake server, but still points to twitter.
+func newTestApplication(t *testing.T) *Application {
+	a := NewApplication(embed.FS{})
+	a.DataDir = t.TempDir()
+	a.ConfigFileName = path.Join(a.DataDir, "config.json")
+	a.Server.Port = 0
+	a.Scraper.Cookie = scrapertest.Cookie
+	a.Scraper.Delay = 0
+	a.Scraper.LegacyCursorFile = ""
+	a.Media.Backoff = 0
+
+	if err := a.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadStore(); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// waitFor polls the condition until it holds or the timeout is reached
+func waitFor(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSyncStoresBookmarks(t *testing.T) {
+	srv := scrapertest.NewServer()
+	defer srv.Close()
+	addBookmarks(srv)
+
+	a := newTestApplication(t)
+	srv.Configure(a.Scraper)
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	checkBookmarks(t, a)
+}
+
+// testPhoto is attached to the first bookmark added by addBookmarks
+var testPhoto = scrapertest.Media{Id: "3001", Type: "photo", Content: []byte("photo 3001")}
+
+// addBookmarks adds two bookmarks to the fake server, the first one has a photo and a reply
+func addBookmarks(srv *scrapertest.Server) {
+	srv.AddBookmark(&scrapertest.Tweet{
+		Id:        "1001",
+		UserId:    "501",
+		Text:      "first bookmark",
+		CreatedAt: time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC),
+		Media:     []scrapertest.Media{testPhoto},
+	})
+	srv.AddBookmark(&scrapertest.Tweet{
+		Id:        "1002",
+		UserId:    "502",
+		Text:      "second bookmark",
+		CreatedAt: time.Date(2022, 1, 2, 12, 0, 0, 0, time.UTC),
+	})
+	srv.AddReply(&scrapertest.Tweet{
+		Id:        "1003",
+		UserId:    "503",
+		Text:      "reply to the first bookmark",
+		CreatedAt: time.Date(2022, 1, 1, 13, 0, 0, 0, time.UTC),
+		ReplyTo:   "1001",
+	})
+}
+
+// checkBookmarks waits until the bookmarks added by addBookmarks have been synced and checks the stored tweets, raw
+// payloads and media files
+func checkBookmarks(t *testing.T, a *Application) {
+	waitFor(t, 10*time.Second, "the bookmarks", func() bool {
+		return a.CountTweets() == 2
+	})
+	for _, id := range []string{"1001", "1002"} {
+		ct, ok := a.GetTweet(id)
+		if !ok {
+			t.Fatalf("tweet %s not stored", id)
+		}
+		if !ct.BookmarkedBy(DefaultAccount) {
+			t.Errorf("tweet %s not bookmarked by the default account", id)
+		}
+		if _, err := os.Stat(path.Join(a.DataDir, id+".json")); err != nil {
+			t.Errorf("tweet %s not stored on disk: %s", id, err)
+		}
+		raw, err := a.store.GetRaw(id)
+		if err != nil {
+			t.Fatalf("raw payloads of tweet %s not stored: %s", id, err)
+		}
+		if len(raw.Bookmark) == 0 || len(raw.Details) == 0 {
+			t.Errorf("raw payloads of tweet %s incomplete", id)
+		}
+	}
+	if ct, _ := a.GetTweet("1001"); ct.Conversation.GlobalObjects.Tweets["1003"].IdStr != "1003" {
+		t.Errorf("reply 1003 missing in the conversation of tweet 1001")
+	}
+
+	expected := map[string][]byte{
+		"3001.jpg": testPhoto.Content,
+		"501.jpg":  []byte("avatar 501"),
+		"502.jpg":  []byte("avatar 502"),
+	}
+	waitFor(t, 10*time.Second, "the media downloads", func() bool {
+		for target := range expected {
+			if job, ok := a.Media.Get(target); !ok || job.Status != downloader.StatusDone {
+				return false
+			}
+		}
+		return true
+	})
+	for target, content := range expected {
+		b, err := os.ReadFile(path.Join(a.Media.Dir, target))
+		if err != nil {
+			t.Fatalf("media file %s not downloaded: %s", target, err)
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("media file %s contains %q, expected %q", target, b, content)
+		}
+	}
+
+	if err := a.Media.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(a.Media.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct {
+		Done map[string]downloader.Record `json:"done"`
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+	for target, content := range expected {
+		record, ok := state.Done[target]
+		if !ok || record.Size != int64(len(content)) || record.Sha256 == "" {
+			t.Errorf("download of %s not persisted in %s", target, downloader.StateFilename)
+		}
+	}
+}
+
+func TestAddTweetMergesAccounts(t *testing.T) {
+	a := newTestApplication(t)
+	defer a.store.Close()
+
+	tweet := func(account string) *scraper.CachedTweet {
+		ct := &scraper.CachedTweet{}
+		ct.Tweet.IdStr = "2001"
+		ct.Tweet.CreatedAt = "Sat Jan 01 12:00:00 +0000 2022"
+		ct.AddAccount(account)
+		return ct
+	}
+
+	if inserted, err := a.AddTweet(tweet("first")); err != nil || !inserted {
+		t.Fatalf("first tweet not inserted: %v", err)
+	}
+	if inserted, err := a.AddTweet(tweet("second")); err != nil || inserted {
+		t.Fatalf("stored tweet inserted again: %v", err)
+	}
+	ct, ok := a.GetTweet("2001")
+	if !ok {
+		t.Fatal("tweet 2001 not stored")
+	}
+	if !ct.BookmarkedBy("first") || !ct.BookmarkedBy("second") {
+		t.Errorf("accounts not merged: %v", ct.Accounts)
+	}
+}
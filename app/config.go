@@ -0,0 +1,453 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"tbm/scraper"
+	"tbm/utils/filesystem"
+	"tbm/utils/log"
+	"time"
+)
+
+var errForeignOrigin = errors.New("the config can only be changed from the config page of TBM")
+
+// Events published on TopicSync while a saved config is applied
+const (
+	EventConfigApplying = "config.applying"
+	EventConfigApplied  = "config.applied"
+	EventConfigFailed   = "config.failed"
+)
+
+// configForm holds the settings editable on the config page
+type configForm struct {
+	ConfigFileName string
+	DataDir        string
+	Mode           ApplicationMode
+	Danger         DangerOptions
+	Host           string
+	Port           string
+	Delay          string
+	Timeout        string
+	Proxy          string
+	AccessToken    string
+	Cookie         string
+	Index          string
+	Remove         string
+	Detail         string
+}
+
+// currentConfig returns the settings the application is running with
+func (a *Application) currentConfig() *configForm {
+	dataDir := a.DataDir
+	if a.pendingDataDir != "" {
+		dataDir = a.pendingDataDir
+	}
+	return &configForm{
+		ConfigFileName: a.ConfigFileName,
+		DataDir:        dataDir,
+		Mode:           a.Mode,
+		Danger:         a.Danger,
+		Host:           a.Server.Host,
+		Port:           strconv.FormatUint(uint64(a.Server.Port), 10),
+		Delay:          a.Scraper.RawDelay,
+		Timeout:        a.Scraper.RawTimeout,
+		Proxy:          a.Scraper.Proxy,
+		AccessToken:    a.Scraper.AccessToken,
+		Cookie:         a.Scraper.Cookie,
+		Index:          a.Scraper.Sections.Index,
+		Remove:         a.Scraper.Sections.Remove,
+		Detail:         a.Scraper.Sections.Detail,
+	}
+}
+
+func newConfigForm(r *http.Request) (*configForm, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return &configForm{
+		DataDir:     r.FormValue("data_dir"),
+		Mode:        ApplicationMode(r.FormValue("mode")),
+		Danger:      DangerOptions{RemoveBookmarks: r.FormValue("danger_remove_bookmarks") != ""},
+		Host:        r.FormValue("host"),
+		Port:        r.FormValue("port"),
+		Delay:       r.FormValue("delay"),
+		Timeout:     r.FormValue("timeout"),
+		Proxy:       r.FormValue("proxy"),
+		AccessToken: r.FormValue("access_token"),
+		Cookie:      r.FormValue("cookie"),
+		Index:       r.FormValue("index"),
+		Remove:      r.FormValue("remove"),
+		Detail:      r.FormValue("detail"),
+	}, nil
+}
+
+// port returns the validated port of the form
+func (f *configForm) port() uint {
+	port, _ := strconv.ParseUint(f.Port, 10, 16)
+	return uint(port)
+}
+
+func (f *configForm) address() string {
+	return fmt.Sprintf("%s:%d", f.Host, f.port())
+}
+
+// scraperChanged reports whether any setting used by the scrapers differs between both forms
+func (f *configForm) scraperChanged(o *configForm) bool {
+	return f.Danger != o.Danger || f.Delay != o.Delay || f.Timeout != o.Timeout || f.Proxy != o.Proxy ||
+		f.AccessToken != o.AccessToken || f.Cookie != o.Cookie || f.Index != o.Index || f.Remove != o.Remove ||
+		f.Detail != o.Detail
+}
+
+// validateConfig checks all settings of the form and returns every problem found
+func (a *Application) validateConfig(f *configForm) []error {
+	errs := make([]error, 0)
+
+	if f.DataDir == "" {
+		errs = append(errs, errors.New("the data directory is missing"))
+	} else if err := writableDir(f.DataDir); err != nil {
+		errs = append(errs, errors.New("the data directory \""+f.DataDir+"\" isn't writable: "+err.Error()))
+	}
+	if f.Mode != OnlineMode && f.Mode != OfflineMode {
+		errs = append(errs, errors.New("unknown mode \""+f.Mode.ToString()+"\""))
+	}
+
+	// Whether the address is available is only known once the server has been restarted on it
+	if port, err := strconv.ParseUint(f.Port, 10, 16); err != nil || port == 0 {
+		errs = append(errs, errors.New("invalid port \""+f.Port+"\", use a number between 1 and 65535"))
+	}
+
+	for name, raw := range map[string]string{"delay": f.Delay, "timeout": f.Timeout} {
+		if raw == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(raw); err != nil || d <= 0 {
+			errs = append(errs, errors.New("invalid "+name+" \""+raw+"\", use a positive duration such as \"30s\""))
+		}
+	}
+	if f.Proxy != "" {
+		if _, err := scraper.ParseProxy(f.Proxy); err != nil {
+			errs = append(errs, errors.New("invalid proxy \""+f.Proxy+"\": "+err.Error()))
+		}
+	}
+
+	if f.Cookie != "" && scraper.CsrfToken(f.Cookie) == "" {
+		errs = append(errs, errors.New("the cookie doesn't contain the \"ct0\" csrf token"))
+	} else if f.Cookie == "" && f.Mode == OnlineMode && len(a.Accounts) == 0 {
+		errs = append(errs, errors.New("a cookie is required in online mode"))
+	}
+	return errs
+}
+
+// writableDir checks whether files can be written into a directory. A missing directory is created after a restart,
+// therefore its closest existing parent directory is checked instead.
+func writableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return errors.New("\"" + dir + "\" is not a directory")
+			}
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// configSection is a json object of the config file. Keys which can't be edited are kept as they are.
+type configSection map[string]json.RawMessage
+
+func parseConfigSection(b json.RawMessage) (configSection, error) {
+	section := configSection{}
+	if len(b) == 0 {
+		return section, nil
+	}
+	if err := json.Unmarshal(b, &section); err != nil {
+		return nil, err
+	}
+	return section, nil
+}
+
+// set stores a value if it has been changed or is part of the config file already. Settings detected at runtime,
+// such as the api sections, are therefore only written once they are edited.
+func (c configSection) set(key string, value interface{}, changed bool) error {
+	if _, ok := c[key]; !ok && !changed {
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c[key] = b
+	return nil
+}
+
+// update applies fn to the nested section of the given key and stores it, unless it is left empty
+func (c configSection) update(key string, fn func(section configSection) error) error {
+	section, err := parseConfigSection(c[key])
+	if err != nil {
+		return errors.New("invalid section \"" + key + "\": " + err.Error())
+	}
+	if err := fn(section); err != nil {
+		return err
+	}
+	if len(section) > 0 {
+		return c.set(key, section, true)
+	}
+	return nil
+}
+
+// writeConfig merges the form into the config file. The file is written into a temporary file first, so a crash
+// can't leave a truncated config behind.
+func (a *Application) writeConfig(f *configForm) error {
+	b, err := os.ReadFile(a.ConfigFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	config, err := parseConfigSection(b)
+	if err != nil {
+		return err
+	}
+
+	c := a.currentConfig()
+	err = config.set("data_dir", f.DataDir, f.DataDir != c.DataDir)
+	if err == nil {
+		err = config.set("mode", f.Mode, f.Mode != c.Mode)
+	}
+	if err == nil {
+		err = config.update("danger", func(s configSection) error {
+			return s.set("remove_bookmarks", f.Danger.RemoveBookmarks, f.Danger != c.Danger)
+		})
+	}
+	if err == nil {
+		err = config.update("server", func(s configSection) error {
+			if err := s.set("host", f.Host, f.Host != c.Host); err != nil {
+				return err
+			}
+			return s.set("port", f.port(), f.port() != a.Server.Port)
+		})
+	}
+	if err == nil {
+		err = config.update("scraper", func(s configSection) error {
+			for _, field := range []struct {
+				key, value, current string
+			}{
+				{"delay", f.Delay, c.Delay},
+				{"timeout", f.Timeout, c.Timeout},
+				{"proxy", f.Proxy, c.Proxy},
+				{"access_token", f.AccessToken, c.AccessToken},
+				{"cookie", f.Cookie, c.Cookie},
+			} {
+				if err := s.set(field.key, field.value, field.value != field.current); err != nil {
+					return err
+				}
+			}
+			return s.update("sections", func(s configSection) error {
+				if err := s.set("index", f.Index, f.Index != c.Index); err != nil {
+					return err
+				}
+				if err := s.set("remove", f.Remove, f.Remove != c.Remove); err != nil {
+					return err
+				}
+				return s.set("detail", f.Detail, f.Detail != c.Detail)
+			})
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if b, err = json.MarshalIndent(config, "", "  "); err != nil {
+		return err
+	}
+	return filesystem.WriteFileAtomic(a.ConfigFileName, b, 0644)
+}
+
+// configNotices describes the changes of a saved form, which are applied in the background by applyConfig
+func configNotices(f, c *configForm) []string {
+	notices := make([]string, 0)
+	modeChanged := f.Mode != c.Mode
+	scraperChanged := f.scraperChanged(c)
+
+	if modeChanged && f.Mode == OnlineMode {
+		notices = append(notices, "Switching to online mode, the scrapers are started")
+	} else if modeChanged {
+		notices = append(notices, "Switching to offline mode, the scrapers are stopped once their active runs end")
+	} else if scraperChanged && f.Mode == OnlineMode {
+		notices = append(notices, "The scrapers are restarted once their active runs end")
+	} else if scraperChanged {
+		notices = append(notices, "The scraper settings are applied")
+	}
+	if f.DataDir != c.DataDir {
+		notices = append(notices, "The data directory \""+f.DataDir+"\" is used after a restart")
+	}
+	if f.Host != c.Host || f.port() != c.port() {
+		notices = append(notices, "The server is restarting on http://"+f.address())
+	}
+	if len(notices) == 0 {
+		notices = append(notices, "The config has been saved, no component has to be restarted")
+	} else {
+		notices = append(notices, "The progress is shown on the status page")
+	}
+	return notices
+}
+
+// queueConfig applies a saved form in the background, since stopping the scrapers waits for their active runs. Forms
+// saved in the meantime are applied afterwards in the order they have been saved. The caller has to hold cmx.
+func (a *Application) queueConfig(f *configForm) {
+	a.configQueue = append(a.configQueue, f)
+	if a.applying {
+		return
+	}
+	a.applying = true
+	go func() {
+		for {
+			a.cmx.Lock()
+			if len(a.configQueue) == 0 {
+				a.applying = false
+				a.cmx.Unlock()
+				return
+			}
+			next := a.configQueue[0]
+			a.configQueue = a.configQueue[1:]
+			a.cmx.Unlock()
+
+			a.applyConfig(next)
+		}
+	}()
+}
+
+// applyConfig applies a validated form to the running application and reports its progress on TopicSync. Only the
+// components whose settings have changed are restarted: the scrapers for new credentials or scraper settings, every
+// background worker for a new mode and the http server for a new address. A new data directory is used after a
+// restart.
+func (a *Application) applyConfig(f *configForm) {
+	a.cmx.Lock()
+	c := a.currentConfig()
+	a.cmx.Unlock()
+
+	modeChanged := f.Mode != c.Mode
+	scraperChanged := f.scraperChanged(c)
+	a.publishConfig(EventConfigApplying, "Applying the saved config", nil)
+
+	if modeChanged && c.Mode == OnlineMode {
+		a.publishConfig(EventConfigApplying, "Stopping the scrapers and background queues", nil)
+		a.stopSync()
+	} else if scraperChanged && !modeChanged && c.Mode == OnlineMode {
+		a.publishConfig(EventConfigApplying, "Stopping the scrapers", nil)
+		a.stopScrapers()
+	}
+
+	a.cmx.Lock()
+	if scraperChanged {
+		a.Danger = f.Danger
+		a.Scraper.RawDelay = f.Delay
+		a.Scraper.Delay = parseDuration(f.Delay, scraper.DefaultDelay)
+		a.Scraper.RawTimeout = f.Timeout
+		a.Scraper.Timeout = parseDuration(f.Timeout, scraper.DefaultTimeout)
+		a.Scraper.Proxy = f.Proxy
+		a.Scraper.AccessToken = f.AccessToken
+		a.Scraper.Cookie = f.Cookie
+		a.Scraper.Sections.Index = f.Index
+		a.Scraper.Sections.Remove = f.Remove
+		a.Scraper.Sections.Detail = f.Detail
+		for _, ac := range a.Accounts {
+			if err := a.configureAccountScraper(ac.Scraper, ac.raw); err != nil {
+				log.Error("Failed to configure the scraper of account \"%s\": %s", ac.Name, err.Error())
+				a.publishConfig(EventConfigFailed, "Failed to configure the scraper of account \""+ac.Name+"\"", err)
+			}
+		}
+	}
+	a.Mode = f.Mode
+	a.AddState("mode", a.Mode)
+	a.pendingDataDir = ""
+	if f.DataDir != a.DataDir {
+		a.pendingDataDir = f.DataDir
+	}
+	a.cmx.Unlock()
+
+	if modeChanged && f.Mode == OnlineMode {
+		a.startSync()
+		a.publishConfig(EventConfigApplying, "Switched to online mode, the scrapers have been started", nil)
+	} else if modeChanged {
+		a.publishConfig(EventConfigApplying, "Switched to offline mode, the scrapers have been stopped", nil)
+	} else if scraperChanged && f.Mode == OnlineMode {
+		a.startScrapers()
+		a.publishConfig(EventConfigApplying, "The scrapers have been restarted", nil)
+	}
+
+	if f.Host != c.Host || f.port() != c.port() {
+		// Give the response some time to be delivered, before the connection gets closed
+		time.Sleep(time.Second)
+		if err := a.restartServer(f.Host, f.port()); err != nil {
+			a.publishConfig(EventConfigFailed, "The server couldn't be moved to http://"+f.address(), err)
+			return
+		}
+	}
+	a.publishConfig(EventConfigApplied, "The saved config has been applied", nil)
+}
+
+// publishConfig reports the progress of applyConfig
+func (a *Application) publishConfig(event, message string, err error) {
+	data := map[string]interface{}{
+		"message": message,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	a.publish(TopicSync, event, data)
+}
+
+// restartServer moves the http server to a new address and falls back to the previous one, if it can't be used. The
+// error of the new address is returned.
+func (a *Application) restartServer(host string, port uint) error {
+	a.cmx.Lock()
+	defer a.cmx.Unlock()
+
+	previousHost, previousPort := a.Server.Host, a.Server.Port
+	a.Server.Host, a.Server.Port = host, port
+	// The previous server keeps running if the new address can't be bound
+	err := a.Server.Restart()
+	if err != nil {
+		log.Error("Failed to restart the server: %s", err.Error())
+		a.Server.Host, a.Server.Port = previousHost, previousPort
+	}
+	return err
+}
+
+func parseDuration(raw string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(raw); err == nil {
+		return d
+	}
+	return fallback
+}
+
+func (a *Application) configData(f *configForm, errs []error, notices []string) map[string]interface{} {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	f.ConfigFileName = a.ConfigFileName
+	return map[string]interface{}{
+		"Title":   "TBM - Config",
+		"Config":  f,
+		"Errors":  messages,
+		"Notices": notices,
+	}
+}
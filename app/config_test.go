@@ -0,0 +1,37 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestWriteConfigSections(t *testing.T) {
+	a := newTestApplication(t)
+	defer a.store.Close()
+
+	f := a.currentConfig()
+	f.Detail = "detailSection"
+	if err := a.writeConfig(f); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(a.ConfigFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := struct {
+		Scraper struct {
+			Sections map[string]string `json:"sections"`
+		} `json:"scraper"`
+	}{}
+	if err := json.Unmarshal(b, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Scraper.Sections["detail"] != "detailSection" {
+		t.Errorf("sections = %v, want the detail section", config.Scraper.Sections)
+	}
+	if _, ok := config.Scraper.Sections["index"]; ok {
+		t.Errorf("unchanged index section written: %v", config.Scraper.Sections)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"tbm/scraper"
+	"tbm/server/response"
+)
+
+var errOffline = errors.New("bookmarks can't be synced in offline mode")
+
+// runNow starts a run of the given accounts right away and returns the names of the accounts, which weren't running
+// already
+func (a *Application) runNow(accounts []*Account) ([]string, error) {
+	if a.Mode == OfflineMode {
+		return nil, errOffline
+	}
+	started := make([]string, 0)
+	for _, ac := range accounts {
+		if ac.Scraper.Run(a.Danger.RemoveBookmarks) {
+			started = append(started, ac.Name)
+		}
+	}
+	return started, nil
+}
+
+// cancelRuns cancels the active runs of the given accounts and returns the names of the canceled accounts
+func (a *Application) cancelRuns(accounts []*Account) []string {
+	canceled := make([]string, 0)
+	for _, ac := range accounts {
+		if ac.Scraper.Cancel() {
+			canceled = append(canceled, ac.Name)
+		}
+	}
+	return canceled
+}
+
+// resync resets the cursor of the given accounts and starts a run, which fetches all bookmarks again
+func (a *Application) resync(accounts []*Account) ([]string, error) {
+	if a.Mode == OfflineMode {
+		return nil, errOffline
+	}
+	for _, ac := range accounts {
+		if ac.Scraper.IsRunning() {
+			return nil, errors.New("account \"" + ac.Name + "\": " + scraper.ErrRunning.Error())
+		}
+	}
+	for _, ac := range accounts {
+		if err := ac.Scraper.ResetCursor(); err != nil {
+			return nil, errors.New("account \"" + ac.Name + "\": " + err.Error())
+		}
+	}
+	return a.runNow(accounts)
+}
+
+// controlScraper applies fn to the accounts selected by the "account" parameter and responds with their status. Only
+// pages of TBM may control the scrapers, otherwise any website could wipe the cursor or trigger runs.
+func (a *Application) controlScraper(resp *response.JsonResponse, fn func(accounts []*Account) (map[string]interface{}, error)) {
+	if fn != nil && !a.sameOrigin(resp) {
+		return
+	}
+	accounts, err := a.selectAccounts(resp.Request().URL.Query().Get("account"))
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusNotFound))
+		return
+	}
+	data := map[string]interface{}{}
+	if fn != nil {
+		if data, err = fn(accounts); err != nil {
+			resp.AddError(response.NewError(err, http.StatusConflict))
+			return
+		}
+	}
+	data["Accounts"] = a.accountStatus()
+	resp.SetData(data)
+}
+
+func (a *Application) scraperEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, nil)
+}
+
+func (a *Application) pauseEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, func(accounts []*Account) (map[string]interface{}, error) {
+		for _, ac := range accounts {
+			ac.Scraper.Pause()
+		}
+		return map[string]interface{}{}, nil
+	})
+}
+
+func (a *Application) resumeEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, func(accounts []*Account) (map[string]interface{}, error) {
+		for _, ac := range accounts {
+			ac.Scraper.Resume()
+		}
+		return map[string]interface{}{}, nil
+	})
+}
+
+func (a *Application) runEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, func(accounts []*Account) (map[string]interface{}, error) {
+		started, err := a.runNow(accounts)
+		return map[string]interface{}{"Started": started}, err
+	})
+}
+
+func (a *Application) cancelEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, func(accounts []*Account) (map[string]interface{}, error) {
+		return map[string]interface{}{"Canceled": a.cancelRuns(accounts)}, nil
+	})
+}
+
+func (a *Application) resyncEndpoint(resp *response.JsonResponse) {
+	a.controlScraper(resp, func(accounts []*Account) (map[string]interface{}, error) {
+		started, err := a.resync(accounts)
+		return map[string]interface{}{"Started": started}, err
+	})
+}
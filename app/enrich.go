@@ -0,0 +1,162 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"tbm/scraper"
+	"tbm/utils/log"
+	"time"
+)
+
+// enrichQueue holds the ids of incomplete tweets, such as imported ones, which are completed by the scraper later on.
+// Missing details are persisted along with each tweet, so the queue is rebuilt whenever the scraper starts.
+type enrichQueue struct {
+	mx     sync.Mutex
+	ids    []string
+	queued map[string]bool
+	close  chan bool
+}
+
+func newEnrichQueue() *enrichQueue {
+	return &enrichQueue{
+		ids:    make([]string, 0),
+		queued: map[string]bool{},
+	}
+}
+
+func (q *enrichQueue) Push(id string) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.queued[id] == false {
+		q.queued[id] = true
+		q.ids = append(q.ids, id)
+	}
+}
+
+func (q *enrichQueue) Pop() (string, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if len(q.ids) == 0 {
+		return "", false
+	}
+	id := q.ids[0]
+	q.ids = q.ids[1:]
+	delete(q.queued, id)
+	return id, true
+}
+
+func (q *enrichQueue) Len() int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	return len(q.ids)
+}
+
+// startEnrichment queues all incomplete tweets and completes one of them per scraper delay, as long as the scraper
+// isn't busy fetching new bookmarks
+func (a *Application) startEnrichment() {
+	closed := make(chan bool)
+	a.enrich.close = closed
+
+	go func() {
+		a.EachTweet(func(ct *scraper.CachedTweet) bool {
+			if ct.IsIncomplete() {
+				a.enrich.Push(ct.Tweet.IdStr)
+			}
+			return true
+		})
+		if n := a.enrich.Len(); n > 0 {
+			log.Info("%d incomplete tweets queued for enrichment", n)
+		}
+
+		interval := a.primaryScraper().Delay
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				a.enrichNext()
+			case <-closed:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (a *Application) stopEnrichment() {
+	if a.enrich.close != nil {
+		close(a.enrich.close)
+		a.enrich.close = nil
+	}
+}
+
+func (a *Application) enrichNext() {
+	if a.scrapersRunning() || a.primaryScraper().Sections.Detail == "" {
+		return
+	}
+	id, ok := a.enrich.Pop()
+	if !ok {
+		return
+	}
+
+	// Tweets failing to enrich (e.g. deleted ones) are kept incomplete and retried after the next start
+	if err := a.EnrichTweet(&scraper.CachedTweet{Tweet: scraper.TweetResult{IdStr: id}}); err != nil {
+		log.Warning("Failed to enrich tweet %s: %s", id, err.Error())
+	} else {
+		log.Success("Incomplete tweet enriched: %s", id)
+	}
+}
+
+// EnrichTweet fetches the conversation of an incomplete tweet and replaces all imported details. The user and tweet of
+// the given tweet are used if available, otherwise they are taken from the fetched conversation.
+func (a *Application) EnrichTweet(fetched *scraper.CachedTweet) error {
+	id := fetched.Tweet.IdStr
+	accounts := append([]string{}, fetched.Accounts...)
+	if stored, ok := a.GetTweet(id); ok {
+		accounts = append(accounts, stored.Accounts...)
+	}
+	conversation, err := a.accountScraper(accounts).TweetDetail(id)
+	if err != nil {
+		return err
+	}
+
+	tweet := fetched.Tweet
+	user := fetched.User
+	if tweet.CreatedAt == "" {
+		tweet = conversation.GlobalObjects.Tweets[id]
+	}
+	if user.RestId == "" {
+		cu, ok := conversation.GlobalObjects.Users[tweet.UserIdStr]
+		if !ok {
+			return errors.New("author of tweet " + id + " not found in conversation")
+		}
+		user = scraper.NewUserResult(cu)
+	}
+
+	a.saveLinked(&scraper.CachedTweet{Tweet: tweet, Conversation: *conversation}, append(fetched.Linked, conversation.Linked...))
+
+	ct, err := a.UpdateTweet(id, func(ct *scraper.CachedTweet) error {
+		ct.User = user
+		ct.Tweet = tweet
+		ct.Conversation = *conversation
+		ct.Version = a.Build.Version
+		ct.Incomplete = nil
+		for _, account := range fetched.Accounts {
+			ct.AddAccount(account)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.saveRaw(id, fetched.Raw, conversation)
+	a.downloadMedia(ct)
+	a.archiveLinks(ct)
+
+	return nil
+}
@@ -0,0 +1,591 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tbm/scraper"
+	"tbm/server"
+	"tbm/server/response"
+	"tbm/utils/log"
+	"time"
+)
+
+const (
+	ExportMarkdown = "markdown"
+	ExportHtml     = "html"
+	ExportCsv      = "csv"
+)
+
+var ExportFormats = []string{ExportMarkdown, ExportHtml, ExportCsv}
+
+// ExportTarget receives all files of an export
+type ExportTarget interface {
+	Create(name string) (io.Writer, error)
+	Close() error
+}
+
+// DirectoryTarget writes all exported files into a directory
+type DirectoryTarget struct {
+	Dir  string
+	file *os.File
+}
+
+func (t *DirectoryTarget) Create(name string) (io.Writer, error) {
+	if err := t.Close(); err != nil {
+		return nil, err
+	}
+	filename := filepath.Join(t.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	t.file = f
+	return f, nil
+}
+
+func (t *DirectoryTarget) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// ZipTarget writes all exported files into a zip archive
+type ZipTarget struct {
+	zw *zip.Writer
+}
+
+func NewZipTarget(w io.Writer) *ZipTarget {
+	return &ZipTarget{zw: zip.NewWriter(w)}
+}
+
+func (t *ZipTarget) Create(name string) (io.Writer, error) {
+	return t.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+}
+
+func (t *ZipTarget) Close() error {
+	return t.zw.Close()
+}
+
+// WriterTarget writes every exported file straight into a single writer. It is only useful for single file exports
+// such as csv.
+type WriterTarget struct {
+	W io.Writer
+}
+
+func (t *WriterTarget) Create(name string) (io.Writer, error) {
+	return t.W, nil
+}
+
+func (t *WriterTarget) Close() error {
+	return nil
+}
+
+type exporter struct {
+	a      *Application
+	target ExportTarget
+	media  map[string][]string
+	copied map[string]bool
+}
+
+// Export writes all tweets matching the given filter parameters into the target. The same parameters as used by
+// the tweet list and /api/tweet are supported. The number of exported tweets is returned.
+func (a *Application) Export(format string, params url.Values, target ExportTarget) (int, error) {
+	q, err := newTweetQuery(params)
+	if err != nil {
+		return 0, err
+	}
+	if format, err = ParseExportFormat(format); err != nil {
+		return 0, err
+	}
+	tweets := a.findTweets(q)
+
+	e := &exporter{
+		a:      a,
+		target: target,
+		copied: map[string]bool{},
+	}
+
+	switch format {
+	case ExportMarkdown:
+		err = e.markdown(tweets)
+	case ExportHtml:
+		err = e.html(tweets)
+	case ExportCsv:
+		var w io.Writer
+		if w, err = target.Create("tweets.csv"); err == nil {
+			err = exportCsv(w, tweets)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(tweets), nil
+}
+
+// exportCsv writes the core fields of all given tweets as csv
+func exportCsv(w io.Writer, tweets []*scraper.CachedTweet) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"id", "author", "author_name", "created_at", "text", "urls",
+		"favorite_count", "retweet_count", "reply_count", "quote_count",
+		"tags", "collections", "notes",
+	})
+	for _, ct := range tweets {
+		notes := make([]string, 0, len(ct.Notes))
+		for _, note := range ct.Notes {
+			notes = append(notes, strings.TrimSpace(note.Highlight+"\n"+note.Text))
+		}
+		_ = cw.Write([]string{
+			ct.Tweet.IdStr,
+			csvText(ct.User.Legacy.ScreenName),
+			csvText(ct.User.Legacy.Name),
+			exportTime(ct.CreatedAt()),
+			csvText(plainText(&ct.Tweet)),
+			csvText(strings.Join(tweetUrls(&ct.Tweet), " ")),
+			strconv.Itoa(ct.Tweet.FavoriteCount),
+			strconv.Itoa(ct.Tweet.RetweetCount),
+			strconv.Itoa(ct.Tweet.ReplyCount),
+			strconv.Itoa(ct.Tweet.QuoteCount),
+			csvText(strings.Join(ct.Tags, " ")),
+			csvText(strings.Join(ct.Collections, ", ")),
+			csvText(strings.Join(notes, "\n\n")),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText prefixes texts starting like a formula with a quote, so spreadsheets show them as text instead of
+// evaluating them
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// plainText returns the unescaped tweet text with expanded urls and without media links
+func plainText(tweet *scraper.TweetResult) string {
+	text := html.UnescapeString(tweet.Content())
+	for _, u := range tweet.ContentUrls() {
+		text = strings.ReplaceAll(text, u.Url, u.ExpandedUrl)
+	}
+	for _, m := range tweet.Entities.Media {
+		text = strings.ReplaceAll(text, m.Url, "")
+	}
+	return strings.TrimSpace(text)
+}
+
+func tweetUrls(tweet *scraper.TweetResult) []string {
+	urls := make([]string, 0, len(tweet.ContentUrls()))
+	for _, u := range tweet.ContentUrls() {
+		urls = append(urls, u.ExpandedUrl)
+	}
+	return urls
+}
+
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// markdown writes one markdown file with a yaml front-matter per tweet. Media files are linked relative to the
+// tweet files and copied into media/.
+func (e *exporter) markdown(tweets []*scraper.CachedTweet) error {
+	for _, ct := range tweets {
+		buf := &bytes.Buffer{}
+		buf.WriteString("---\n")
+		fmt.Fprintf(buf, "id: %s\n", strconv.Quote(ct.Tweet.IdStr))
+		fmt.Fprintf(buf, "author: %s\n", strconv.Quote(ct.User.Legacy.ScreenName))
+		fmt.Fprintf(buf, "author_name: %s\n", strconv.Quote(ct.User.Legacy.Name))
+		fmt.Fprintf(buf, "date: %s\n", strconv.Quote(exportTime(ct.CreatedAt())))
+		fmt.Fprintf(buf, "url: %s\n", strconv.Quote(fmt.Sprintf("https://twitter.com/%s/status/%s", ct.User.Legacy.ScreenName, ct.Tweet.IdStr)))
+		fmt.Fprintf(buf, "lang: %s\n", strconv.Quote(ct.Tweet.Lang))
+		fmt.Fprintf(buf, "likes: %d\n", ct.Tweet.FavoriteCount)
+		fmt.Fprintf(buf, "retweets: %d\n", ct.Tweet.RetweetCount)
+		fmt.Fprintf(buf, "replies: %d\n", ct.Tweet.ReplyCount)
+		fmt.Fprintf(buf, "quotes: %d\n", ct.Tweet.QuoteCount)
+		fmt.Fprintf(buf, "urls: %s\n", yamlList(tweetUrls(&ct.Tweet)))
+		fmt.Fprintf(buf, "tags: %s\n", yamlList(ct.Tags))
+		fmt.Fprintf(buf, "collections: %s\n", yamlList(ct.Collections))
+		buf.WriteString("---\n\n")
+
+		if err := e.markdownTweet(buf, &ct.Tweet, ct.NotesFor(ct.Tweet.IdStr)); err != nil {
+			return err
+		}
+
+		thread := ct.Thread()
+		replies := make([]*scraper.ThreadItem, 0, len(thread))
+		for id, item := range thread {
+			if id != ct.Tweet.IdStr {
+				replies = append(replies, item)
+			}
+		}
+		if len(replies) > 0 {
+			sort.Slice(replies, func(i, j int) bool {
+				return sortableId(replies[i].Tweet.IdStr) < sortableId(replies[j].Tweet.IdStr)
+			})
+			buf.WriteString("\n## Thread\n")
+			for _, item := range replies {
+				fmt.Fprintf(buf, "\n### @%s - %s\n\n", item.User.ScreenName, exportTime(parseTweetTime(item.Tweet.CreatedAt)))
+				if err := e.markdownTweet(buf, &item.Tweet, item.Notes); err != nil {
+					return err
+				}
+			}
+		}
+
+		w, err := e.target.Create(ct.Tweet.IdStr + ".md")
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) markdownTweet(buf *bytes.Buffer, tweet *scraper.TweetResult, notes []scraper.Note) error {
+	buf.WriteString(plainText(tweet) + "\n")
+
+	for _, m := range tweet.ExtendedEntities.Media {
+		image, err := e.copyMedia(m.IdStr, server.ImageExtensions)
+		if err != nil {
+			return err
+		}
+		if image != "" {
+			fmt.Fprintf(buf, "\n![](%s)\n", image)
+		}
+		if m.Type == "video" || m.Type == "animated_gif" {
+			video, err := e.copyMedia(m.IdStr, server.VideoExtensions)
+			if err != nil {
+				return err
+			}
+			if video != "" && video != image {
+				fmt.Fprintf(buf, "\n[%s](%s)\n", m.Type, video)
+			}
+		}
+	}
+
+	for _, note := range notes {
+		buf.WriteString("\n")
+		if note.Highlight != "" {
+			buf.WriteString("> " + strings.ReplaceAll(note.Highlight, "\n", "\n> ") + "\n\n")
+		}
+		if note.Text != "" {
+			buf.WriteString(note.Text + "\n\n")
+		}
+		fmt.Fprintf(buf, "_Note from %s_\n", exportTime(note.UpdatedAt))
+	}
+	return nil
+}
+
+func yamlList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func sortableId(id string) string {
+	return fmt.Sprintf("%020s", id)
+}
+
+func parseTweetTime(str string) time.Time {
+	t, _ := time.Parse("Mon Jan 02 15:04:05 -0700 2006", str)
+	return t
+}
+
+var exportLinkPattern = regexp.MustCompile(`(href|src)="/([^"]*)"`)
+
+// html renders the tweet list and a page per tweet by using the regular view templates. All absolute links are
+// rewritten to relative ones, so the export can be opened without a running server.
+func (e *exporter) html(tweets []*scraper.CachedTweet) error {
+	state := map[string]interface{}{}
+	for k, v := range e.a.GetState() {
+		state[k] = v
+	}
+	state["mode"] = OfflineMode.ToString()
+	state["static"] = true
+
+	tmpl, err := e.a.Server.ParseTemplates(map[string]interface{}{
+		"GetState": func() map[string]interface{} {
+			return state
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	paginator := NewPaginator(len(tweets), 0)
+	paginator.SetData(tweetsToData(tweets))
+
+	buf := &bytes.Buffer{}
+	if err = tmpl.ExecuteTemplate(buf, "tweet.index", map[string]interface{}{
+		"State":     state,
+		"Title":     "TBM - Bookmarks",
+		"Paginator": paginator,
+	}); err != nil {
+		return err
+	}
+	if err = e.writePage("index.html", "", buf.Bytes()); err != nil {
+		return err
+	}
+
+	for _, ct := range tweets {
+		data := tweetViewData(ct, e.a.thread(ct))
+		data["State"] = state
+		data["AllAccounts"] = e.a.AccountNames()
+
+		buf.Reset()
+		if err = tmpl.ExecuteTemplate(buf, "tweet.show", data); err != nil {
+			return err
+		}
+		if err = e.writePage("tweet/"+ct.Tweet.IdStr+".html", "../", buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	public, err := e.a.Server.PublicFS()
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(public, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return e.copyFile(name, func() (io.ReadCloser, error) {
+			return public.Open(name)
+		})
+	})
+}
+
+func (e *exporter) writePage(name, root string, page []byte) error {
+	var rErr error
+	page = exportLinkPattern.ReplaceAllFunc(page, func(match []byte) []byte {
+		parts := exportLinkPattern.FindSubmatch(match)
+		link, err := e.rewriteLink(string(parts[2]))
+		if err != nil && rErr == nil {
+			rErr = err
+		}
+		return []byte(fmt.Sprintf(`%s="%s%s"`, parts[1], root, link))
+	})
+	if rErr != nil {
+		return rErr
+	}
+
+	w, err := e.target.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(page)
+	return err
+}
+
+func (e *exporter) rewriteLink(link string) (string, error) {
+	segments := strings.SplitN(strings.SplitN(link, "?", 2)[0], "/", 2)
+	id := ""
+	if len(segments) == 2 {
+		id = segments[1]
+	}
+
+	switch segments[0] {
+	case "tweet":
+		return "tweet/" + id + ".html", nil
+	case "media", "video":
+		extensions := server.ImageExtensions
+		if segments[0] == "video" {
+			extensions = server.VideoExtensions
+		}
+		filename, err := e.copyMedia(id, extensions)
+		if filename == "" {
+			filename = "media/" + id
+		}
+		return filename, err
+	case "css", "js", "webfonts":
+		return link, nil
+	}
+	return "index.html", nil
+}
+
+// copyMedia copies the media file of a given id into media/ and returns its relative filename. An empty string is
+// returned if the media file hasn't been downloaded.
+func (e *exporter) copyMedia(id string, extensions []string) (string, error) {
+	if e.media == nil {
+		e.media = map[string][]string{}
+		entries, _ := os.ReadDir(path.Join(e.a.DataDir, "media"))
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			ext := filepath.Ext(entry.Name())
+			mediaId := strings.TrimSuffix(entry.Name(), ext)
+			e.media[mediaId] = append(e.media[mediaId], entry.Name())
+		}
+	}
+
+	for _, filename := range e.media[id] {
+		for _, ext := range extensions {
+			if strings.TrimPrefix(filepath.Ext(filename), ".") == ext {
+				name := "media/" + filename
+				return name, e.copyFile(name, func() (io.ReadCloser, error) {
+					return os.Open(path.Join(e.a.DataDir, "media", filename))
+				})
+			}
+		}
+	}
+	return "", nil
+}
+
+func (e *exporter) copyFile(name string, open func() (io.ReadCloser, error)) error {
+	if e.copied[name] {
+		return nil
+	}
+	e.copied[name] = true
+
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := e.target.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// ParseExportFormat validates a given export format
+func ParseExportFormat(format string) (string, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "md":
+		format = ExportMarkdown
+	case "htm":
+		format = ExportHtml
+	}
+	for _, f := range ExportFormats {
+		if f == format {
+			return format, nil
+		}
+	}
+	return "", errors.New("unknown export format, use one of: " + strings.Join(ExportFormats, ", "))
+}
+
+// ExportFile exports all tweets matching a given url encoded filter such as "tag=golang&since=2023-01-01". Markdown
+// and html exports are written into a directory unless the output ends with ".zip". Csv exports are written to stdout
+// if the output is "-".
+func (a *Application) ExportFile(format, output, filter string) error {
+	format, err := ParseExportFormat(format)
+	if err != nil {
+		return err
+	}
+	params, err := url.ParseQuery(filter)
+	if err != nil {
+		return err
+	}
+
+	var target ExportTarget
+	if output == "-" && format == ExportCsv {
+		target = &WriterTarget{W: os.Stdout}
+	} else if format == ExportCsv || strings.HasSuffix(strings.ToLower(output), ".zip") {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if format == ExportCsv {
+			target = &WriterTarget{W: f}
+		} else {
+			target = NewZipTarget(f)
+		}
+	} else {
+		if err = os.MkdirAll(output, os.ModePerm); err != nil {
+			return err
+		}
+		target = &DirectoryTarget{Dir: output}
+	}
+
+	count, err := a.Export(format, params, target)
+	// The target is closed on errors as well, so the file written last doesn't stay open
+	if cErr := target.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	if output != "-" {
+		log.Success("%d tweets exported to %s", count, output)
+	}
+
+	return nil
+}
+
+func (a *Application) exportEndpoint(w http.ResponseWriter, r *http.Request, _ httprouter.Params) *response.Error {
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		return response.NewError(err, http.StatusBadRequest)
+	}
+	if _, err = NewTweetFilter(r.URL.Query()); err != nil {
+		return response.NewError(err, http.StatusBadRequest)
+	}
+
+	filename := fmt.Sprintf("tbm-%s-%s", format, time.Now().Format("20060102-150405"))
+	var target ExportTarget
+	if format == ExportCsv {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		filename += ".csv"
+		target = &WriterTarget{W: w}
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		filename += ".zip"
+		target = NewZipTarget(w)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	// The response has already been started, so errors can only be logged
+	count, err := a.Export(format, r.URL.Query(), target)
+	if err == nil {
+		err = target.Close()
+	}
+	if err != nil {
+		log.Error("Failed to export tweets: %s", err.Error())
+	} else {
+		log.Info("%d tweets exported as %s", count, format)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"tbm/scraper"
+	"time"
+)
+
+// TweetFilter narrows down a list of tweets by structured criteria
+type TweetFilter struct {
+	Since       time.Time
+	Until       time.Time
+	Author      string
+	HasMedia    *bool
+	HasVideo    *bool
+	HasLink     *bool
+	Lang        string
+	MinLikes    int
+	MinRetweets int
+	MinReplies  int
+	IsReply     *bool
+	IsQuote     *bool
+	Tag         string
+	Collection  string
+	Account     string
+
+	parameters map[string]string
+}
+
+var filterDateLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+func NewTweetFilter(values url.Values) (*TweetFilter, error) {
+	f := &TweetFilter{parameters: map[string]string{}}
+
+	for name, target := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := values.Get(name); v != "" {
+			t, dateOnly, err := parseFilterDate(v)
+			if err != nil {
+				return nil, errors.New("invalid date for " + name + ": " + v)
+			}
+			if name == "until" && dateOnly {
+				// Include the entire day
+				t = t.Add(24 * time.Hour)
+			}
+			*target = t
+			f.parameters[name] = v
+		}
+	}
+
+	for name, target := range map[string]**bool{
+		"has_media": &f.HasMedia,
+		"has_video": &f.HasVideo,
+		"has_link":  &f.HasLink,
+		"is_reply":  &f.IsReply,
+		"is_quote":  &f.IsQuote,
+	} {
+		if v := values.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.New("invalid boolean for " + name + ": " + v)
+			}
+			*target = &b
+			f.parameters[name] = v
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"min_likes":    &f.MinLikes,
+		"min_retweets": &f.MinRetweets,
+		"min_replies":  &f.MinReplies,
+	} {
+		if v := values.Get(name); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid number for " + name + ": " + v)
+			}
+			*target = i
+			f.parameters[name] = v
+		}
+	}
+
+	if v := values.Get("author"); v != "" {
+		f.Author = strings.ToLower(strings.TrimPrefix(v, "@"))
+		f.parameters["author"] = v
+	}
+	if v := values.Get("tag"); v != "" {
+		f.Tag = scraper.NormalizeTag(v)
+		f.parameters["tag"] = v
+	}
+	if v := values.Get("collection"); v != "" {
+		f.Collection = scraper.NormalizeCollection(v)
+		f.parameters["collection"] = v
+	}
+	if v := values.Get("account"); v != "" {
+		f.Account = strings.ToLower(v)
+		f.parameters["account"] = v
+	}
+	if v := values.Get("lang"); v != "" {
+		f.Lang = strings.ToLower(v)
+		f.parameters["lang"] = v
+	}
+
+	return f, nil
+}
+
+func parseFilterDate(v string) (time.Time, bool, error) {
+	var err error
+	for _, layout := range filterDateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, v); err == nil {
+			return t, layout == "2006-01-02", nil
+		}
+	}
+	if unix, e := strconv.ParseInt(v, 10, 64); e == nil {
+		return time.Unix(unix, 0), false, nil
+	}
+	return time.Time{}, false, err
+}
+
+// Empty reports whether no filter criteria are set
+func (f *TweetFilter) Empty() bool {
+	return len(f.parameters) == 0
+}
+
+// Parameters returns the raw request parameters of all set criteria
+func (f *TweetFilter) Parameters() map[string]string {
+	return f.parameters
+}
+
+func (f *TweetFilter) Match(ct *scraper.CachedTweet) bool {
+	if f.Empty() {
+		return true
+	}
+	tweet := &ct.Tweet
+
+	if f.Since.IsZero() == false && ct.CreatedAt().Before(f.Since) {
+		return false
+	}
+	if f.Until.IsZero() == false && ct.CreatedAt().Before(f.Until) == false {
+		return false
+	}
+	if f.Author != "" && strings.ToLower(ct.User.Legacy.ScreenName) != f.Author && ct.User.RestId != f.Author {
+		return false
+	}
+	if f.Lang != "" && strings.ToLower(tweet.Lang) != f.Lang {
+		return false
+	}
+	if f.Tag != "" && ct.HasTag(f.Tag) == false {
+		return false
+	}
+	if f.Collection != "" && ct.InCollection(f.Collection) == false {
+		return false
+	}
+	if f.Account != "" && ct.BookmarkedBy(f.Account) == false {
+		return false
+	}
+	if tweet.FavoriteCount < f.MinLikes || tweet.RetweetCount < f.MinRetweets || tweet.ReplyCount < f.MinReplies {
+		return false
+	}
+
+	hasVideo := false
+	for _, media := range tweet.ExtendedEntities.Media {
+		if media.Type == "video" || media.Type == "animated_gif" {
+			hasVideo = true
+			break
+		}
+	}
+	hasMedia := len(tweet.ExtendedEntities.Media) > 0 || len(tweet.Entities.Media) > 0
+
+	return matchBool(f.HasMedia, hasMedia) &&
+		matchBool(f.HasVideo, hasVideo) &&
+		matchBool(f.HasLink, len(tweet.ContentUrls()) > 0) &&
+		matchBool(f.IsReply, tweet.InReplyToStatusIDStr != "") &&
+		matchBool(f.IsQuote, tweet.IsQuoteStatus || tweet.QuotedStatusIDStr != "")
+}
+
+func matchBool(expected *bool, value bool) bool {
+	return expected == nil || *expected == value
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"net/http"
+	"path"
+	"tbm/fixture"
+	"tbm/utils/log"
+)
+
+// RecordFixtures saves every response received by the scraper into a fixture directory. Cookies and tokens are
+// redacted, so the recordings can be shared and replayed later on.
+func (a *Application) RecordFixtures(dir string) error {
+	var err error
+	for _, ac := range a.accounts {
+		sc, accountDir := ac.Scraper, a.fixtureDir(dir, ac)
+		sc.WrapTransport(func(next http.RoundTripper) http.RoundTripper {
+			var recorder *fixture.Recorder
+			if recorder, err = fixture.NewRecorder(accountDir, next, sc.Secrets); err != nil {
+				return next
+			}
+			return recorder
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Warning("Recording all responses into %s", dir)
+	return nil
+}
+
+// ReplayFixtures serves all scraper requests from a fixture directory without any network access
+func (a *Application) ReplayFixtures(dir string) error {
+	for _, ac := range a.accounts {
+		player, err := fixture.NewPlayer(a.fixtureDir(dir, ac), ac.Scraper.Secrets)
+		if err != nil {
+			return err
+		}
+		ac.Scraper.SetTransport(player)
+	}
+	log.Warning("Replaying recorded responses from %s", dir)
+
+	return nil
+}
+
+// fixtureDir returns the fixture directory of an account. Every account uses a subdirectory of its own, if more than
+// one account is configured.
+func (a *Application) fixtureDir(dir string, ac *Account) string {
+	if len(a.accounts) > 1 {
+		return path.Join(dir, ac.Name)
+	}
+	return dir
+}
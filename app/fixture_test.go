@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"tbm/scraper"
+	"tbm/scrapertest"
+	"testing"
+)
+
+// fixtureDir contains a redacted recording of the bookmarks added by addBookmarks
+var fixtureDir = path.Join("testdata", "fixtures", "sync")
+
+var record = flag.Bool("record", false, "record the fixtures of the replay tests against the fake server")
+
+// redirect sends all requests to the fake server and replaces its url within all responses by the twitter assets url,
+// so recordings don't depend on the random port of the fake server
+type redirect struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (r *redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	req.Host = ""
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.ReplaceAll(body, []byte(r.target.String()), []byte(scraper.DefaultAssetsUrl))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return resp, nil
+}
+
+// recordFixtures replaces the recording within fixtureDir by a new one of a sync against the fake server
+func recordFixtures(t *testing.T) {
+	srv := scrapertest.NewServer()
+	defer srv.Close()
+	addBookmarks(srv)
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(fixtureDir); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestApplication(t)
+	a.Scraper.SetTransport(&redirect{target: target, next: http.DefaultTransport})
+	if err := a.RecordFixtures(fixtureDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	checkBookmarks(t, a)
+}
+
+func TestReplayFixtures(t *testing.T) {
+	if *record {
+		recordFixtures(t)
+	}
+
+	a := newTestApplication(t)
+	if err := a.ReplayFixtures(fixtureDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	checkBookmarks(t, a)
+}
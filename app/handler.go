@@ -1,11 +1,24 @@
 package app
 
 import (
+	"errors"
 	"net/http"
+	"tbm/scraper"
 	"tbm/server/response"
-	"time"
 )
 
+var errCrossOrigin = errors.New("requests of other pages are not accepted")
+
+// sameOrigin reports whether a request has been sent by a page of TBM and rejects it otherwise. Every endpoint
+// changing data has to check it, since browsers send form posts of any other page along as well.
+func (a *Application) sameOrigin(resp *response.JsonResponse) bool {
+	if a.Server.SameOrigin(resp.Request()) {
+		return true
+	}
+	resp.AddError(response.NewError(errCrossOrigin, http.StatusForbidden))
+	return false
+}
+
 func (a *Application) stateEndpoint(resp *response.JsonResponse) {
 	resp.SetData(a.GetState())
 }
@@ -16,24 +29,23 @@ func (a *Application) tweetsEndpoint(resp *response.JsonResponse) {
 		resp.AddError(err)
 		return
 	}
-	resp.SetData(map[string]interface{}{
+	resp.SetData(paginatorData(paginator))
+}
+
+func paginatorData(paginator *Paginator) map[string]interface{} {
+	return map[string]interface{}{
 		"page":       paginator.Page,
 		"limit":      paginator.Limit,
 		"Total":      paginator.Total,
 		"TotalPages": paginator.TotalPages,
 		"Data":       paginator.Data(),
 		"Links":      paginator.Links(5),
-	})
+	}
 }
 
 func (a *Application) tweetEndpoint(resp *response.JsonResponse) {
-	tweets := a.GetTweets()
-	if cache, ok := tweets[resp.Parameter().ByName("id")]; ok {
-		resp.SetData(map[string]interface{}{
-			"Thread": cache.Thread(),
-			"Tweet":  cache.Tweet,
-			"User":   cache.User,
-		})
+	if cache, ok := a.GetTweet(resp.Parameter().ByName("id")); ok {
+		resp.SetData(a.tweetData(cache))
 		return
 	}
 	resp.AddError(response.NewErrorFromStatus(http.StatusNotFound))
@@ -41,25 +53,38 @@ func (a *Application) tweetEndpoint(resp *response.JsonResponse) {
 	return
 }
 
-func (a *Application) statusEndpoint(resp *response.JsonResponse) {
-	newest := time.Time{}
-	oldest := time.Time{}
-	for _, ct := range a.GetTweets() {
-		createdAt := ct.CreatedAt()
-		if newest.IsZero() || newest.Before(createdAt) {
-			newest = createdAt
-		}
-		if oldest.IsZero() || oldest.After(createdAt) {
-			oldest = createdAt
-		}
+func (a *Application) tweetData(cache *scraper.CachedTweet) map[string]interface{} {
+	return map[string]interface{}{
+		"Thread":      a.thread(cache),
+		"Tweet":       cache.Tweet,
+		"User":        cache.User,
+		"Tags":        cache.Tags,
+		"Collections": cache.Collections,
+		"Notes":       cache.Notes,
+		"Accounts":    cache.Accounts,
 	}
+}
+
+func (a *Application) statusEndpoint(resp *response.JsonResponse) {
+	newest, oldest := a.tweetRange()
 	resp.SetData(map[string]interface{}{
-		"Cursor":         a.Scraper.GetCursor(),
-		"TotalBookmarks": len(a.GetTweets()),
+		"Cursor":         a.primaryScraper().GetCursor(),
+		"TotalBookmarks": a.CountTweets(),
 		"Build":          a.Build,
 		"NewestTweet":    newest,
 		"OldestTweet":    oldest,
 		"State":          a.GetState(),
-		"Scraper":        a.Scraper.IsRunning(),
+		"Scraper":        a.scrapersRunning(),
+		"Incomplete":     a.enrich.Len(),
+		"Media":          a.Media.Counts(),
+		"RateLimits":     a.primaryScraper().RateLimits(),
+		"NextRequest":    a.primaryScraper().NextRequest(),
+		"NextRun":        a.primaryScraper().NextRun(),
+		"Paused":         a.scrapersPaused(),
+		"Drifts":         a.drifts(),
+		"Accounts":       a.accountStatus(),
+		"Progress":       a.syncProgress(),
+		"SyncState":      syncState(a.accounts),
+		"Runs":           syncRuns(a.accounts, DefaultRunLimit),
 	})
 }
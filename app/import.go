@@ -0,0 +1,298 @@
+package app
+
+import (
+	"archive/zip"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"tbm/archive"
+	"tbm/scraper"
+	"tbm/server/response"
+	"tbm/utils/filesystem"
+	"tbm/utils/log"
+)
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Media    int `json:"media"`
+}
+
+// Import reads an official Twitter / X data archive and adds all bookmarks and tweets it contains. Already existing
+// tweets are skipped. The archive lacks most details of bookmarked tweets, therefore all imported tweets are marked
+// as incomplete and queued to be enriched by the scraper.
+func (a *Application) Import(filename string) (*ImportResult, error) {
+	ar, err := archive.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	account, err := ar.Account()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ar.Profile()
+	if err != nil {
+		return nil, err
+	}
+	tweets, err := ar.Tweets()
+	if err != nil {
+		return nil, err
+	}
+	bookmarks, err := ar.Bookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	owner := scraper.UserResult{}
+	if account != nil && !isNumericId(account.AccountId) {
+		log.Error("Account id %q of %s is invalid, the account is ignored", account.AccountId, filename)
+		account = nil
+	}
+	if account != nil {
+		owner.RestId = account.AccountId
+		owner.Legacy.ScreenName = account.Username
+		owner.Legacy.Name = account.DisplayName
+		if profile != nil {
+			owner.Legacy.Description = profile.Description.Bio
+			owner.Legacy.Location = profile.Description.Location
+			owner.Legacy.ProfileImageUrlHttps = profile.AvatarMediaUrl
+			if n, err := a.importMedia(ar.ProfileMedia(account.AccountId), profile.AvatarMediaUrl, owner.RestId); err != nil {
+				return result, err
+			} else {
+				result.Media += n
+			}
+		}
+	}
+
+	own := map[string]*scraper.TweetResult{}
+	for _, tweet := range tweets {
+		if !isNumericId(tweet.IdStr) {
+			result.Skipped++
+			continue
+		}
+		own[tweet.IdStr] = tweet
+	}
+
+	add := func(ct *scraper.CachedTweet) error {
+		if a.store.Has(ct.Tweet.IdStr) {
+			result.Skipped++
+			return nil
+		}
+		ct.Version = a.Build.Version
+		ct.Conversation = *scraper.NewConversationResponse()
+		ct.Conversation.GlobalObjects.Tweets[ct.Tweet.IdStr] = ct.Tweet
+		if ct.User.RestId != "" {
+			ct.Conversation.GlobalObjects.Users[ct.User.RestId] = scraper.NewConversationUser(ct.User)
+		}
+		ct.SetMissing(scraper.MissingConversation)
+
+		if inserted, err := a.AddTweet(ct); err != nil {
+			return err
+		} else if !inserted {
+			result.Skipped++
+			return nil
+		}
+		a.index.Add(a.tweetDocument(ct))
+		a.enrich.Push(ct.Tweet.IdStr)
+		result.Imported++
+		return nil
+	}
+
+	for _, bookmark := range bookmarks {
+		// Ids become file names, so anything but a number could point outside the data directory
+		if !isNumericId(bookmark.TweetId) {
+			result.Skipped++
+			continue
+		}
+		ct := &scraper.CachedTweet{}
+		if tweet, ok := own[bookmark.TweetId]; ok {
+			// A bookmarked tweet of the account itself
+			if ct, err = a.importTweet(ar, owner, tweet, result); err != nil {
+				return result, err
+			}
+			delete(own, bookmark.TweetId)
+		} else {
+			ct.Tweet.IdStr = bookmark.TweetId
+			ct.Tweet.FullText = escapeText(bookmark.FullText)
+			if t := archive.SnowflakeTime(bookmark.TweetId); !t.IsZero() {
+				ct.Tweet.CreatedAt = t.Format("Mon Jan 02 15:04:05 -0700 2006")
+			}
+			ct.User.Legacy.ScreenName = bookmark.ScreenName()
+			ct.SetMissing(scraper.MissingUser)
+			ct.SetMissing(scraper.MissingEntities)
+			ct.SetMissing(scraper.MissingCounts)
+			ct.SetMissing(scraper.MissingMedia)
+			if ct.Tweet.FullText == "" {
+				ct.SetMissing(scraper.MissingText)
+			}
+		}
+		if err := add(ct); err != nil {
+			return result, err
+		}
+	}
+
+	for _, tweet := range tweets {
+		if _, ok := own[tweet.IdStr]; !ok {
+			continue
+		}
+		ct, err := a.importTweet(ar, owner, tweet, result)
+		if err != nil {
+			return result, err
+		}
+		if err := add(ct); err != nil {
+			return result, err
+		}
+	}
+
+	log.Success("%d tweets and %d media files imported from %s, %d tweets skipped", result.Imported, result.Media, filename, result.Skipped)
+
+	return result, nil
+}
+
+// importTweet creates a cached tweet out of a tweet posted by the archive owner and copies all bundled media files
+func (a *Application) importTweet(ar *archive.Archive, owner scraper.UserResult, tweet *scraper.TweetResult, result *ImportResult) (*scraper.CachedTweet, error) {
+	ct := &scraper.CachedTweet{
+		User:  owner,
+		Tweet: *tweet,
+	}
+	ct.Tweet.UserIdStr = owner.RestId
+	ct.Tweet.FullText = escapeText(ct.Tweet.FullText)
+	// Media ids become file names of the media directory as well, media files with another id are dropped
+	ct.Tweet.Entities.Media = nil
+	for _, m := range tweet.Entities.Media {
+		if isNumericId(m.IdStr) {
+			ct.Tweet.Entities.Media = append(ct.Tweet.Entities.Media, m)
+		}
+	}
+	ct.Tweet.ExtendedEntities.Media = nil
+	for _, m := range tweet.ExtendedEntities.Media {
+		if isNumericId(m.IdStr) {
+			ct.Tweet.ExtendedEntities.Media = append(ct.Tweet.ExtendedEntities.Media, m)
+		}
+	}
+	if owner.RestId == "" {
+		ct.SetMissing(scraper.MissingUser)
+	}
+	// The archive doesn't contain reply and quote counts
+	ct.SetMissing(scraper.MissingCounts)
+
+	if a.store.Has(tweet.IdStr) {
+		return ct, nil
+	}
+
+	files := ar.TweetMedia(tweet.IdStr)
+	for _, m := range ct.Tweet.ExtendedEntities.Media {
+		n, err := a.importMedia(files, m.MediaUrlHttps, m.IdStr)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range m.VideoInfo.Variants {
+			c, err := a.importMedia(files, variant.Url, m.IdStr)
+			if err != nil {
+				return nil, err
+			}
+			n += c
+		}
+		if n == 0 {
+			ct.SetMissing(scraper.MissingMedia)
+		}
+		result.Media += n
+	}
+	return ct, nil
+}
+
+// importMedia copies a bundled media file into the media directory, using the same naming scheme as downloaded
+// media files: <id>.<ext>
+func (a *Application) importMedia(files map[string]*zip.File, mediaUrl, id string) (int, error) {
+	name := path.Base(strings.SplitN(mediaUrl, "?", 2)[0])
+	f, ok := files[name]
+	if !ok || mediaUrl == "" || !isNumericId(id) {
+		return 0, nil
+	}
+
+	ext := mediaExtension(name)
+	target := path.Join(a.DataDir, "media", id+"."+ext)
+	if _, err := os.Stat(target); err == nil {
+		return 0, nil
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	// The file is copied atomically, so a failed copy can't leave a truncated media file behind
+	if err := filesystem.CopyFileAtomic(target, src, 0644); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// importEndpoint imports an uploaded archive, sent as multipart form field "archive"
+func (a *Application) importEndpoint(resp *response.JsonResponse) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	req := resp.Request()
+	file, _, err := req.FormFile("archive")
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusBadRequest))
+		return
+	}
+	defer file.Close()
+
+	// Zip files can't be read from a stream, so the upload is buffered in a temporary file
+	tmp, err := ioutil.TempFile("", "tbm-archive-*.zip")
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusInternalServerError))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	_ = tmp.Close()
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusInternalServerError))
+		return
+	}
+
+	result, err := a.Import(tmp.Name())
+	if err == archive.ErrNoArchive || err == zip.ErrFormat {
+		resp.AddError(response.NewError(err, http.StatusBadRequest))
+		return
+	} else if err != nil {
+		resp.AddError(response.NewError(err, http.StatusInternalServerError))
+		return
+	}
+	resp.SetData(map[string]interface{}{
+		"Imported": result.Imported,
+		"Skipped":  result.Skipped,
+		"Media":    result.Media,
+	})
+}
+
+// isNumericId reports whether an id of the archive is a plain number, like all ids used by twitter
+func isNumericId(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeText html escapes a text of the archive the same way the api escapes tweet texts. Already escaped entities
+// are unescaped first, so they aren't escaped twice.
+func escapeText(text string) string {
+	return html.EscapeString(html.UnescapeString(text))
+}
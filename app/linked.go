@@ -0,0 +1,58 @@
+package app
+
+import (
+	"tbm/scraper"
+	"tbm/store"
+	"tbm/utils/log"
+)
+
+// saveLinked stores all quoted tweets and retweeted originals referenced by a tweet or its conversation and queues
+// their media files as part of the tweet
+func (a *Application) saveLinked(ct *scraper.CachedTweet, linked []*scraper.CachedTweet) {
+	ids := ct.LinkedIds()
+	for _, l := range linked {
+		if !containsString(ids, l.Tweet.IdStr) {
+			continue
+		}
+		l.Version = a.Build.Version
+		if err := a.store.PutLinked(l); err != nil {
+			log.Error("Failed to save linked tweet %s of %s: %s", l.Tweet.IdStr, ct.Tweet.IdStr, err.Error())
+			continue
+		}
+		a.queueMedia(ct.Tweet.IdStr, mediaFiles(l))
+	}
+}
+
+// linkedTweets loads all stored quoted tweets and retweeted originals referenced by a tweet or its conversation
+func (a *Application) linkedTweets(ct *scraper.CachedTweet) map[string]*scraper.CachedTweet {
+	linked := map[string]*scraper.CachedTweet{}
+	for _, id := range ct.LinkedIds() {
+		l, err := a.store.GetLinked(id)
+		if err == nil {
+			linked[id] = l
+		} else if err != store.ErrNotFound {
+			log.Error("Failed to load linked tweet %s of %s: %s", id, ct.Tweet.IdStr, err.Error())
+		}
+	}
+	return linked
+}
+
+// thread returns the conversation of a tweet including all embedded quoted tweets and retweeted originals as well as
+// the snapshots of all linked web pages
+func (a *Application) thread(ct *scraper.CachedTweet) map[string]*scraper.ThreadItem {
+	thread := ct.Thread()
+	scraper.EmbedLinked(thread, a.linkedTweets(ct))
+	for _, item := range thread {
+		item.Snapshots = a.snapshots(&item.Tweet)
+	}
+	return thread
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"tbm/downloader"
+	"tbm/scraper"
+	"tbm/server/response"
+)
+
+// mediaFile is a file expected within the media directory, named "<id>.<ext>"
+type mediaFile struct {
+	Url    string `json:"url"`
+	Target string `json:"target"`
+}
+
+// MediaGroup holds all unfinished downloads belonging to a single tweet
+type MediaGroup struct {
+	TweetId string           `json:"tweet_id"`
+	Jobs    []downloader.Job `json:"jobs"`
+}
+
+// mediaExtensionPattern matches the extensions used within the names of media files
+var mediaExtensionPattern = regexp.MustCompile(`^[a-z0-9]{1,5}$`)
+
+// mediaExtension returns the file extension of a media url, or "blob" if it has none or the extension could be used
+// to escape the media directory
+func mediaExtension(src string) string {
+	if ext, err := GetFileExtensionFromUrl(src); err == nil && mediaExtensionPattern.MatchString(ext) {
+		return ext
+	}
+	return "blob"
+}
+
+// mediaFiles lists the avatar of the author and all media files and card thumbnails of a given tweet and its
+// conversation. Videos consist of a preview image and the variant with the highest bitrate.
+func mediaFiles(ct *scraper.CachedTweet) []mediaFile {
+	files := make([]mediaFile, 0)
+	add := func(src, id string) {
+		if src == "" || id == "" {
+			return
+		}
+		files = append(files, mediaFile{Url: src, Target: id + "." + mediaExtension(src)})
+	}
+
+	add(ct.User.Legacy.ProfileImageUrlHttps, ct.User.RestId)
+
+	for _, tweet := range ct.Conversation.GlobalObjects.Tweets {
+		for _, ctm := range tweet.ExtendedEntities.Media {
+			add(ctm.MediaUrlHttps, ctm.IdStr)
+
+			if ctm.Type == "video" {
+				maxBitrate := 0
+				videoUrl := ""
+				for _, variant := range ctm.VideoInfo.Variants {
+					if variant.Bitrate > maxBitrate {
+						videoUrl = strings.TrimSuffix(variant.Url, "?tag=10")
+						maxBitrate = variant.Bitrate
+					}
+				}
+
+				add(videoUrl, ctm.IdStr)
+			}
+		}
+		if tweet.Card != nil {
+			if thumbnail := tweet.Card.Thumbnail(); thumbnail != nil && thumbnail.Id() != "" {
+				files = append(files, mediaFile{Url: thumbnail.Url, Target: thumbnail.Id() + "." + thumbnail.Extension()})
+			}
+		}
+	}
+	return files
+}
+
+// unfinishedMedia groups all pending, active and failed downloads by their tweet
+func (a *Application) unfinishedMedia() []MediaGroup {
+	groups := make([]MediaGroup, 0)
+	for _, job := range a.Media.Jobs(downloader.StatusPending, downloader.StatusActive, downloader.StatusFailed) {
+		if len(groups) == 0 || groups[len(groups)-1].TweetId != job.TweetId {
+			groups = append(groups, MediaGroup{TweetId: job.TweetId})
+		}
+		groups[len(groups)-1].Jobs = append(groups[len(groups)-1].Jobs, job)
+	}
+	return groups
+}
+
+func (a *Application) mediaEndpoint(resp *response.JsonResponse) {
+	resp.SetData(map[string]interface{}{
+		"Counts": a.Media.Counts(),
+		"Tweets": a.unfinishedMedia(),
+	})
+}
+
+// retryMediaEndpoint retries a single failed download given by "target" or all failed downloads
+func (a *Application) retryMediaEndpoint(resp *response.JsonResponse) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	req := resp.Request()
+	if err := req.ParseForm(); err != nil {
+		resp.AddError(response.NewError(err, http.StatusBadRequest))
+		return
+	}
+	count, err := a.Media.Retry(req.Form.Get("target"))
+	if err == downloader.ErrUnknownJob {
+		resp.AddError(response.NewError(err, http.StatusNotFound))
+		return
+	} else if err != nil {
+		resp.AddError(response.NewError(err, http.StatusInternalServerError))
+		return
+	}
+	resp.SetData(map[string]interface{}{
+		"Retried": count,
+	})
+}
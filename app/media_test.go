@@ -0,0 +1,22 @@
+package app
+
+import "testing"
+
+func TestMediaExtension(t *testing.T) {
+	tests := map[string]string{
+		"https://pbs.twimg.com/media/abc.jpg":            "jpg",
+		"https://pbs.twimg.com/media/abc.jpg?name=large": "jpg",
+		"https://video.twimg.com/vid/1/720x1280/abc.mp4": "mp4",
+		"https://pbs.twimg.com/media/abc":                "blob",
+		"https://pbs.twimg.com/media/a.b/../../../x":     "blob",
+		"https://pbs.twimg.com/media/abc.verylongext":    "blob",
+		"https://pbs.twimg.com/media/abc.JPG":            "blob",
+		"abc.png":                                        "png",
+		"":                                               "blob",
+	}
+	for src, want := range tests {
+		if got := mediaExtension(src); got != want {
+			t.Errorf("mediaExtension(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+	"html/template"
+	"net/http"
+	"strings"
+	"tbm/scraper"
+	"tbm/server/response"
+	"tbm/store"
+)
+
+var notePolicy = bluemonday.UGCPolicy().
+	RequireNoReferrerOnLinks(true).
+	AddTargetBlankToFullyQualifiedLinks(true)
+
+// renderMarkdown converts a markdown note into sanitized html
+func (a *Application) renderMarkdown(str string) template.HTML {
+	unsafe := blackfriday.Run([]byte(str), blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.HardLineBreak))
+	return template.HTML(notePolicy.SanitizeBytes(unsafe))
+}
+
+type notePayload struct {
+	TweetId   string `json:"tweet_id"`
+	Highlight string `json:"highlight"`
+	Text      string `json:"text"`
+}
+
+// readNotePayload reads a note either from a json body or from form values
+func readNotePayload(req *http.Request) (*notePayload, *response.Error) {
+	p := &notePayload{}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(p); err != nil {
+			return nil, response.NewError(err, http.StatusBadRequest)
+		}
+	} else {
+		if err := req.ParseForm(); err != nil {
+			return nil, response.NewError(err, http.StatusBadRequest)
+		}
+		p.TweetId = req.Form.Get("tweet_id")
+		p.Highlight = req.Form.Get("highlight")
+		p.Text = req.Form.Get("text")
+	}
+	if strings.TrimSpace(p.Text) == "" && strings.TrimSpace(p.Highlight) == "" {
+		return nil, response.NewErrorFromString("a note requires a text or a highlight", http.StatusBadRequest)
+	}
+	return p, nil
+}
+
+var (
+	errNoteNotFound = errors.New("note not found")
+	errNotInThread  = errors.New("tweet is not part of the thread")
+)
+
+func (a *Application) updateTweetNotes(resp *response.JsonResponse, fn func(ct *scraper.CachedTweet) (*scraper.Note, error)) {
+	var note *scraper.Note
+	_, err := a.UpdateTweet(resp.Parameter().ByName("id"), func(ct *scraper.CachedTweet) (err error) {
+		note, err = fn(ct)
+		return err
+	})
+	if err == store.ErrNotFound || err == errNoteNotFound {
+		resp.AddError(response.NewErrorFromStatus(http.StatusNotFound))
+		return
+	} else if err == errNotInThread {
+		resp.AddError(response.NewError(err, http.StatusBadRequest))
+		return
+	} else if err != nil {
+		resp.AddError(response.NewError(err))
+		return
+	}
+
+	resp.SetData(map[string]interface{}{
+		"Note": note,
+	})
+}
+
+func (a *Application) addNoteEndpoint(resp *response.JsonResponse) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	p, rErr := readNotePayload(resp.Request())
+	if rErr != nil {
+		resp.AddError(rErr)
+		return
+	}
+	a.updateTweetNotes(resp, func(ct *scraper.CachedTweet) (*scraper.Note, error) {
+		if p.TweetId == "" {
+			p.TweetId = ct.Tweet.IdStr
+		}
+		if ct.HasThreadTweet(p.TweetId) == false {
+			return nil, errNotInThread
+		}
+		return ct.AddNote(p.TweetId, p.Highlight, p.Text), nil
+	})
+}
+
+func (a *Application) updateNoteEndpoint(resp *response.JsonResponse) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	p, rErr := readNotePayload(resp.Request())
+	if rErr != nil {
+		resp.AddError(rErr)
+		return
+	}
+	a.updateTweetNotes(resp, func(ct *scraper.CachedTweet) (*scraper.Note, error) {
+		if note := ct.UpdateNote(resp.Parameter().ByName("note"), p.Highlight, p.Text); note != nil {
+			return note, nil
+		}
+		return nil, errNoteNotFound
+	})
+}
+
+func (a *Application) removeNoteEndpoint(resp *response.JsonResponse) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	a.updateTweetNotes(resp, func(ct *scraper.CachedTweet) (*scraper.Note, error) {
+		if ct.RemoveNote(resp.Parameter().ByName("note")) {
+			return nil, nil
+		}
+		return nil, errNoteNotFound
+	})
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
 	"strconv"
 )
@@ -15,6 +16,7 @@ type Paginator struct {
 	TotalPages int
 	Offset     int
 	data       []interface{}
+	paged      bool
 }
 
 type PaginatorLinks struct {
@@ -54,6 +56,15 @@ func (p *Paginator) SetData(data []interface{}) {
 	p.data = data
 }
 
+// SetPageData sets the already sliced items of the current page out of a total number of items
+func (p *Paginator) SetPageData(data []interface{}, total int) {
+	p.Offset = p.Limit * p.Page
+	p.Total = total
+	p.TotalPages = p.Total / p.Limit
+	p.data = data
+	p.paged = true
+}
+
 func (p *Paginator) Sort(less func(i, j interface{}) bool) {
 	sort.Slice(p.data, func(i, j int) bool {
 		return less(p.data[i], p.data[j])
@@ -64,6 +75,9 @@ func (p *Paginator) Data() []interface{} {
 	if p.TotalPages < p.Page || p.Total <= p.Offset {
 		return []interface{}{}
 	}
+	if p.paged {
+		return p.data
+	}
 	data := p.data[p.Offset:]
 	if len(data) > p.Limit {
 		data = data[0:p.Limit]
@@ -78,16 +92,22 @@ func (p *Paginator) GetParameter(name string) string {
 	return ""
 }
 
-func (p *Paginator) Links(numberOfLinks int) []*PaginatorLinks {
-	links := make([]*PaginatorLinks, 0)
+// Query returns all parameters as url encoded query string
+func (p *Paginator) Query() string {
 	parameters := ""
 	for k, s := range p.Parameters {
 		if parameters == "" {
-			parameters = k + "=" + s
+			parameters = url.QueryEscape(k) + "=" + url.QueryEscape(s)
 		} else {
-			parameters += "&" + k + "=" + s
+			parameters += "&" + url.QueryEscape(k) + "=" + url.QueryEscape(s)
 		}
 	}
+	return parameters
+}
+
+func (p *Paginator) Links(numberOfLinks int) []*PaginatorLinks {
+	links := make([]*PaginatorLinks, 0)
+	parameters := p.Query()
 
 	/**
 	 * Set the first button / backwards 1
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"tbm/downloader"
+	"tbm/scraper"
+	"time"
+)
+
+// Topic of the sync progress events published to subscribed websocket clients
+const TopicSync = "sync"
+
+// Events published on TopicSync next to the progress events of the scraper
+const (
+	EventEntryNew        = "entry.new"
+	EventMediaQueued     = "media.queued"
+	EventMediaDownloaded = "media.downloaded"
+	EventMediaFailed     = "media.failed"
+)
+
+// SyncProgress is the state of the current or last sync of an account
+type SyncProgress struct {
+	Account string `json:"account"`
+	scraper.Progress
+	// New counts the tweets stored by the run, MediaQueued the files queued for them
+	New         int `json:"new"`
+	MediaQueued int `json:"media_queued"`
+}
+
+// onProgress records a progress event of the scraper of an account and publishes it
+func (a *Application) onProgress(account string, p scraper.Progress) {
+	a.pmx.Lock()
+	sp, ok := a.progress[account]
+	if !ok || p.Event == scraper.ProgressRunStarted {
+		sp = &SyncProgress{Account: account}
+		a.progress[account] = sp
+	}
+	sp.Progress = p
+	progress := *sp
+	a.pmx.Unlock()
+
+	a.publish(TopicSync, p.Event, map[string]interface{}{
+		"progress": progress,
+	})
+}
+
+// onSynced records a new tweet stored by the current run of an account together with its queued media files
+func (a *Application) onSynced(account, tweetId string, queued int) {
+	a.pmx.Lock()
+	sp, ok := a.progress[account]
+	if !ok {
+		sp = &SyncProgress{Account: account}
+		a.progress[account] = sp
+	}
+	sp.New++
+	sp.MediaQueued += queued
+	sp.Event = EventEntryNew
+	sp.Time = time.Now()
+	progress := *sp
+	a.pmx.Unlock()
+
+	a.publish(TopicSync, EventEntryNew, map[string]interface{}{
+		"progress": progress,
+		"tweet_id": tweetId,
+	})
+	if queued > 0 {
+		a.publish(TopicSync, EventMediaQueued, map[string]interface{}{
+			"progress": progress,
+			"tweet_id": tweetId,
+			"queued":   queued,
+			"media":    a.Media.Counts(),
+		})
+	}
+}
+
+// onDownloaded publishes the outcome of a media download. Failed downloads are retried unless their status is
+// "failed".
+func (a *Application) onDownloaded(job downloader.Job) {
+	event := EventMediaDownloaded
+	if job.Status != downloader.StatusDone {
+		event = EventMediaFailed
+	}
+	a.publish(TopicSync, event, map[string]interface{}{
+		"job":   job,
+		"media": a.Media.Counts(),
+	})
+}
+
+// syncProgress returns the progress of every account in the configured order
+func (a *Application) syncProgress() []SyncProgress {
+	a.pmx.Lock()
+	defer a.pmx.Unlock()
+
+	progress := make([]SyncProgress, 0, len(a.accounts))
+	for _, ac := range a.accounts {
+		if sp, ok := a.progress[ac.Name]; ok {
+			progress = append(progress, *sp)
+		} else {
+			progress = append(progress, SyncProgress{Account: ac.Name})
+		}
+	}
+	return progress
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"encoding/json"
+	"tbm/scraper"
+	"tbm/store"
+	"tbm/utils/log"
+	"time"
+)
+
+type ReparseResult struct {
+	Tweets   int `json:"tweets"`
+	Reparsed int `json:"reparsed"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// saveRaw stores the raw payloads a tweet has been built from. A previously stored bookmark payload is kept if none
+// is given, e.g. if an imported tweet gets enriched.
+func (a *Application) saveRaw(id string, bookmark json.RawMessage, conversation *scraper.ConversationResponse) {
+	raw := &scraper.RawTweet{
+		Id:        id,
+		Bookmark:  bookmark,
+		Details:   conversation.Pages,
+		FetchedAt: time.Now(),
+	}
+	if len(raw.Bookmark) == 0 {
+		if stored, err := a.store.GetRaw(id); err == nil {
+			raw.Bookmark = stored.Bookmark
+		}
+	}
+	if err := a.store.PutRaw(raw); err != nil {
+		log.Error("Failed to save raw payloads of tweet %s: %s", id, err.Error())
+	}
+}
+
+// Reparse rebuilds the user, tweet, conversation and linked tweets of every stored tweet from its raw payloads. Tags,
+// collections and notes are kept; tweets without raw payloads, such as pending imports, are skipped.
+func (a *Application) Reparse() (*ReparseResult, error) {
+	result := &ReparseResult{}
+	ids := make([]string, 0)
+	a.EachTweet(func(ct *scraper.CachedTweet) bool {
+		ids = append(ids, ct.Tweet.IdStr)
+		return true
+	})
+	result.Tweets = len(ids)
+
+	for _, id := range ids {
+		raw, err := a.store.GetRaw(id)
+		if err == store.ErrNotFound {
+			result.Skipped++
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		parsed, err := raw.Parse()
+		if err != nil {
+			log.Warning("Failed to reparse tweet %s: %s", id, err.Error())
+			result.Failed++
+			continue
+		}
+
+		a.saveLinked(parsed, parsed.Linked)
+
+		_, err = a.UpdateTweet(id, func(ct *scraper.CachedTweet) error {
+			ct.User = parsed.User
+			ct.Tweet = parsed.Tweet
+			ct.Conversation = parsed.Conversation
+			ct.Version = a.Build.Version
+			ct.Incomplete = nil
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Reparsed++
+	}
+
+	log.Info("%d of %d tweets reparsed: %d skipped without raw payloads, %d failed",
+		result.Reparsed, result.Tweets, result.Skipped, result.Failed)
+	return result, nil
+}
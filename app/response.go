@@ -3,6 +3,12 @@ package app
 import "encoding/json"
 
 type Response struct {
+	// Id and Command echo the command a response answers
+	Id      string `json:"id,omitempty"`
+	Command string `json:"command,omitempty"`
+	// Topic and Event describe published events
+	Topic  string                 `json:"topic,omitempty"`
+	Event  string                 `json:"event,omitempty"`
 	Errors []string               `json:"errors"`
 	Data   map[string]interface{} `json:"data"`
 }
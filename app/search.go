@@ -0,0 +1,78 @@
+package app
+
+import (
+	"tbm/scraper"
+	"tbm/search"
+	"tbm/utils/log"
+	"time"
+)
+
+// tweetDocument builds the search document of a tweet including the text and authors of its quoted tweet and
+// retweeted original as well as the text of archived linked pages
+func (a *Application) tweetDocument(ct *scraper.CachedTweet) *search.Document {
+	doc := &search.Document{
+		Id: ct.Tweet.IdStr,
+		Fields: map[string][]string{
+			search.FieldText:       {ct.Tweet.Content()},
+			search.FieldFrom:       {ct.User.Legacy.ScreenName, ct.User.Legacy.Name},
+			search.FieldLang:       {ct.Tweet.Lang},
+			search.FieldTag:        ct.Tags,
+			search.FieldCollection: ct.Collections,
+		},
+	}
+	for _, u := range ct.Tweet.ContentUrls() {
+		doc.Fields[search.FieldUrl] = append(doc.Fields[search.FieldUrl], u.ExpandedUrl)
+	}
+	for _, hashtag := range ct.Tweet.ContentHashtags() {
+		doc.Fields[search.FieldHashtag] = append(doc.Fields[search.FieldHashtag], hashtag.Text)
+	}
+	if card := ct.Tweet.Card; card != nil {
+		doc.Fields[search.FieldText] = append(doc.Fields[search.FieldText], card.Title(), card.Description())
+		if poll := card.Poll(); poll != nil {
+			for _, option := range poll.Options {
+				doc.Fields[search.FieldText] = append(doc.Fields[search.FieldText], option.Label)
+			}
+		}
+	}
+	doc.Fields[search.FieldSnapshot] = a.snapshotTexts(ct)
+	for _, note := range ct.Notes {
+		doc.Fields[search.FieldNote] = append(doc.Fields[search.FieldNote], note.Highlight, note.Text)
+	}
+	for _, id := range []string{ct.Tweet.QuotedStatusIDStr, ct.Tweet.RetweetedStatusIDStr} {
+		if id == "" {
+			continue
+		}
+		if l, err := a.store.GetLinked(id); err == nil {
+			doc.Fields[search.FieldQuote] = append(doc.Fields[search.FieldQuote], l.Tweet.Content(), l.User.Legacy.ScreenName, l.User.Legacy.Name)
+			for _, u := range l.Tweet.ContentUrls() {
+				doc.Fields[search.FieldUrl] = append(doc.Fields[search.FieldUrl], u.ExpandedUrl)
+			}
+		}
+	}
+	return doc
+}
+
+func (a *Application) buildSearchIndex() {
+	start := time.Now()
+	a.EachTweet(func(ct *scraper.CachedTweet) bool {
+		a.index.Add(a.tweetDocument(ct))
+		return true
+	})
+	a.index.SetReady()
+	log.Info("Search index built with %d tweets in %s", a.index.Count(), time.Since(start).Round(time.Millisecond))
+}
+
+// SearchTweets returns all tweets matching the given query ordered by relevance
+func (a *Application) SearchTweets(query string) []*scraper.CachedTweet {
+	// The search index might still be built in the background
+	a.index.Wait()
+
+	results := a.index.Search(query)
+	tweets := make([]*scraper.CachedTweet, 0, len(results))
+	for _, result := range results {
+		if ct, ok := a.GetTweet(result.Id); ok {
+			tweets = append(tweets, ct)
+		}
+	}
+	return tweets
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"os"
+	"tbm/scraper"
+	"tbm/server/response"
+	"tbm/snapshot"
+	"tbm/utils/log"
+)
+
+// snapshotPolicy keeps archived pages from loading anything but images and from running any script
+const snapshotPolicy = "default-src 'none'; img-src http: https: data:; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// startArchiver starts the link archiver and queues all links of stored tweets, which haven't been archived yet
+func (a *Application) startArchiver() {
+	if !a.Archive.Enabled {
+		return
+	}
+	a.Archive.Start()
+	go func() {
+		queued := 0
+		a.EachTweet(func(ct *scraper.CachedTweet) bool {
+			queued += a.archiveLinks(ct)
+			return true
+		})
+		if queued > 0 {
+			log.Info("%d links queued for archiving", queued)
+		}
+	}()
+}
+
+// archiveLinks queues all urls linked by a tweet for archiving and returns the number of queued urls
+func (a *Application) archiveLinks(ct *scraper.CachedTweet) int {
+	queued := 0
+	for _, u := range ct.Tweet.ContentUrls() {
+		if a.Archive.Add(ct.Tweet.IdStr, u.ExpandedUrl) {
+			queued++
+		}
+	}
+	return queued
+}
+
+// onArchived updates the search index of all tweets linking a newly archived page
+func (a *Application) onArchived(_ *snapshot.Snapshot, tweetIds []string) {
+	for _, id := range tweetIds {
+		if ct, ok := a.GetTweet(id); ok {
+			a.index.Add(a.tweetDocument(ct))
+		}
+	}
+}
+
+// snapshots returns the successful snapshots of all urls linked by a tweet
+func (a *Application) snapshots(tweet *scraper.TweetResult) []*snapshot.Snapshot {
+	snapshots := make([]*snapshot.Snapshot, 0)
+	for _, u := range tweet.ContentUrls() {
+		if s, err := a.Archive.Get(u.ExpandedUrl); err == nil && s.Status == snapshot.StatusDone {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+// snapshotTexts returns the readable text of all archived pages linked by a tweet
+func (a *Application) snapshotTexts(ct *scraper.CachedTweet) []string {
+	texts := make([]string, 0)
+	for _, u := range ct.Tweet.ContentUrls() {
+		if text, err := a.Archive.Text(u.ExpandedUrl); err == nil {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// snapshotEndpoint serves the sanitized html document of an archived page
+func (a *Application) snapshotEndpoint(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.Error {
+	s, err := a.Archive.GetById(ps.ByName("id"))
+	if err == snapshot.ErrNotFound || (err == nil && s.Status != snapshot.StatusDone) {
+		return response.NewErrorFromStatus(http.StatusNotFound)
+	} else if err != nil {
+		return response.NewError(err, http.StatusInternalServerError)
+	}
+	f, err := os.Open(a.Archive.HtmlFile(s.Id))
+	if err != nil {
+		return response.NewError(err, http.StatusInternalServerError)
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", snapshotPolicy)
+	http.ServeContent(w, r, "", s.FetchedAt, f)
+	return nil
+}
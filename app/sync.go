@@ -0,0 +1,97 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"tbm/scraper"
+	"tbm/server/response"
+)
+
+// DefaultRunLimit is the number of runs returned by the run history, unless a limit is given
+const DefaultRunLimit = 20
+
+// AccountRun is a finished run of an account
+type AccountRun struct {
+	Account string `json:"account"`
+	scraper.Run
+}
+
+// AccountState is the persisted sync state of an account
+type AccountState struct {
+	Account string `json:"account"`
+	scraper.State
+}
+
+// stateFilename returns the name of the sync state file of an account within the data directory
+func stateFilename(account string) string {
+	if account == DefaultAccount {
+		return scraper.StateFilename
+	}
+	ext := path.Ext(scraper.StateFilename)
+	return strings.TrimSuffix(scraper.StateFilename, ext) + "." + account + ext
+}
+
+// loadSyncState restores the cursor and run history of every account from the data directory
+func (a *Application) loadSyncState() error {
+	for _, ac := range a.accounts {
+		ac.Scraper.StateFile = path.Join(a.DataDir, stateFilename(ac.Name))
+		if err := ac.Scraper.LoadState(); err != nil {
+			return errors.New("failed to load the sync state of account \"" + ac.Name + "\": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// syncState returns the sync state of the given accounts without their run history
+func syncState(accounts []*Account) []AccountState {
+	state := make([]AccountState, 0, len(accounts))
+	for _, ac := range accounts {
+		s := ac.Scraper.State()
+		s.Runs = nil
+		state = append(state, AccountState{Account: ac.Name, State: s})
+	}
+	return state
+}
+
+// syncRuns returns the latest runs of the given accounts, newest first
+func syncRuns(accounts []*Account, limit int) []AccountRun {
+	runs := make([]AccountRun, 0)
+	for _, ac := range accounts {
+		for _, run := range ac.Scraper.State().Runs {
+			runs = append(runs, AccountRun{Account: ac.Name, Run: run})
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].FinishedAt.After(runs[j].FinishedAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs
+}
+
+// syncRunsEndpoint lists the run history of the account given by "account" or of all accounts. The number of runs
+// is limited by "limit".
+func (a *Application) syncRunsEndpoint(resp *response.JsonResponse) {
+	query := resp.Request().URL.Query()
+	accounts, err := a.selectAccounts(query.Get("account"))
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusNotFound))
+		return
+	}
+	limit := DefaultRunLimit
+	if raw := query.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			resp.AddError(response.NewError(errors.New("invalid limit \""+raw+"\""), http.StatusBadRequest))
+			return
+		}
+	}
+	resp.SetData(map[string]interface{}{
+		"State": syncState(accounts),
+		"Runs":  syncRuns(accounts, limit),
+	})
+}
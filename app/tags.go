@@ -0,0 +1,168 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"tbm/scraper"
+	"tbm/server/response"
+	"tbm/store"
+)
+
+type labelPayload struct {
+	Tag         string   `json:"tag"`
+	Tags        []string `json:"tags"`
+	Collection  string   `json:"collection"`
+	Collections []string `json:"collections"`
+}
+
+// readLabelPayload reads tags and collections either from a json body or from form values
+func readLabelPayload(req *http.Request) (*labelPayload, *response.Error) {
+	p := &labelPayload{}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(p); err != nil {
+			return nil, response.NewError(err, http.StatusBadRequest)
+		}
+	} else {
+		if err := req.ParseForm(); err != nil {
+			return nil, response.NewError(err, http.StatusBadRequest)
+		}
+		p.Tags = req.Form["tag"]
+		p.Collections = req.Form["collection"]
+	}
+	if p.Tag != "" {
+		p.Tags = append(p.Tags, p.Tag)
+	}
+	if p.Collection != "" {
+		p.Collections = append(p.Collections, p.Collection)
+	}
+	return p, nil
+}
+
+func (a *Application) updateTweetLabels(resp *response.JsonResponse, fn func(ct *scraper.CachedTweet, p *labelPayload)) {
+	if !a.sameOrigin(resp) {
+		return
+	}
+	p, rErr := readLabelPayload(resp.Request())
+	if rErr != nil {
+		resp.AddError(rErr)
+		return
+	}
+
+	ct, err := a.UpdateTweet(resp.Parameter().ByName("id"), func(ct *scraper.CachedTweet) error {
+		fn(ct, p)
+		return nil
+	})
+	if err == store.ErrNotFound {
+		resp.AddError(response.NewErrorFromStatus(http.StatusNotFound))
+		return
+	} else if err != nil {
+		resp.AddError(response.NewError(err))
+		return
+	}
+
+	resp.SetData(a.labelsChanged(ct))
+}
+
+// labelsChanged notifies all websocket clients about the changed labels of a tweet and returns them
+func (a *Application) labelsChanged(ct *scraper.CachedTweet) map[string]interface{} {
+	data := map[string]interface{}{
+		"Tags":        ct.Tags,
+		"Collections": ct.Collections,
+	}
+	a.publish(TopicTweets, EventTweetUpdated, map[string]interface{}{
+		"id":          ct.Tweet.IdStr,
+		"tags":        ct.Tags,
+		"collections": ct.Collections,
+	})
+	return data
+}
+
+func (p *labelPayload) add(ct *scraper.CachedTweet) {
+	for _, tag := range p.Tags {
+		ct.AddTag(tag)
+	}
+	for _, collection := range p.Collections {
+		ct.AddToCollection(collection)
+	}
+}
+
+func (p *labelPayload) remove(ct *scraper.CachedTweet) {
+	for _, tag := range p.Tags {
+		ct.RemoveTag(tag)
+	}
+	for _, collection := range p.Collections {
+		ct.RemoveFromCollection(collection)
+	}
+}
+
+func (a *Application) addLabelsEndpoint(resp *response.JsonResponse) {
+	a.updateTweetLabels(resp, func(ct *scraper.CachedTweet, p *labelPayload) {
+		p.add(ct)
+	})
+}
+
+func (a *Application) removeLabelsEndpoint(resp *response.JsonResponse) {
+	a.updateTweetLabels(resp, func(ct *scraper.CachedTweet, p *labelPayload) {
+		p.remove(ct)
+	})
+}
+
+func (a *Application) removeTagEndpoint(resp *response.JsonResponse) {
+	a.updateTweetLabels(resp, func(ct *scraper.CachedTweet, p *labelPayload) {
+		ct.RemoveTag(resp.Parameter().ByName("tag"))
+	})
+}
+
+func (a *Application) removeCollectionEndpoint(resp *response.JsonResponse) {
+	a.updateTweetLabels(resp, func(ct *scraper.CachedTweet, p *labelPayload) {
+		ct.RemoveFromCollection(resp.Parameter().ByName("collection"))
+	})
+}
+
+type LabelCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// labelCounts returns all tags and collections in use, including the number of tweets using them
+func (a *Application) labelCounts() ([]LabelCount, []LabelCount) {
+	tags := map[string]int{}
+	collections := map[string]int{}
+	a.EachTweet(func(ct *scraper.CachedTweet) bool {
+		for _, tag := range ct.Tags {
+			tags[tag]++
+		}
+		for _, collection := range ct.Collections {
+			collections[collection]++
+		}
+		return true
+	})
+	return sortLabelCounts(tags), sortLabelCounts(collections)
+}
+
+func sortLabelCounts(counts map[string]int) []LabelCount {
+	labels := make([]LabelCount, 0, len(counts))
+	for name, count := range counts {
+		labels = append(labels, LabelCount{Name: name, Count: count})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return strings.ToLower(labels[i].Name) < strings.ToLower(labels[j].Name)
+	})
+	return labels
+}
+
+func (a *Application) tagsEndpoint(resp *response.JsonResponse) {
+	tags, _ := a.labelCounts()
+	resp.SetData(map[string]interface{}{
+		"Tags": tags,
+	})
+}
+
+func (a *Application) collectionsEndpoint(resp *response.JsonResponse) {
+	_, collections := a.labelCounts()
+	resp.SetData(map[string]interface{}{
+		"Collections": collections,
+	})
+}
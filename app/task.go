@@ -1,6 +1,57 @@
 package app
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
 type Task struct {
+	Id      string                 `json:"id"`
 	Command string                 `json:"command"`
 	Payload map[string]interface{} `json:"payload"`
 }
+
+// String returns a payload value as string
+func (t *Task) String(key string) string {
+	return payloadString(t.Payload[key])
+}
+
+// Values converts the payload into query values, so commands can share the parameters of the http api
+func (t *Task) Values() url.Values {
+	values := url.Values{}
+	for key, v := range t.Payload {
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				values.Add(key, payloadString(item))
+			}
+		} else {
+			values.Set(key, payloadString(v))
+		}
+	}
+	return values
+}
+
+// Decode unmarshals the payload into v
+func (t *Task) Decode(v interface{}) error {
+	b, err := json.Marshal(t.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func payloadString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,256 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"tbm/downloader"
+	"tbm/scraper"
+	"tbm/server/response"
+	"tbm/utils/log"
+)
+
+const (
+	ProblemMissing = "missing"
+	ProblemEmpty   = "empty"
+	ProblemCorrupt = "corrupt"
+	ProblemPending = "pending"
+)
+
+// MediaIssue describes a missing or broken media file
+type MediaIssue struct {
+	TweetId string `json:"tweet_id"`
+	Target  string `json:"target"`
+	Url     string `json:"url"`
+	Problem string `json:"problem"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type VerifyResult struct {
+	Tweets   int          `json:"tweets"`
+	Files    int          `json:"files"`
+	Missing  int          `json:"missing"`
+	Empty    int          `json:"empty"`
+	Corrupt  int          `json:"corrupt"`
+	Pending  int          `json:"pending"`
+	Requeued int          `json:"requeued"`
+	Issues   []MediaIssue `json:"issues"`
+}
+
+// VerifyMedia checks the avatar and media files of every stored tweet. Missing, empty and undecodable files are
+// reported and queued for another download if repair is enabled.
+func (a *Application) VerifyMedia(repair bool) (*VerifyResult, error) {
+	result := &VerifyResult{
+		Issues: make([]MediaIssue, 0),
+	}
+	seen := map[string]bool{}
+	requeue := make([]downloader.Job, 0)
+
+	a.EachTweet(func(ct *scraper.CachedTweet) bool {
+		result.Tweets++
+		for _, mf := range mediaFiles(ct) {
+			// Avatars are shared by all tweets of an author
+			if seen[mf.Target] {
+				continue
+			}
+			seen[mf.Target] = true
+			result.Files++
+
+			issue := a.verifyMediaFile(mf)
+			if issue == nil {
+				continue
+			}
+			issue.TweetId = ct.Tweet.IdStr
+			result.Issues = append(result.Issues, *issue)
+
+			switch issue.Problem {
+			case ProblemPending:
+				result.Pending++
+				continue
+			case ProblemMissing:
+				result.Missing++
+			case ProblemEmpty:
+				result.Empty++
+			case ProblemCorrupt:
+				result.Corrupt++
+			}
+
+			if repair {
+				requeue = append(requeue, downloader.Job{TweetId: ct.Tweet.IdStr, Url: mf.Url, Target: mf.Target})
+			}
+		}
+		return true
+	})
+	if len(requeue) > 0 {
+		// Broken files are queued at once, so the download queue is saved a single time
+		result.Requeued = a.Media.RequeueAll(requeue)
+		if err := a.Media.Flush(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (a *Application) verifyMediaFile(mf mediaFile) *MediaIssue {
+	issue := &MediaIssue{
+		Target: mf.Target,
+		Url:    mf.Url,
+	}
+	if job, ok := a.Media.Get(mf.Target); ok && (job.Status == downloader.StatusPending || job.Status == downloader.StatusActive) {
+		issue.Problem = ProblemPending
+		return issue
+	}
+
+	fi, err := os.Stat(path.Join(a.Media.Dir, mf.Target))
+	if err != nil {
+		issue.Problem = ProblemMissing
+		return issue
+	}
+	if fi.Size() == 0 {
+		issue.Problem = ProblemEmpty
+		return issue
+	}
+
+	if err := a.Media.Check(mf.Target); err != nil && err != downloader.ErrUnknownJob {
+		issue.Problem = ProblemCorrupt
+		issue.Reason = err.Error()
+		return issue
+	}
+	if err := decodeMediaFile(path.Join(a.Media.Dir, mf.Target)); err != nil {
+		issue.Problem = ProblemCorrupt
+		issue.Reason = err.Error()
+		return issue
+	}
+	return nil
+}
+
+// decodeMediaFile makes sure an image can be decoded completely and a video contains all of its top level boxes.
+// Unknown file types are accepted as is.
+func decodeMediaFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		_, _, err = image.Decode(f)
+		return err
+	case ".webp":
+		header := make([]byte, 12)
+		if _, err = io.ReadFull(f, header); err != nil {
+			return err
+		}
+		if !bytes.Equal(header[0:4], []byte("RIFF")) || !bytes.Equal(header[8:12], []byte("WEBP")) {
+			return errors.New("invalid webp header")
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if int64(binary.LittleEndian.Uint32(header[4:8]))+8 > fi.Size() {
+			return errors.New("truncated webp file")
+		}
+	case ".mp4", ".m4v", ".mov":
+		return verifyMp4(f)
+	}
+	return nil
+}
+
+// verifyMp4 walks all top level boxes of an mp4 file, which have to fill the file exactly and include the "moov" box
+func verifyMp4(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	var offset int64
+	hasMovie := false
+	header := make([]byte, 16)
+	for offset < size {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return errors.New("truncated mp4 box header")
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the file
+			boxSize = size - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return errors.New("truncated mp4 box header")
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if offset == 0 && boxType != "ftyp" {
+			return errors.New("invalid mp4 header")
+		}
+		if boxSize < 8 || offset+boxSize > size {
+			return errors.New("truncated mp4 box \"" + boxType + "\"")
+		}
+		if boxType == "moov" {
+			hasMovie = true
+		}
+		offset += boxSize
+	}
+	if !hasMovie {
+		return errors.New("mp4 file without movie box")
+	}
+	return nil
+}
+
+// Verify checks all media files, logs every issue and queues broken files for another download if repair is enabled
+func (a *Application) Verify(repair bool) error {
+	result, err := a.VerifyMedia(repair)
+	if err != nil {
+		return err
+	}
+	for _, issue := range result.Issues {
+		if issue.Reason != "" {
+			log.Warning("%s: %s %s (%s)", issue.TweetId, issue.Target, issue.Problem, issue.Reason)
+		} else {
+			log.Warning("%s: %s %s", issue.TweetId, issue.Target, issue.Problem)
+		}
+	}
+	logVerifyResult(result)
+	if result.Requeued > 0 {
+		log.Info("Requeued downloads start as soon as TBM runs in online mode")
+	}
+	return nil
+}
+
+func logVerifyResult(result *VerifyResult) {
+	log.Info("%d media files of %d tweets verified: %d missing, %d empty, %d corrupt, %d pending, %d requeued",
+		result.Files, result.Tweets, result.Missing, result.Empty, result.Corrupt, result.Pending, result.Requeued)
+}
+
+// verifyEndpoint reports all broken media files, which are queued for another download on POST requests
+func (a *Application) verifyEndpoint(resp *response.JsonResponse) {
+	repair := resp.Request().Method == http.MethodPost
+	if repair && !a.sameOrigin(resp) {
+		return
+	}
+	result, err := a.VerifyMedia(repair)
+	if err != nil {
+		resp.AddError(response.NewError(err, http.StatusInternalServerError))
+		return
+	}
+	logVerifyResult(result)
+
+	resp.SetData(map[string]interface{}{
+		"Result": result,
+	})
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// mp4Box encodes a box with a 32 bit size, or a 64 bit size if large is set
+func mp4Box(boxType string, payload int, large bool) []byte {
+	if large {
+		b := make([]byte, 16+payload)
+		binary.BigEndian.PutUint32(b[0:4], 1)
+		copy(b[4:8], boxType)
+		binary.BigEndian.PutUint64(b[8:16], uint64(len(b)))
+		return b
+	}
+	b := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)))
+	copy(b[4:8], boxType)
+	return b
+}
+
+// mp4Boxes concatenates encoded boxes into a file
+func mp4Boxes(parts ...[]byte) []byte {
+	b := make([]byte, 0)
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func TestVerifyMp4(t *testing.T) {
+	valid := mp4Boxes(mp4Box("ftyp", 12, false), mp4Box("moov", 32, false), mp4Box("mdat", 64, false))
+	toEnd := mp4Box("mdat", 64, false)
+	binary.BigEndian.PutUint32(toEnd[0:4], 0)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"large box", mp4Boxes(mp4Box("ftyp", 12, false), mp4Box("moov", 32, false), mp4Box("mdat", 64, true)), ""},
+		{"box extending to the end", mp4Boxes(mp4Box("ftyp", 12, false), mp4Box("moov", 32, false), toEnd), ""},
+		{"truncated box", valid[:len(valid)-10], "truncated mp4 box \"mdat\""},
+		{"truncated header", append(append([]byte{}, valid...), 0, 0, 0), "truncated mp4 box header"},
+		{"missing ftyp", mp4Boxes(mp4Box("moov", 32, false), mp4Box("mdat", 64, false)), "invalid mp4 header"},
+		{"missing movie", mp4Boxes(mp4Box("ftyp", 12, false), mp4Box("mdat", 64, false)), "without movie box"},
+		{"invalid box size", mp4Boxes(mp4Box("ftyp", 12, false), []byte{0, 0, 0, 4, 'm', 'o', 'o', 'v'}), "truncated mp4 box \"moov\""},
+		{"html error page", []byte("<html><body>Not Found</body></html>"), "invalid mp4 header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := path.Join(t.TempDir(), "1.mp4")
+			if err := os.WriteFile(filename, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			err = verifyMp4(f)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
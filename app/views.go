@@ -1,15 +1,17 @@
 package app
 
 import (
-	"fmt"
+	"errors"
 	"github.com/microcosm-cc/bluemonday"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"tbm/scraper"
 	"tbm/server/response"
+	"tbm/store"
 	"tbm/utils/log"
-	"time"
 )
 
 func (a *Application) tweetsView(resp *response.ViewResponse) {
@@ -23,19 +25,16 @@ func (a *Application) tweetsView(resp *response.ViewResponse) {
 		"State":     a.GetState(),
 		"Title":     "TBM - Bookmarks",
 		"Paginator": paginator,
+		"Accounts":  a.AccountNames(),
 	})
 }
 
 func (a *Application) tweetView(resp *response.ViewResponse) {
-	tweets := a.GetTweets()
-	if cache, ok := tweets[resp.Parameter().ByName("id")]; ok {
-		resp.SetData(map[string]interface{}{
-			"State":  a.GetState(),
-			"Title":  truncateTitle(bluemonday.StripTagsPolicy().Sanitize(cache.Tweet.FullText)),
-			"Thread": cache.Thread(),
-			"Tweet":  cache.Tweet,
-			"User":   cache.User,
-		})
+	if cache, ok := a.GetTweet(resp.Parameter().ByName("id")); ok {
+		data := tweetViewData(cache, a.thread(cache))
+		data["State"] = a.GetState()
+		data["AllAccounts"] = a.AccountNames()
+		resp.SetData(data)
 		return
 	}
 	resp.AddError(response.NewErrorFromStatus(http.StatusNotFound))
@@ -43,157 +42,186 @@ func (a *Application) tweetView(resp *response.ViewResponse) {
 	return
 }
 
+func tweetViewData(cache *scraper.CachedTweet, thread map[string]*scraper.ThreadItem) map[string]interface{} {
+	return map[string]interface{}{
+		"Title":       truncateTitle(bluemonday.StripTagsPolicy().Sanitize(cache.Tweet.Content())),
+		"Thread":      thread,
+		"Tweet":       cache.Tweet,
+		"User":        cache.User,
+		"Tags":        cache.Tags,
+		"Collections": cache.Collections,
+		"Accounts":    cache.Accounts,
+	}
+}
+
 func (a *Application) configView(resp *response.ViewResponse) {
-	resp.SetData(map[string]interface{}{
-		"Title": "TBM - Config",
-		"Config": map[string]interface{}{
-			"ConfigFileName": a.ConfigFileName,
-			"DataDir":        a.DataDir,
-			"Mode":           a.Mode,
-			"Danger":         a.Danger,
-			"Host":           a.Server.Host,
-			"Port":           a.Server.Port,
-			"Delay":          a.Scraper.RawDelay,
-			"Timeout":        a.Scraper.RawTimeout,
-			"AccessToken":    a.Scraper.AccessToken,
-			"Cookie":         a.Scraper.Cookie,
-			"Index":          a.Scraper.Sections.Index,
-			"Remove":         a.Scraper.Sections.Remove,
-		},
-	})
+	resp.SetData(a.configData(a.currentConfig(), nil, nil))
 }
 
+// updateConfigView validates the submitted config, writes it into the config file and applies it
 func (a *Application) updateConfigView(resp *response.ViewResponse) {
-	resp.AddError(response.NewErrorFromString("Currently not supported", http.StatusNotImplemented))
-	return
+	// Forms of other pages could otherwise replace the cookie or point the scrapers to a foreign proxy
+	if !a.Server.SameOrigin(resp.Request()) {
+		resp.Writer().WriteHeader(http.StatusForbidden)
+		resp.SetData(a.configData(a.currentConfig(), []error{errForeignOrigin}, nil))
+		return
+	}
 
-	if err := resp.Request().ParseForm(); err != nil {
+	f, err := newConfigForm(resp.Request())
+	if err != nil {
 		resp.AddError(response.NewError(err, http.StatusBadRequest))
 		return
 	}
 
-	dataDir := resp.Request().FormValue("data_dir")
-	mode := resp.Request().FormValue("mode")
-	dangerRemoveBookmarks := resp.Request().FormValue("danger_remove_bookmarks")
-	host := resp.Request().FormValue("host")
-	port := resp.Request().FormValue("port")
-	delay := resp.Request().FormValue("delay")
-	timeout := resp.Request().FormValue("timeout")
-	accessToken := resp.Request().FormValue("access_token")
-	cookie := resp.Request().FormValue("cookie")
-	index := resp.Request().FormValue("index")
-	remove := resp.Request().FormValue("remove")
-
-	go func() {
-		log.Warning("Going to restart in 3 seconds...")
-		time.Sleep(time.Second * 3)
-		if err := a.Stop(); err != nil {
-			log.Warning("failed to stop: %s", err.Error())
-			return
-		}
+	a.cmx.Lock()
+	defer a.cmx.Unlock()
 
-		// Update all configs
-		//@TODO: Scraper doesn't stop correctly
-		a.DataDir = dataDir
-		a.Mode = ApplicationMode(mode)
-		a.Danger.RemoveBookmarks = dangerRemoveBookmarks != ""
-
-		a.Server.Host = host
-		_port, _ := strconv.Atoi(port)
-		a.Server.Port = uint(_port)
-
-		a.Scraper.Timeout, _ = time.ParseDuration(timeout)
-		a.Scraper.Delay, _ = time.ParseDuration(delay)
-		a.Scraper.Cookie = cookie
-		a.Scraper.AccessToken = accessToken
-		a.Scraper.Sections.Index = index
-		a.Scraper.Sections.Remove = remove
-
-		fmt.Println("data_dir", dataDir)
-		fmt.Println("mode", mode)
-		fmt.Println("danger_remove_bookmarks", dangerRemoveBookmarks)
-		fmt.Println("host", host)
-		fmt.Println("port", port)
-		fmt.Println("delay", delay)
-		fmt.Println("timeout", timeout)
-		fmt.Println("access_token", accessToken)
-		fmt.Println("cookie", cookie)
-		fmt.Println("index", index)
-		fmt.Println("remove", remove)
-
-		if err := a.Start(); err != nil {
-			log.Warning("failed to start: %s", err.Error())
-			return
-		}
-	}()
+	if errs := a.validateConfig(f); len(errs) > 0 {
+		resp.SetData(a.configData(f, errs, nil))
+		return
+	}
+	if err := a.writeConfig(f); err != nil {
+		resp.SetData(a.configData(f, []error{errors.New("failed to write the config file: " + err.Error())}, nil))
+		return
+	}
+	log.Info("Config saved to \"%s\"", a.ConfigFileName)
 
-	a.configView(resp)
+	notices := configNotices(f, a.currentConfig())
+	a.queueConfig(f)
+	resp.SetData(a.configData(f, nil, notices))
 }
 
 func (a *Application) statusView(resp *response.ViewResponse) {
-	newest := time.Time{}
-	oldest := time.Time{}
-	for _, ct := range a.GetTweets() {
-		createdAt := ct.CreatedAt()
-		if newest.IsZero() || newest.Before(createdAt) {
-			newest = createdAt
-		}
-		if oldest.IsZero() || oldest.After(createdAt) {
-			oldest = createdAt
-		}
-	}
+	newest, oldest := a.tweetRange()
 	resp.SetData(map[string]interface{}{
-		"Cursor":         a.Scraper.GetCursor(),
-		"TotalBookmarks": len(a.GetTweets()),
+		"Cursor":         a.primaryScraper().GetCursor(),
+		"TotalBookmarks": a.CountTweets(),
 		"Build":          a.Build,
 		"NewestTweet":    newest,
 		"OldestTweet":    oldest,
 		"State":          a.GetState(),
-		"Scraper":        a.Scraper.IsRunning(),
+		"Scraper":        a.scrapersRunning(),
+		"Incomplete":     a.enrich.Len(),
+		"Media":          a.Media.Counts(),
+		"RateLimits":     a.primaryScraper().RateLimits(),
+		"NextRequest":    a.primaryScraper().NextRequest(),
+		"NextRun":        a.primaryScraper().NextRun(),
+		"Paused":         a.scrapersPaused(),
+		"Drifts":         a.drifts(),
+		"Accounts":       a.accountStatus(),
+		"Progress":       a.syncProgress(),
+		"SyncState":      syncState(a.accounts),
+		"Runs":           syncRuns(a.accounts, DefaultRunLimit),
+		"MediaQueue":     a.unfinishedMedia(),
 		"Title":          "TBM - Status",
 	})
 }
 
+// tweetQuery holds the search, filter and sort options shared by the tweet list, the api and exports
+type tweetQuery struct {
+	Query  string
+	SortBy string
+	Order  string
+	Filter *TweetFilter
+}
+
+func newTweetQuery(values url.Values) (*tweetQuery, error) {
+	q := &tweetQuery{
+		Query:  values.Get("query"),
+		SortBy: values.Get("sort_by"),
+		Order:  values.Get("order"),
+	}
+	if strings.ToLower(q.Order) != "desc" {
+		q.Order = "asc"
+	}
+
+	filter, err := NewTweetFilter(values)
+	if err != nil {
+		return q, err
+	}
+	q.Filter = filter
+
+	return q, nil
+}
+
 func (a *Application) paginateTweets(req *http.Request) (*Paginator, *response.Error) {
-	limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
-	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	return a.paginate(req.URL.Query())
+}
 
-	sortBy := req.URL.Query().Get("sort_by")
-	order := req.URL.Query().Get("order")
-	query := req.URL.Query().Get("query")
+// paginate returns the requested page of all tweets matching the query and filter parameters
+func (a *Application) paginate(values url.Values) (*Paginator, *response.Error) {
+	limit, _ := strconv.Atoi(values.Get("limit"))
+	page, _ := strconv.Atoi(values.Get("page"))
 
-	tweets := make([]*scraper.CachedTweet, 0)
-	if query != "" {
-		tweets = a.SearchTweets(query)
-	} else {
-		for _, ct := range a.GetTweets() {
-			tweets = append(tweets, ct)
-		}
+	q, err := newTweetQuery(values)
+
+	paginator := NewPaginator(limit, page)
+	paginator.Parameters["sort_by"] = q.SortBy
+	paginator.Parameters["order"] = q.Order
+	paginator.Parameters["query"] = q.Query
+
+	if err != nil {
+		return paginator, response.NewError(err, http.StatusBadRequest)
+	}
+	for k, v := range q.Filter.Parameters() {
+		paginator.Parameters[k] = v
 	}
 
-	data := make([]interface{}, len(tweets))
-	for i, v := range tweets {
-		data[i] = v
+	if q.Query == "" && q.Filter.Empty() && isDateSort(q.SortBy) {
+		// Tweets are stored in chronological order, so there is no need to load all of them
+		storeOrder := store.Descending
+		if s := strings.ToLower(q.SortBy); (s == "created_at" || s == "createdat") && q.Order == "desc" {
+			storeOrder = store.Ascending
+		}
+		tweets, err := a.store.List(storeOrder, paginator.Limit*paginator.Page, paginator.Limit)
+		if err != nil {
+			return paginator, response.NewError(err)
+		}
+		paginator.SetPageData(tweetsToData(tweets), a.CountTweets())
+		if paginator.TotalPages < paginator.Page {
+			return paginator, response.NewErrorFromStatus(http.StatusNotFound)
+		}
+		return paginator, nil
 	}
 
-	paginator := NewPaginator(limit, page)
-	paginator.SetData(data)
-	paginator.Parameters["sort_by"] = sortBy
-	paginator.Parameters["order"] = order
-	paginator.Parameters["query"] = query
+	paginator.SetData(tweetsToData(a.findTweets(q)))
 
 	if paginator.TotalPages < paginator.Page {
 		return paginator, response.NewErrorFromStatus(http.StatusNotFound)
 	}
 
-	if strings.ToLower(order) != "desc" {
-		order = "asc"
+	return paginator, nil
+}
+
+// findTweets returns all tweets matching the given query in the requested order
+func (a *Application) findTweets(q *tweetQuery) []*scraper.CachedTweet {
+	tweets := make([]*scraper.CachedTweet, 0)
+	if q.Query != "" {
+		for _, ct := range a.SearchTweets(q.Query) {
+			if q.Filter.Match(ct) {
+				tweets = append(tweets, ct)
+			}
+		}
+	} else {
+		a.EachTweet(func(ct *scraper.CachedTweet) bool {
+			if q.Filter.Match(ct) {
+				tweets = append(tweets, ct)
+			}
+			return true
+		})
+	}
+
+	if q.Query != "" && (q.SortBy == "" || strings.ToLower(q.SortBy) == "relevance") {
+		// Search results are already ordered by relevance
+		return tweets
 	}
-	paginator.Sort(func(i, j interface{}) bool {
-		tweet1 := i.(*scraper.CachedTweet)
-		tweet2 := j.(*scraper.CachedTweet)
 
-		switch strings.ToLower(sortBy) {
+	sortBy, order := strings.ToLower(q.SortBy), q.Order
+	sort.Slice(tweets, func(i, j int) bool {
+		tweet1 := tweets[i]
+		tweet2 := tweets[j]
+
+		switch sortBy {
 		case "quote_count", "quotecount", "quote":
 			if order == "asc" {
 				return tweet1.Tweet.QuoteCount < tweet2.Tweet.QuoteCount
@@ -222,7 +250,25 @@ func (a *Application) paginateTweets(req *http.Request) (*Paginator, *response.E
 		return tweet1.CreatedAt().After(tweet2.CreatedAt())
 	})
 
-	return paginator, nil
+	return tweets
+}
+
+func isDateSort(sortBy string) bool {
+	switch strings.ToLower(sortBy) {
+	case "quote_count", "quotecount", "quote",
+		"reply_count", "replycount", "reply",
+		"retweet_count", "retweetcount", "retweet":
+		return false
+	}
+	return true
+}
+
+func tweetsToData(tweets []*scraper.CachedTweet) []interface{} {
+	data := make([]interface{}, len(tweets))
+	for i, v := range tweets {
+		data[i] = v
+	}
+	return data
 }
 
 func truncateTitle(title string, length ...int) string {
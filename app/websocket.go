@@ -0,0 +1,236 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"tbm/scraper"
+	"tbm/server"
+	"tbm/store"
+	"tbm/utils/log"
+)
+
+// Commands accepted by the websocket
+const (
+	CommandSearch      = "search"
+	CommandGet         = "get"
+	CommandList        = "list"
+	CommandSync        = "sync"
+	CommandCancel      = "cancel"
+	CommandTag         = "tag"
+	CommandUntag       = "untag"
+	CommandDelete      = "delete"
+	CommandSubscribe   = "subscribe"
+	CommandUnsubscribe = "unsubscribe"
+)
+
+// Topics of events published to subscribed websocket clients. Every client is subscribed to TopicTweets once connected.
+const (
+	TopicTweets = "tweets"
+)
+
+// Events published on TopicTweets
+const (
+	EventTweetNew     = "tweet.new"
+	EventTweetUpdated = "tweet.updated"
+	EventTweetDeleted = "tweet.deleted"
+)
+
+var (
+	errMissingId    = errors.New("missing tweet id")
+	errMissingQuery = errors.New("missing search query")
+)
+
+// topics lists all topics a client can subscribe to
+var topics = []string{TopicTweets, TopicSync}
+
+type commandHandler func(t *Task, c *server.WebsocketClient, r *Response) error
+
+// websocketCallback runs a command received by the websocket and answers with a response carrying the id of the
+// command, so clients can match responses to their requests
+func (a *Application) websocketCallback(m *server.Message) {
+	t := &Task{}
+	r := NewResponse()
+	if err := json.Unmarshal(m.Content, t); err != nil {
+		r.SetErrorStr("failed to decode message")
+	} else {
+		r.Id = t.Id
+		r.Command = t.Command
+		if handler, ok := a.commands()[t.Command]; !ok {
+			r.SetErrorStr("unknown command")
+		} else if err := handler(t, m.Client, r); err != nil {
+			r.SetError(err)
+		}
+	}
+
+	if b, err := r.Encode(); err == nil {
+		m.Client.Send(b)
+	} else {
+		log.Error("failed to encode response: %s", err.Error())
+	}
+}
+
+func (a *Application) commands() map[string]commandHandler {
+	return map[string]commandHandler{
+		CommandSearch:      a.searchCommand,
+		CommandGet:         a.getCommand,
+		CommandList:        a.listCommand,
+		CommandSync:        a.syncCommand,
+		CommandCancel:      a.cancelCommand,
+		CommandTag:         a.tagCommand,
+		CommandUntag:       a.untagCommand,
+		CommandDelete:      a.deleteCommand,
+		CommandSubscribe:   a.subscribeCommand,
+		CommandUnsubscribe: a.unsubscribeCommand,
+	}
+}
+
+// publish sends an event to all websocket clients subscribed to its topic
+func (a *Application) publish(topic, event string, data map[string]interface{}) {
+	r := NewResponse()
+	r.Topic = topic
+	r.Event = event
+	r.Data = data
+
+	if b, err := r.Encode(); err == nil {
+		a.Server.Hub().Publish(topic, b)
+	} else {
+		log.Error("Failed to encode response: %s", err.Error())
+	}
+}
+
+func (a *Application) searchCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	if t.String("query") == "" {
+		return errMissingQuery
+	}
+	return a.listCommand(t, nil, r)
+}
+
+func (a *Application) listCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	paginator, err := a.paginate(t.Values())
+	if err != nil {
+		return err.Error
+	}
+	r.Data = paginatorData(paginator)
+	return nil
+}
+
+func (a *Application) getCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	id := t.String("id")
+	if id == "" {
+		return errMissingId
+	}
+	cache, ok := a.GetTweet(id)
+	if !ok {
+		return store.ErrNotFound
+	}
+	r.Data = a.tweetData(cache)
+	return nil
+}
+
+func (a *Application) syncCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	accounts, err := a.selectAccounts(t.String("account"))
+	if err != nil {
+		return err
+	}
+	started, err := a.runNow(accounts)
+	if err != nil {
+		return err
+	}
+	r.Data["started"] = started
+	return nil
+}
+
+func (a *Application) cancelCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	accounts, err := a.selectAccounts(t.String("account"))
+	if err != nil {
+		return err
+	}
+	r.Data["canceled"] = a.cancelRuns(accounts)
+	return nil
+}
+
+func (a *Application) tagCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	return a.labelCommand(t, r, (*labelPayload).add)
+}
+
+func (a *Application) untagCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	return a.labelCommand(t, r, (*labelPayload).remove)
+}
+
+func (a *Application) labelCommand(t *Task, r *Response, fn func(p *labelPayload, ct *scraper.CachedTweet)) error {
+	id := t.String("id")
+	if id == "" {
+		return errMissingId
+	}
+	p := &labelPayload{}
+	if err := t.Decode(p); err != nil {
+		return err
+	}
+	if p.Tag != "" {
+		p.Tags = append(p.Tags, p.Tag)
+	}
+	if p.Collection != "" {
+		p.Collections = append(p.Collections, p.Collection)
+	}
+
+	ct, err := a.UpdateTweet(id, func(ct *scraper.CachedTweet) error {
+		fn(p, ct)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Data = a.labelsChanged(ct)
+	return nil
+}
+
+func (a *Application) deleteCommand(t *Task, _ *server.WebsocketClient, r *Response) error {
+	id := t.String("id")
+	if id == "" {
+		return errMissingId
+	}
+	if err := a.DeleteTweet(id); err != nil {
+		return err
+	}
+	log.Info("Tweet %s deleted", id)
+
+	a.publish(TopicTweets, EventTweetDeleted, map[string]interface{}{
+		"id": id,
+	})
+	r.Data["id"] = id
+	return nil
+}
+
+func (a *Application) subscribeCommand(t *Task, c *server.WebsocketClient, r *Response) error {
+	requested, err := commandTopics(t)
+	if err != nil {
+		return err
+	}
+	c.Subscribe(requested...)
+	r.Data["topics"] = c.Topics()
+	return nil
+}
+
+func (a *Application) unsubscribeCommand(t *Task, c *server.WebsocketClient, r *Response) error {
+	requested, err := commandTopics(t)
+	if err != nil {
+		return err
+	}
+	c.Unsubscribe(requested...)
+	r.Data["topics"] = c.Topics()
+	return nil
+}
+
+// commandTopics returns the topics listed by the payload, which may be given as "topic" or "topics"
+func commandTopics(t *Task) ([]string, error) {
+	requested := t.Values()["topics"]
+	if topic := t.String("topic"); topic != "" {
+		requested = append(requested, topic)
+	}
+	for _, topic := range requested {
+		if !containsString(topics, topic) {
+			return nil, errors.New("unknown topic \"" + topic + "\"")
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,281 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tbm/scraper"
+	"time"
+)
+
+// Archive is an official Twitter / X account data archive as downloaded from the account settings
+type Archive struct {
+	zr      *zip.ReadCloser
+	dataDir string
+	files   map[string]*zip.File
+}
+
+type Account struct {
+	AccountId   string `json:"accountId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"accountDisplayName"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type Profile struct {
+	Description struct {
+		Bio      string `json:"bio"`
+		Website  string `json:"website"`
+		Location string `json:"location"`
+	} `json:"description"`
+	AvatarMediaUrl string `json:"avatarMediaUrl"`
+	HeaderMediaUrl string `json:"headerMediaUrl"`
+}
+
+type Bookmark struct {
+	TweetId     string `json:"tweetId"`
+	FullText    string `json:"fullText"`
+	ExpandedUrl string `json:"expandedUrl"`
+}
+
+var (
+	ErrNoArchive = errors.New("file is not a twitter data archive")
+
+	// Numeric values are quoted within the archive, while the api returns them as numbers
+	integerFields = map[string]bool{
+		"favorite_count":     true,
+		"retweet_count":      true,
+		"reply_count":        true,
+		"quote_count":        true,
+		"bitrate":            true,
+		"indices":            true,
+		"display_text_range": true,
+		"w":                  true,
+		"h":                  true,
+		"width":              true,
+		"height":             true,
+		"x":                  true,
+		"y":                  true,
+	}
+	statusUrlPattern = regexp.MustCompile(`^https?://(?:www\.|mobile\.)?(?:twitter|x)\.com/([^/]+)/status(?:es)?/[0-9]+`)
+)
+
+// Open opens a zipped data archive
+func Open(filename string) (*Archive, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		zr:    zr,
+		files: map[string]*zip.File{},
+	}
+	for _, f := range zr.File {
+		a.files[f.Name] = f
+		// The data directory might be nested, if the archive got repacked
+		if a.dataDir == "" && (path.Base(f.Name) == "manifest.js" || path.Base(f.Name) == "account.js") {
+			a.dataDir = path.Dir(f.Name)
+		}
+	}
+	if a.dataDir == "" {
+		_ = zr.Close()
+		return nil, ErrNoArchive
+	}
+
+	return a, nil
+}
+
+func (a *Archive) Close() error {
+	return a.zr.Close()
+}
+
+// Account returns the account the archive belongs to
+func (a *Archive) Account() (*Account, error) {
+	accounts := make([]*Account, 0)
+	if err := a.readEntries("account", &accounts, "account"); err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	return accounts[0], nil
+}
+
+func (a *Archive) Profile() (*Profile, error) {
+	profiles := make([]*Profile, 0)
+	if err := a.readEntries("profile", &profiles, "profile"); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	return profiles[0], nil
+}
+
+// Bookmarks returns all bookmarks. The archive only contains their tweet id and text, if at all.
+func (a *Archive) Bookmarks() ([]*Bookmark, error) {
+	bookmarks := make([]*Bookmark, 0)
+	err := a.readEntries("bookmark", &bookmarks, "bookmarks", "bookmark")
+	return bookmarks, err
+}
+
+// Tweets returns all tweets posted by the account
+func (a *Archive) Tweets() ([]*scraper.TweetResult, error) {
+	entries := make([]interface{}, 0)
+	if err := a.readEntries("tweet", &entries, "tweets", "tweet"); err != nil {
+		return nil, err
+	}
+
+	tweets := make([]*scraper.TweetResult, 0, len(entries))
+	for _, entry := range entries {
+		b, err := json.Marshal(normalize("", entry))
+		if err != nil {
+			return nil, err
+		}
+		tweet := &scraper.TweetResult{}
+		if err := json.Unmarshal(b, tweet); err != nil {
+			return nil, err
+		}
+		if tweet.IdStr != "" {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return tweets, nil
+}
+
+// TweetMedia returns all media files bundled for a given tweet
+func (a *Archive) TweetMedia(tweetId string) map[string]*zip.File {
+	return a.media(tweetId, "tweets_media", "tweet_media")
+}
+
+// ProfileMedia returns the bundled avatar and header images of an account
+func (a *Archive) ProfileMedia(accountId string) map[string]*zip.File {
+	return a.media(accountId, "profile_media")
+}
+
+// media returns all files of the given media directories prefixed by an id. The files are mapped by their original
+// name, which equals the last segment of their media url.
+func (a *Archive) media(id string, dirs ...string) map[string]*zip.File {
+	files := map[string]*zip.File{}
+	for _, dir := range dirs {
+		prefix := path.Join(a.dataDir, dir, id) + "-"
+		for name, f := range a.files {
+			if strings.HasPrefix(name, prefix) {
+				files[strings.TrimPrefix(name, prefix)] = f
+			}
+		}
+	}
+	return files
+}
+
+// readEntries decodes all entries of a data file such as "tweets.js" and its parts "tweets-part1.js", ...
+// Every entry is wrapped inside an object using the given key.
+func (a *Archive) readEntries(key string, v interface{}, names ...string) error {
+	entries := make([]json.RawMessage, 0)
+	for _, name := range names {
+		pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `(-part[0-9]+)?\.js$`)
+		filenames := make([]string, 0)
+		for filename := range a.files {
+			if path.Dir(filename) == a.dataDir && pattern.MatchString(path.Base(filename)) {
+				filenames = append(filenames, filename)
+			}
+		}
+		sort.Strings(filenames)
+
+		for _, filename := range filenames {
+			part, err := a.readDataFile(filename)
+			if err != nil {
+				return err
+			}
+			for _, raw := range part {
+				wrapper := map[string]json.RawMessage{}
+				if err := json.Unmarshal(raw, &wrapper); err != nil {
+					return fmt.Errorf("%s: %s", filename, err.Error())
+				}
+				if entry, ok := wrapper[key]; ok {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		if len(filenames) > 0 {
+			break
+		}
+	}
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// readDataFile reads a javascript data file like "window.YTD.tweets.part0 = [ ... ]"
+func (a *Archive) readDataFile(filename string) ([]json.RawMessage, error) {
+	r, err := a.files[filename].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if pos := bytes.IndexByte(b, '='); pos >= 0 && pos < bytes.IndexByte(b, '[') {
+		b = b[pos+1:]
+	}
+
+	entries := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return entries, nil
+}
+
+func normalize(key string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalize(k, item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalize(key, item)
+		}
+	case string:
+		if integerFields[key] {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return v
+}
+
+// ScreenName extracts the author from a status url, if available
+func (b *Bookmark) ScreenName() string {
+	matches := statusUrlPattern.FindStringSubmatch(b.ExpandedUrl)
+	if len(matches) < 2 || matches[1] == "i" {
+		return ""
+	}
+	return matches[1]
+}
+
+// SnowflakeTime returns the creation time encoded into a tweet id. Ids created before november 2010 don't contain a
+// timestamp, in which case a zero time is returned.
+func SnowflakeTime(id string) time.Time {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 30000000000 {
+		return time.Time{}
+	}
+	return time.UnixMilli((n >> 22) + 1288834974657).UTC()
+}
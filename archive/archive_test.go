@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"tbm/scraper"
+	"testing"
+	"time"
+)
+
+// writeArchive creates a zipped archive containing the given files
+func writeArchive(t *testing.T, files map[string]string) string {
+	filename := path.Join(t.TempDir(), "archive.zip")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func openArchive(t *testing.T, files map[string]string) *Archive {
+	a, err := Open(writeArchive(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+	return a
+}
+
+func TestOpenWithoutData(t *testing.T) {
+	if _, err := Open(writeArchive(t, map[string]string{"readme.txt": "hello"})); err != ErrNoArchive {
+		t.Fatalf("error %v, want %v", err, ErrNoArchive)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	a := openArchive(t, map[string]string{
+		"twitter/data/manifest.js": `window.__THAR_CONFIG = {}`,
+		"twitter/data/account.js": `window.YTD.account.part0 = [
+			{"account": {"accountId": "42", "username": "jack", "accountDisplayName": "Jack"}}
+		]`,
+		"twitter/data/tweets.js": `window.YTD.tweets.part0 = [
+			{"tweet": {"id_str": "1001", "full_text": "first", "favorite_count": "5", "retweet_count": "2",
+				"display_text_range": ["0", "5"],
+				"extended_entities": {"media": [{"id_str": "77", "media_url_https": "https://pbs.twimg.com/media/abc.jpg"}]}}}
+		]`,
+		"twitter/data/tweets-part1.js": `window.YTD.tweets.part1 = [
+			{"tweet": {"id_str": "1002", "full_text": "second"}},
+			{"tweet": {"full_text": "without id"}}
+		]`,
+		"twitter/data/bookmarks.js": `window.YTD.bookmarks.part0 = [
+			{"bookmark": {"tweetId": "1585000000000000000", "fullText": "bookmarked", "expandedUrl": "https://twitter.com/jane/status/1585000000000000000"}},
+			{"bookmark": {"tweetId": "2002", "expandedUrl": "https://twitter.com/i/web/status/2002"}}
+		]`,
+		"twitter/data/tweets_media/1001-abc.jpg":   "jpg",
+		"twitter/data/tweets_media/10011-def.jpg":  "other tweet",
+		"twitter/data/profile_media/42-avatar.png": "png",
+	})
+
+	account, err := a.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account == nil || account.AccountId != "42" || account.Username != "jack" || account.DisplayName != "Jack" {
+		t.Errorf("unexpected account %+v", account)
+	}
+	profile, err := a.Profile()
+	if err != nil || profile != nil {
+		t.Errorf("profile %+v and error %v, want none", profile, err)
+	}
+
+	tweets, err := a.Tweets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tweets) != 2 {
+		t.Fatalf("%d tweets, want 2 of both parts with an id", len(tweets))
+	}
+	byId := map[string]*scraper.TweetResult{}
+	for _, tweet := range tweets {
+		byId[tweet.IdStr] = tweet
+	}
+	first, second := byId["1001"], byId["1002"]
+	if first == nil || second == nil {
+		t.Fatalf("tweets of all parts expected, got %v", byId)
+	}
+	if first.FullText != "first" || second.FullText != "second" {
+		t.Errorf("unexpected texts %q, %q", first.FullText, second.FullText)
+	}
+	// Quoted numbers of the archive are converted into the numbers of the api
+	if first.FavoriteCount != 5 || first.RetweetCount != 2 || len(first.DisplayTextRange) != 2 || first.DisplayTextRange[1] != 5 {
+		t.Errorf("counts not converted: %d favorites, %d retweets, range %v", first.FavoriteCount, first.RetweetCount, first.DisplayTextRange)
+	}
+	if len(first.ExtendedEntities.Media) != 1 || first.ExtendedEntities.Media[0].IdStr != "77" {
+		t.Errorf("unexpected media %+v", first.ExtendedEntities.Media)
+	}
+
+	media := a.TweetMedia("1001")
+	if len(media) != 1 || media["abc.jpg"] == nil {
+		t.Errorf("unexpected tweet media %v", media)
+	}
+	if avatar := a.ProfileMedia("42"); len(avatar) != 1 || avatar["avatar.png"] == nil {
+		t.Errorf("unexpected profile media %v", avatar)
+	}
+
+	bookmarks, err := a.Bookmarks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 2 {
+		t.Fatalf("%d bookmarks, want 2", len(bookmarks))
+	}
+	if bookmarks[0].TweetId != "1585000000000000000" || bookmarks[0].FullText != "bookmarked" || bookmarks[0].ScreenName() != "jane" {
+		t.Errorf("unexpected bookmark %+v", bookmarks[0])
+	}
+	if name := bookmarks[1].ScreenName(); name != "" {
+		t.Errorf("screen name %q of a status url without author", name)
+	}
+}
+
+func TestArchiveWithoutOptionalFiles(t *testing.T) {
+	a := openArchive(t, map[string]string{"data/account.js": `window.YTD.account.part0 = []`})
+
+	if account, err := a.Account(); err != nil || account != nil {
+		t.Errorf("account %+v and error %v, want none", account, err)
+	}
+	if bookmarks, err := a.Bookmarks(); err != nil || len(bookmarks) != 0 {
+		t.Errorf("%d bookmarks and error %v, want none", len(bookmarks), err)
+	}
+}
+
+func TestInvalidDataFile(t *testing.T) {
+	a := openArchive(t, map[string]string{
+		"data/account.js": `window.YTD.account.part0 = []`,
+		"data/tweets.js":  `window.YTD.tweets.part0 = [{"tweet": `,
+	})
+	if _, err := a.Tweets(); err == nil {
+		t.Fatal("no error for an invalid data file")
+	}
+}
+
+func TestSnowflakeTime(t *testing.T) {
+	if got := SnowflakeTime("1585000000000000000"); !got.Equal(time.Date(2022, 10, 25, 20, 7, 2, 532000000, time.UTC)) {
+		t.Errorf("unexpected time %s", got)
+	}
+	for _, id := range []string{"20", "", "abc"} {
+		if got := SnowflakeTime(id); !got.IsZero() {
+			t.Errorf("time %s of id %q, want none", got, id)
+		}
+	}
+}
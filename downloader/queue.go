@@ -0,0 +1,416 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"tbm/utils/filesystem"
+	"tbm/utils/log"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusActive  Status = "active"
+	StatusFailed  Status = "failed"
+	StatusDone    Status = "done"
+
+	StateFilename = "downloads.json"
+	MaxBackoff    = 6 * time.Hour
+	// SaveDelay collects all changes within this period into a single write of the state file
+	SaveDelay = time.Second
+)
+
+// Job is a single media file to download. Jobs are identified by their target filename within the media directory.
+type Job struct {
+	Target      string    `json:"target"`
+	Url         string    `json:"url"`
+	TweetId     string    `json:"tweet_id"`
+	Status      Status    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	Sha256      string    `json:"sha256,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Record is all that is kept of a finished job: the size and checksum of the downloaded file, so it can be checked
+// later on
+type Record struct {
+	TweetId string `json:"tweet_id"`
+	Size    int64  `json:"size"`
+	Sha256  string `json:"sha256"`
+}
+
+// job returns the finished job a record has been created from
+func (r Record) job(target string) Job {
+	return Job{Target: target, TweetId: r.TweetId, Status: StatusDone, Size: r.Size, Sha256: r.Sha256}
+}
+
+// state is the content of the state file
+type state struct {
+	Jobs []*Job            `json:"jobs"`
+	Done map[string]Record `json:"done"`
+}
+
+// Queue downloads media files using a limited number of workers. Its state is persisted shortly after every change,
+// so pending downloads survive a restart. Finished jobs are compacted into records.
+type Queue struct {
+	Workers     int           `json:"workers"`
+	MaxAttempts int           `json:"max_attempts"`
+	Backoff     time.Duration `json:"-"`
+	RawBackoff  string        `json:"backoff"`
+
+	Dir       string `json:"-"`
+	StateFile string `json:"-"`
+	// OnFinished is called after every completed or failed download attempt
+	OnFinished func(job Job) `json:"-"`
+
+	fetch     FetchFunc
+	mx        sync.Mutex
+	smx       sync.Mutex
+	jobs      map[string]*Job
+	done      map[string]Record
+	dirty     bool
+	saveTimer *time.Timer
+	wake      chan bool
+	close     chan bool
+	wg        sync.WaitGroup
+	running   bool
+}
+
+var ErrUnknownJob = errors.New("unknown download")
+
+func NewQueue(fetch FetchFunc) *Queue {
+	return &Queue{
+		Workers:     2,
+		MaxAttempts: 8,
+		Backoff:     30 * time.Second,
+		fetch:       fetch,
+		jobs:        map[string]*Job{},
+		done:        map[string]Record{},
+		wake:        make(chan bool, 1),
+	}
+}
+
+// Load restores the persisted queue. Downloads which were active during a shutdown are pending again.
+func (q *Queue) Load() error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.jobs = map[string]*Job{}
+	q.done = map[string]Record{}
+	b, err := os.ReadFile(q.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	st := state{}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	for target, record := range st.Done {
+		if validTarget(target) {
+			q.done[target] = record
+		}
+	}
+	for _, job := range st.Jobs {
+		if !validTarget(job.Target) {
+			continue
+		}
+		if job.Status == StatusActive {
+			job.Status = StatusPending
+		}
+		q.jobs[job.Target] = job
+	}
+	return nil
+}
+
+// changed schedules a save of the queue. All changes within SaveDelay are written at once. The caller has to hold
+// the lock.
+func (q *Queue) changed() {
+	q.dirty = true
+	if q.saveTimer == nil {
+		q.saveTimer = time.AfterFunc(SaveDelay, func() {
+			if err := q.Flush(); err != nil {
+				log.Error("Failed to save the download queue: %s", err.Error())
+			}
+		})
+	}
+}
+
+// Flush writes all pending changes into the state file immediately
+func (q *Queue) Flush() error {
+	// Saves must not overtake each other, otherwise an older state could be written last
+	q.smx.Lock()
+	defer q.smx.Unlock()
+
+	q.mx.Lock()
+	if q.saveTimer != nil {
+		q.saveTimer.Stop()
+		q.saveTimer = nil
+	}
+	if !q.dirty {
+		q.mx.Unlock()
+		return nil
+	}
+	q.dirty = false
+	st := state{Jobs: make([]*Job, 0, len(q.jobs)), Done: make(map[string]Record, len(q.done))}
+	for _, job := range q.jobs {
+		j := *job
+		st.Jobs = append(st.Jobs, &j)
+	}
+	for target, record := range q.done {
+		st.Done[target] = record
+	}
+	q.mx.Unlock()
+
+	if err := q.save(st); err != nil {
+		// Keep the changes for the next attempt
+		q.mx.Lock()
+		q.changed()
+		q.mx.Unlock()
+		return err
+	}
+	return nil
+}
+
+// save writes the queue into a temporary file first, so a crash can't leave a truncated state behind. The caller has
+// to hold the save lock.
+func (q *Queue) save(st state) error {
+	sort.Slice(st.Jobs, func(i, j int) bool {
+		return st.Jobs[i].Target < st.Jobs[j].Target
+	})
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	return filesystem.WriteFileAtomic(q.StateFile, b, 0644)
+}
+
+// Add queues a download unless the target isn't a plain file name, is already queued, downloaded or exists in the
+// media directory. Returns true if a new download was queued.
+func (q *Queue) Add(tweetId, src, target string) bool {
+	if src == "" || !validTarget(target) {
+		return false
+	}
+
+	q.mx.Lock()
+	if _, ok := q.jobs[target]; ok {
+		q.mx.Unlock()
+		return false
+	}
+	if _, ok := q.done[target]; ok {
+		q.mx.Unlock()
+		return false
+	}
+	if _, err := os.Stat(path.Join(q.Dir, target)); err == nil {
+		q.mx.Unlock()
+		return false
+	}
+	now := time.Now()
+	q.jobs[target] = &Job{
+		Target:    target,
+		Url:       src,
+		TweetId:   tweetId,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	q.changed()
+	q.mx.Unlock()
+
+	q.notify()
+	return true
+}
+
+// Requeue downloads a target again, even if it has been downloaded already, and reports whether it has been queued
+func (q *Queue) Requeue(tweetId, src, target string) bool {
+	return q.RequeueAll([]Job{{TweetId: tweetId, Url: src, Target: target}}) > 0
+}
+
+// RequeueAll downloads the targets of all given jobs again, using their tweet id and url if set, and returns the
+// number of queued targets. All changes are saved at once.
+func (q *Queue) RequeueAll(jobs []Job) int {
+	count := 0
+	q.mx.Lock()
+	for _, j := range jobs {
+		if q.requeue(j.TweetId, j.Url, j.Target) {
+			count++
+		}
+	}
+	if count > 0 {
+		q.changed()
+	}
+	q.mx.Unlock()
+
+	if count > 0 {
+		q.notify()
+	}
+	return count
+}
+
+// requeue resets or creates the job of a target and reports whether it has been queued. Active downloads are skipped,
+// since their worker still writes the partial file and replaces the target once finished. The caller has to hold the
+// lock.
+func (q *Queue) requeue(tweetId, src, target string) bool {
+	if !validTarget(target) {
+		return false
+	}
+	job, ok := q.jobs[target]
+	if ok && job.Status == StatusActive {
+		return false
+	}
+	if !ok {
+		job = &Job{
+			Target:    target,
+			TweetId:   q.done[target].TweetId,
+			CreatedAt: time.Now(),
+		}
+		q.jobs[target] = job
+		delete(q.done, target)
+	}
+	if src != "" {
+		job.Url = src
+	}
+	if tweetId != "" {
+		job.TweetId = tweetId
+	}
+	q.reset(job)
+	return true
+}
+
+// validTarget reports whether a target is a plain file name within the media directory
+func validTarget(target string) bool {
+	return target != "" && path.Base(target) == target && !strings.ContainsAny(target, `/\`) &&
+		!strings.Contains(target, "..") && !strings.HasPrefix(target, ".")
+}
+
+// Retry resets a failed download. All failed downloads are retried if no target is given.
+func (q *Queue) Retry(target string) (int, error) {
+	count := 0
+	q.mx.Lock()
+	if target != "" {
+		job, ok := q.jobs[target]
+		if !ok {
+			q.mx.Unlock()
+			return 0, ErrUnknownJob
+		}
+		if job.Status == StatusFailed {
+			q.reset(job)
+			count++
+		}
+	} else {
+		for _, job := range q.jobs {
+			if job.Status == StatusFailed {
+				q.reset(job)
+				count++
+			}
+		}
+	}
+	if count > 0 {
+		q.changed()
+	}
+	q.mx.Unlock()
+
+	if count > 0 {
+		q.notify()
+	}
+	return count, nil
+}
+
+func (q *Queue) reset(job *Job) {
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.Error = ""
+	job.NextAttempt = time.Time{}
+	job.UpdatedAt = time.Now()
+}
+
+// Get returns a copy of the job belonging to a target
+func (q *Queue) Get(target string) (Job, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if job, ok := q.jobs[target]; ok {
+		return *job, true
+	}
+	if record, ok := q.done[target]; ok {
+		return record.job(target), true
+	}
+	return Job{}, false
+}
+
+// Jobs returns a copy of all jobs with one of the given states, ordered by tweet and target
+func (q *Queue) Jobs(states ...Status) []Job {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	jobs := make([]Job, 0)
+	for _, job := range q.jobs {
+		if len(states) == 0 || containsStatus(states, job.Status) {
+			jobs = append(jobs, *job)
+		}
+	}
+	if len(states) == 0 || containsStatus(states, StatusDone) {
+		for target, record := range q.done {
+			jobs = append(jobs, record.job(target))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].TweetId == jobs[j].TweetId {
+			return jobs[i].Target < jobs[j].Target
+		}
+		// Newest tweets first, tweet ids differ in length
+		if len(jobs[i].TweetId) != len(jobs[j].TweetId) {
+			return len(jobs[i].TweetId) > len(jobs[j].TweetId)
+		}
+		return jobs[i].TweetId > jobs[j].TweetId
+	})
+	return jobs
+}
+
+// Counts returns the number of jobs per state
+func (q *Queue) Counts() map[string]int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	counts := map[string]int{
+		string(StatusPending): 0,
+		string(StatusActive):  0,
+		string(StatusFailed):  0,
+		string(StatusDone):    0,
+	}
+	for _, job := range q.jobs {
+		counts[string(job.Status)]++
+	}
+	counts[string(StatusDone)] += len(q.done)
+	return counts
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+func containsStatus(states []Status, status Status) bool {
+	for _, s := range states {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
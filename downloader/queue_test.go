@@ -0,0 +1,39 @@
+package downloader
+
+import "testing"
+
+func TestAddRejectsInvalidTargets(t *testing.T) {
+	q := NewQueue(nil)
+	q.Dir = t.TempDir()
+
+	for _, target := range []string{"", "../x.jpg", "a/b.jpg", "..", ".hidden", "a..b.jpg", `a\b.jpg`, "/x.jpg"} {
+		if q.Add("1", "https://pbs.twimg.com/media/x.jpg", target) {
+			t.Errorf("target %q queued", target)
+		}
+		if q.Requeue("1", "https://pbs.twimg.com/media/x.jpg", target) {
+			t.Errorf("target %q requeued", target)
+		}
+	}
+	if !q.Add("1", "https://pbs.twimg.com/media/x.jpg", "10.jpg") {
+		t.Error("valid target not queued")
+	}
+}
+
+func TestRequeueSkipsActiveDownloads(t *testing.T) {
+	q := NewQueue(nil)
+	q.Dir = t.TempDir()
+	q.Add("1", "https://pbs.twimg.com/media/a.jpg", "10.jpg")
+	q.Add("1", "https://pbs.twimg.com/media/b.jpg", "11.jpg")
+
+	active := q.next()
+	if active == nil {
+		t.Fatal("no download started")
+	}
+	count := q.RequeueAll([]Job{{Target: "10.jpg"}, {Target: "11.jpg"}})
+	if count != 1 {
+		t.Errorf("%d targets requeued, want 1", count)
+	}
+	if job, _ := q.Get(active.Target); job.Status != StatusActive {
+		t.Errorf("active download reset to %s", job.Status)
+	}
+}
@@ -0,0 +1,333 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"tbm/utils/log"
+	"time"
+)
+
+// FetchFunc requests a resource starting at the given byte offset. The response status isn't checked.
+type FetchFunc func(ctx context.Context, src string, offset int64) (*http.Response, error)
+
+// StatusError is returned for unsuccessful http responses
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected response \"" + e.Status + "\""
+}
+
+// Permanent reports whether retrying the request is pointless, e.g. because the media file has been deleted
+func (e *StatusError) Permanent() bool {
+	switch e.Code {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+const pollInterval = 5 * time.Second
+
+// Start launches the download workers
+func (q *Queue) Start() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.running {
+		return
+	}
+	q.running = true
+	q.close = make(chan bool)
+
+	workers := q.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	go func(closed chan bool) {
+		<-closed
+		cancel()
+	}(q.close)
+
+	log.Info("Media downloader started with %d workers", workers)
+}
+
+// Stop cancels all active downloads and waits for the workers to exit. Partial files are kept and resumed later on.
+// Pending changes are saved even if the workers haven't been started.
+func (q *Queue) Stop() {
+	q.mx.Lock()
+	if q.running {
+		q.running = false
+		close(q.close)
+	}
+	q.mx.Unlock()
+
+	q.wg.Wait()
+	if err := q.Flush(); err != nil {
+		log.Error("Failed to save the download queue: %s", err.Error())
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		job := q.next()
+		if job == nil {
+			select {
+			case <-q.wake:
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		size, sum, err := q.download(ctx, job)
+		q.finish(ctx, job.Target, size, sum, err)
+	}
+}
+
+// next marks the first due download as active and returns a copy of it
+func (q *Queue) next() *Job {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	now := time.Now()
+	var next *Job
+	due := 0
+	for _, job := range q.jobs {
+		if job.Status != StatusPending || job.NextAttempt.After(now) {
+			continue
+		}
+		due++
+		if next == nil || job.CreatedAt.Before(next.CreatedAt) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	if due > 1 {
+		// Let another idle worker pick up the remaining downloads
+		q.notify()
+	}
+	next.Status = StatusActive
+	next.UpdatedAt = now
+	job := *next
+	return &job
+}
+
+func (q *Queue) finish(ctx context.Context, target string, size int64, sum string, err error) {
+	q.mx.Lock()
+	job, ok := q.jobs[target]
+	if !ok {
+		q.mx.Unlock()
+		return
+	}
+	job.UpdatedAt = time.Now()
+
+	if err == nil {
+		job.Status = StatusDone
+		job.Attempts++
+		job.Error = ""
+		job.Size = size
+		job.Sha256 = sum
+		// Only the size and checksum of finished jobs are kept
+		delete(q.jobs, target)
+		q.done[target] = Record{TweetId: job.TweetId, Size: size, Sha256: sum}
+	} else if ctx.Err() != nil {
+		// Cancelled by a shutdown, which doesn't count as attempt
+		job.Status = StatusPending
+	} else {
+		job.Attempts++
+		job.Error = err.Error()
+
+		var se *StatusError
+		if (errors.As(err, &se) && se.Permanent()) || job.Attempts >= q.MaxAttempts {
+			job.Status = StatusFailed
+			log.Error("Failed to download %s after %d attempts: %s", job.Url, job.Attempts, job.Error)
+		} else {
+			job.Status = StatusPending
+			job.NextAttempt = job.UpdatedAt.Add(q.backoff(job.Attempts))
+			log.Warning("Failed to download %s, retrying at %s: %s", job.Url, job.NextAttempt.Format(time.RFC3339), job.Error)
+		}
+	}
+	finished := *job
+	q.changed()
+	q.mx.Unlock()
+
+	if q.OnFinished != nil && (err == nil || ctx.Err() == nil) {
+		q.OnFinished(finished)
+	}
+}
+
+// backoff doubles the delay with every failed attempt
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.Backoff
+	if d <= 0 {
+		d = time.Second
+	}
+	for i := 1; i < attempts && d < MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxBackoff {
+		d = MaxBackoff
+	}
+	return d
+}
+
+// download fetches a job into a ".part" file next to its target. An existing partial file is resumed using a range
+// request. The file is moved to its target once its length has been verified.
+func (q *Queue) download(ctx context.Context, job *Job) (int64, string, error) {
+	target := path.Join(q.Dir, job.Target)
+	part := target + ".part"
+
+	var offset int64
+	if fi, err := os.Stat(part); err == nil {
+		offset = fi.Size()
+	}
+
+	resp, err := q.fetch(ctx, job.Url, offset)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	total := int64(-1)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			_ = os.Remove(part)
+			return 0, "", errors.New("unexpected content range \"" + resp.Header.Get("Content-Range") + "\"")
+		}
+		flags |= os.O_APPEND
+		total = size
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		_ = os.Remove(part)
+		return 0, "", errors.New("partial download discarded, the remote file has changed")
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		flags |= os.O_TRUNC
+		offset = 0
+		total = resp.ContentLength
+	default:
+		return 0, "", &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	size := offset + n
+	if total >= 0 && size != total {
+		if size > total {
+			_ = os.Remove(part)
+		}
+		return 0, "", fmt.Errorf("incomplete download: received %d of %d bytes", size, total)
+	}
+	if size == 0 {
+		_ = os.Remove(part)
+		return 0, "", errors.New("empty response")
+	}
+
+	sum, err := hashFile(part)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(part, target); err != nil {
+		return 0, "", err
+	}
+	return size, sum, nil
+}
+
+// Check compares a downloaded file with the size and checksum recorded after its download, which detects files
+// truncated or changed later on
+func (q *Queue) Check(target string) error {
+	job, ok := q.Get(target)
+	if !ok || job.Status != StatusDone {
+		return ErrUnknownJob
+	}
+	filename := path.Join(q.Dir, target)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if job.Size > 0 && fi.Size() != job.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, found %d", job.Size, fi.Size())
+	}
+	if job.Sha256 != "" {
+		sum, err := hashFile(filename)
+		if err != nil {
+			return err
+		}
+		if sum != job.Sha256 {
+			return errors.New("checksum mismatch")
+		}
+	}
+	return nil
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseContentRange parses a header like "bytes 100-199/200" and returns the first byte and the total size. The
+// total size is -1 if unknown.
+func parseContentRange(header string) (int64, int64, bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if parts[1] == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
@@ -0,0 +1,188 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// fakeFetch responds with the given status, headers and body and records the requested offset
+func fakeFetch(status int, header map[string]string, body string, offset *int64) FetchFunc {
+	return func(ctx context.Context, src string, o int64) (*http.Response, error) {
+		*offset = o
+		resp := &http.Response{
+			StatusCode:    status,
+			Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: -1,
+		}
+		for k, v := range header {
+			resp.Header.Set(k, v)
+		}
+		if status == http.StatusOK {
+			resp.ContentLength = int64(len(body))
+		}
+		return resp, nil
+	}
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name       string
+		part       string
+		status     int
+		header     map[string]string
+		body       string
+		wantOffset int64
+		wantFile   string
+		wantErr    string
+		keepPart   bool
+	}{
+		{
+			name:     "fresh download",
+			status:   http.StatusOK,
+			body:     "0123456789",
+			wantFile: "0123456789",
+		},
+		{
+			name:       "resumed download",
+			part:       "01234",
+			status:     http.StatusPartialContent,
+			header:     map[string]string{"Content-Range": "bytes 5-9/10"},
+			body:       "56789",
+			wantOffset: 5,
+			wantFile:   "0123456789",
+		},
+		{
+			name:       "resumed download of unknown size",
+			part:       "01234",
+			status:     http.StatusPartialContent,
+			header:     map[string]string{"Content-Range": "bytes 5-9/*"},
+			body:       "56789",
+			wantOffset: 5,
+			wantFile:   "0123456789",
+		},
+		{
+			name:       "range ignored by the server",
+			part:       "01234",
+			status:     http.StatusOK,
+			body:       "0123456789",
+			wantOffset: 5,
+			wantFile:   "0123456789",
+		},
+		{
+			name:       "unexpected content range",
+			part:       "01234",
+			status:     http.StatusPartialContent,
+			header:     map[string]string{"Content-Range": "bytes 3-9/10"},
+			body:       "3456789",
+			wantOffset: 5,
+			wantErr:    "unexpected content range",
+		},
+		{
+			name:       "remote file changed",
+			part:       "01234",
+			status:     http.StatusRequestedRangeNotSatisfiable,
+			wantOffset: 5,
+			wantErr:    "partial download discarded",
+		},
+		{
+			name:       "incomplete resumed download",
+			part:       "01234",
+			status:     http.StatusPartialContent,
+			header:     map[string]string{"Content-Range": "bytes 5-9/10"},
+			body:       "567",
+			wantOffset: 5,
+			wantErr:    "received 8 of 10 bytes",
+			keepPart:   true,
+		},
+		{
+			name:    "missing file",
+			status:  http.StatusNotFound,
+			wantErr: "unexpected response",
+		},
+		{
+			name:    "empty response",
+			status:  http.StatusOK,
+			wantErr: "empty response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var offset int64
+			q := NewQueue(fakeFetch(tt.status, tt.header, tt.body, &offset))
+			q.Dir = t.TempDir()
+			target := path.Join(q.Dir, "1.mp4")
+			if tt.part != "" {
+				if err := os.WriteFile(target+".part", []byte(tt.part), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			size, sum, err := q.download(context.Background(), &Job{Target: "1.mp4", Url: "https://video.twimg.com/1.mp4"})
+			if offset != tt.wantOffset {
+				t.Errorf("requested offset %d, want %d", offset, tt.wantOffset)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(target); err == nil {
+					t.Error("target created by a failed download")
+				}
+				if _, err := os.Stat(target + ".part"); (err == nil) != tt.keepPart {
+					t.Errorf("partial file kept: %t, want %t", err == nil, tt.keepPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.wantFile {
+				t.Errorf("file %q, want %q", b, tt.wantFile)
+			}
+			if size != int64(len(tt.wantFile)) {
+				t.Errorf("size %d, want %d", size, len(tt.wantFile))
+			}
+			if want, _ := hashFile(target); sum != want {
+				t.Errorf("checksum %s, want %s", sum, want)
+			}
+			if _, err := os.Stat(target + ".part"); err == nil {
+				t.Error("partial file kept after a finished download")
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header string
+		start  int64
+		total  int64
+		ok     bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", 0, 0, false},
+		{"items 0-9/10", 0, 0, false},
+		{"bytes 0-9", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.header)
+		if start != tt.start || total != tt.total || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %t, want %d, %d, %t", tt.header, start, total, ok, tt.start, tt.total, tt.ok)
+		}
+	}
+}
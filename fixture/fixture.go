@@ -0,0 +1,268 @@
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders are never written to a fixture
+var sensitiveHeaders = []string{"Cookie", "Set-Cookie", "Authorization", "X-Csrf-Token", "X-Guest-Token"}
+
+var namePattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+var ErrNotRecorded = errors.New("fixture: no recording found")
+
+// Interaction is a single recorded request and its response
+type Interaction struct {
+	Method         string      `json:"method"`
+	Url            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	Status         string      `json:"status"`
+	StatusCode     int         `json:"status_code"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	Body           string      `json:"body,omitempty"`
+	BodyBase64     string      `json:"body_base64,omitempty"`
+}
+
+// Filename returns the name of the fixture file of a request, built from the last path segment of its url and a hash
+// of the method, url and body. Identical requests share a single file containing all of their responses in order.
+func Filename(method, rawUrl string, body []byte) string {
+	h := sha1.New()
+	h.Write([]byte(method + " " + rawUrl + "\n"))
+	h.Write(body)
+
+	name := "index"
+	if u, err := url.Parse(rawUrl); err == nil {
+		if base := path.Base(u.Path); base != "/" && base != "." {
+			name = namePattern.ReplaceAllString(base, "_")
+		}
+	}
+	return name + "-" + hex.EncodeToString(h.Sum(nil))[:16] + ".json"
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func load(filename string) ([]Interaction, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	interactions := make([]Interaction, 0)
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		return nil, err
+	}
+	return interactions, nil
+}
+
+// Recorder passes all requests to the next transport and saves every response into a fixture directory. Sensitive
+// headers are dropped and all secrets are replaced within urls and bodies.
+type Recorder struct {
+	dir     string
+	next    http.RoundTripper
+	secrets func() []string
+	mx      sync.Mutex
+}
+
+func NewRecorder(dir string, next http.RoundTripper, secrets func() []string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{
+		dir:     dir,
+		next:    next,
+		secrets: secrets,
+	}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := r.save(req, reqBody, resp, body); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(req *http.Request, reqBody []byte, resp *http.Response, body []byte) error {
+	secrets := make([]string, 0)
+	if r.secrets != nil {
+		secrets = r.secrets()
+	}
+	redact := func(str string) string {
+		for _, secret := range secrets {
+			if secret != "" {
+				str = strings.ReplaceAll(str, secret, Redacted)
+			}
+		}
+		return str
+	}
+
+	rawUrl := redact(req.URL.String())
+	redactedBody := redact(string(reqBody))
+	interaction := Interaction{
+		Method:         req.Method,
+		Url:            rawUrl,
+		RequestHeader:  redactHeader(req.Header),
+		RequestBody:    redactedBody,
+		Status:         resp.Status,
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: redactHeader(resp.Header),
+	}
+	if utf8.Valid(body) {
+		interaction.Body = redact(string(body))
+	} else {
+		interaction.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	filename := path.Join(r.dir, Filename(req.Method, rawUrl, []byte(redactedBody)))
+	interactions, err := load(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	interactions = append(interactions, interaction)
+
+	b, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+func redactHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
+
+// Player serves recorded responses without any network access. Requests recorded multiple times are answered in the
+// recorded order, the last response is repeated afterwards.
+type Player struct {
+	dir     string
+	secrets func() []string
+	mx      sync.Mutex
+	calls   map[string]int
+}
+
+func NewPlayer(dir string, secrets func() []string) (*Player, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("fixture: " + dir + " is not a directory")
+	}
+	return &Player{
+		dir:     dir,
+		secrets: secrets,
+		calls:   map[string]int{},
+	}, nil
+}
+
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	rawUrl := req.URL.String()
+	body := string(reqBody)
+	// Requests are matched the way they have been saved
+	if p.secrets != nil {
+		for _, secret := range p.secrets() {
+			if secret != "" {
+				rawUrl = strings.ReplaceAll(rawUrl, secret, Redacted)
+				body = strings.ReplaceAll(body, secret, Redacted)
+			}
+		}
+	}
+
+	name := Filename(req.Method, rawUrl, []byte(body))
+	interactions, err := load(path.Join(p.dir, name))
+	if os.IsNotExist(err) || len(interactions) == 0 {
+		return nil, errors.New(ErrNotRecorded.Error() + " for " + req.Method + " " + rawUrl + " (" + name + ")")
+	} else if err != nil {
+		return nil, err
+	}
+
+	p.mx.Lock()
+	n := p.calls[name]
+	p.calls[name] = n + 1
+	p.mx.Unlock()
+	if n >= len(interactions) {
+		n = len(interactions) - 1
+	}
+	interaction := interactions[n]
+
+	respBody := []byte(interaction.Body)
+	if interaction.BodyBase64 != "" {
+		if respBody, err = base64.StdEncoding.DecodeString(interaction.BodyBase64); err != nil {
+			return nil, err
+		}
+	}
+
+	header := interaction.ResponseHeader
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        interaction.Status,
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
@@ -2,7 +2,11 @@ module tbm
 
 go 1.17
 
-require github.com/gorilla/websocket v1.5.0
+require (
+	github.com/gorilla/websocket v1.5.0
+	github.com/russross/blackfriday/v2 v2.1.0
+	go.etcd.io/bbolt v1.3.6
+)
 
 require (
 	github.com/aymerick/douceur v0.2.0 // indirect
@@ -27,6 +27,7 @@ func main() {
 
 	flag.StringVar(&a.ConfigFileName, "config", a.ConfigFileName, "Application config file")
 	flag.StringVar(&a.DataDir, "data-dir", a.DataDir, "Folder containing all fetched data")
+	flag.StringVar(&a.Storage, "storage", a.Storage, "Storage driver used to persist tweets (json, bolt)")
 
 	flag.StringVar(&a.Server.Host, "host", a.Server.Host, "Host address the api should bind to")
 	flag.UintVar(&a.Server.Port, "port", a.Server.Port, "Port the api should bind to")
@@ -38,6 +39,7 @@ func main() {
 	flag.StringVar(&a.Scraper.Sections.Remove, "remove-section", a.Scraper.Sections.Remove, "Twitter remove bookmark api section name")
 	flag.DurationVar(&a.Scraper.Timeout, "timeout", a.Scraper.Timeout, "Request timeout")
 	flag.DurationVar(&a.Scraper.Delay, "delay", a.Scraper.Delay, "Delay your request by a given time")
+	flag.StringVar(&a.Scraper.Proxy, "proxy", a.Scraper.Proxy, "Proxy used for all requests (http://, https:// or socks5://)")
 
 	flag.BoolVar(&a.Danger.RemoveBookmarks, "danger-remove-bookmarks", a.Danger.RemoveBookmarks, "Remove the bookmark on Twitter if the tweet has been downloaded")
 
@@ -46,6 +48,8 @@ func main() {
 	sv := flag.Bool("version", false, "Show version and exit")
 	nc := flag.Bool("no-color", false, "Disable color output")
 	offline := flag.Bool("offline", false, "Don't fetch new bookmarks; link to local files only")
+	record := flag.String("record", "", "Record all twitter responses into a fixture directory")
+	replay := flag.String("replay", "", "Replay recorded twitter responses from a fixture directory")
 	flag.Parse()
 
 	if *nc {
@@ -65,17 +69,127 @@ func main() {
 		a.Mode = app.OfflineMode
 	}
 
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := a.LoadConfig(); err != nil {
+			log.Error("Failed to load the config file: %s", err.Error())
+			os.Exit(2) // No such file or directory
+		}
+		if flag.NArg() != 3 {
+			log.Error("Usage: tbm migrate <json|bolt> <json|bolt>")
+			os.Exit(64) // Command line usage error
+		}
+		if err := a.Migrate(flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Error("Failed to migrate the storage: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		os.Exit(0)
+	case "export":
+		if flag.Arg(2) == "-" {
+			// The csv is written to stdout, which must not contain any log lines
+			log.Output = os.Stderr
+		}
+		if err := a.LoadConfig(); err != nil {
+			log.Error("Failed to load the config file: %s", err.Error())
+			os.Exit(2) // No such file or directory
+		}
+		if flag.NArg() < 3 || flag.NArg() > 4 {
+			log.Error("Usage: tbm export <markdown|html|csv> <output> [filter]")
+			os.Exit(64) // Command line usage error
+		}
+		if err := a.LoadStore(); err != nil {
+			log.Error("Failed to load the storage: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		if err := a.ExportFile(flag.Arg(1), flag.Arg(2), flag.Arg(3)); err != nil {
+			log.Error("Failed to export tweets: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		os.Exit(0)
+	case "import":
+		if err := a.LoadConfig(); err != nil {
+			log.Error("Failed to load the config file: %s", err.Error())
+			os.Exit(2) // No such file or directory
+		}
+		if flag.NArg() != 2 {
+			log.Error("Usage: tbm import <archive.zip>")
+			os.Exit(64) // Command line usage error
+		}
+		if err := a.LoadStore(); err != nil {
+			log.Error("Failed to load the storage: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		if _, err := a.Import(flag.Arg(1)); err != nil {
+			log.Error("Failed to import the archive: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		os.Exit(0)
+	case "verify":
+		if err := a.LoadConfig(); err != nil {
+			log.Error("Failed to load the config file: %s", err.Error())
+			os.Exit(2) // No such file or directory
+		}
+		if flag.NArg() > 2 || (flag.NArg() == 2 && flag.Arg(1) != "repair") {
+			log.Error("Usage: tbm verify [repair]")
+			os.Exit(64) // Command line usage error
+		}
+		if err := a.LoadStore(); err != nil {
+			log.Error("Failed to load the storage: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		if err := a.Verify(flag.Arg(1) == "repair"); err != nil {
+			log.Error("Failed to verify the media files: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		os.Exit(0)
+	case "reparse":
+		if err := a.LoadConfig(); err != nil {
+			log.Error("Failed to load the config file: %s", err.Error())
+			os.Exit(2) // No such file or directory
+		}
+		if flag.NArg() > 1 {
+			log.Error("Usage: tbm reparse")
+			os.Exit(64) // Command line usage error
+		}
+		if err := a.LoadStore(); err != nil {
+			log.Error("Failed to load the storage: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		if _, err := a.Reparse(); err != nil {
+			log.Error("Failed to reparse the tweets: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+		os.Exit(0)
+	}
+
 	if err := a.Load(); err != nil {
 		log.Error("Failed to load the config file: %s", err.Error())
 		os.Exit(2) // No such file or directory
 	}
 
+	if *record != "" && *replay != "" {
+		log.Error("Responses can't be recorded and replayed at the same time")
+		os.Exit(64) // Command line usage error
+	}
+	if *record != "" {
+		if err := a.RecordFixtures(*record); err != nil {
+			log.Error("Failed to record fixtures: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+	}
+	if *replay != "" {
+		if err := a.ReplayFixtures(*replay); err != nil {
+			log.Error("Failed to replay fixtures: %s", err.Error())
+			os.Exit(131) // State not recoverable
+		}
+	}
+
 	if err := a.Start(); err != nil {
 		log.Error("Failed to start the application: %s", err.Error())
 		os.Exit(131) // State not recoverable
 	}
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 	if err := a.Stop(); err != nil {
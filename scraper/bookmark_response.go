@@ -19,18 +19,13 @@ type BookmarkResponse struct {
 							EntryType   string `json:"entryType"`
 							TypeName    string `json:"__typename"`
 							ItemContent struct {
-								ItemType            string `json:"itemType"`
-								TypeName            string `json:"__typename"`
-								Value               string `json:"value"`
-								CursorType          string `json:"cursorType"`
-								StopOnEmptyResponse bool   `json:"stopOnEmptyResponse"`
-								TweetResults        struct {
-									Result struct {
-										TweetResultBlock
-										Tweet TweetResultBlock `json:"tweet"`
-									} `json:"result"`
-								} `json:"tweet_results"`
-								TweetDisplayType string `json:"tweetDisplayType"`
+								ItemType            string       `json:"itemType"`
+								TypeName            string       `json:"__typename"`
+								Value               string       `json:"value"`
+								CursorType          string       `json:"cursorType"`
+								StopOnEmptyResponse bool         `json:"stopOnEmptyResponse"`
+								TweetResults        TweetResults `json:"tweet_results"`
+								TweetDisplayType    string       `json:"tweetDisplayType"`
 							} `json:"itemContent"`
 							Value               string `json:"value"`
 							CursorType          string `json:"cursorType"`
@@ -72,6 +67,25 @@ type BookmarkResponse struct {
 	} `json:"errors"`
 }
 
+type TweetResults struct {
+	Result TweetResultContainer `json:"result"`
+}
+
+// TweetResultContainer holds either a plain tweet or a tweet wrapped by a
+// "TweetWithVisibilityResults" object
+type TweetResultContainer struct {
+	TweetResultBlock
+	Tweet TweetResultBlock `json:"tweet"`
+}
+
+// Block returns the block carrying the actual tweet data
+func (c *TweetResultContainer) Block() *TweetResultBlock {
+	if c.Legacy.IdStr == "" && c.Tweet.Legacy.IdStr != "" {
+		return &c.Tweet
+	}
+	return &c.TweetResultBlock
+}
+
 type TweetResultBlock struct {
 	TypeName string `json:"__typename"`
 	RestId   string `json:"rest_id"`
@@ -80,8 +94,31 @@ type TweetResultBlock struct {
 			Result UserResult `json:"result"`
 		} `json:"user_results"`
 	} `json:"core"`
-	UnmentionInfo interface{} `json:"unmention_info"`
-	Legacy        TweetResult `json:"legacy"`
+	UnmentionInfo      interface{}      `json:"unmention_info"`
+	Legacy             TweetResult      `json:"legacy"`
+	NoteTweet          NoteTweetResults `json:"note_tweet"`
+	QuotedStatusResult *TweetResults    `json:"quoted_status_result"`
+	Card               *Card            `json:"card"`
+}
+
+// TweetResult returns the legacy tweet including the content of a long-form note tweet and its card. Quoted tweets and
+// retweeted originals are only referenced by their id, see LinkedTweets.
+func (b *TweetResultBlock) TweetResult() TweetResult {
+	tweet := b.Legacy
+	if note := b.NoteTweet.NoteTweetResults.Result; note.Text != "" {
+		tweet.NoteTweet = &note
+	}
+	if b.Card != nil && len(b.Card.Legacy.BindingValues) > 0 {
+		tweet.Card = b.Card
+	}
+	if tweet.QuotedStatusIDStr == "" && b.QuotedStatusResult != nil {
+		tweet.QuotedStatusIDStr = b.QuotedStatusResult.Result.Block().Legacy.IdStr
+	}
+	if tweet.RetweetedStatusIDStr == "" && tweet.RetweetedStatusResult != nil {
+		tweet.RetweetedStatusIDStr = tweet.RetweetedStatusResult.Result.Block().Legacy.IdStr
+	}
+	tweet.RetweetedStatusResult = nil
+	return tweet
 }
 
 type UserResult struct {
@@ -255,17 +292,9 @@ type TweetResult struct {
 			} `json:"original_info"`
 		} `json:"media"`
 		UserMentions []ConversationUser `json:"user_mentions"`
-		Urls         []struct {
-			DisplayUrl  string `json:"display_url"`
-			ExpandedUrl string `json:"expanded_url"`
-			Url         string `json:"url"`
-			Indices     []int  `json:"indices"`
-		} `json:"urls"`
-		Hashtags []struct {
-			Indices []int  `json:"indices"`
-			Text    string `json:"text"`
-		} `json:"hashtags"`
-		Symbols []interface{} `json:"symbols"`
+		Urls         []TweetUrl         `json:"urls"`
+		Hashtags     []Hashtag          `json:"hashtags"`
+		Symbols      []interface{}      `json:"symbols"`
 	} `json:"entities"`
 	ExtendedEntities struct {
 		Media []struct {
@@ -364,20 +393,30 @@ type TweetResult struct {
 	Source                    string `json:"source"`
 	UserIdStr                 string `json:"user_id_str"`
 	IdStr                     string `json:"id_str"`
+
+	// NoteTweet holds the complete content of long-form tweets
+	NoteTweet *NoteTweet `json:"note_tweet,omitempty"`
+	// Card holds the link preview or poll of the tweet
+	Card *Card `json:"card,omitempty"`
+	// RetweetedStatusResult is only set while parsing, the original is stored as linked record
+	RetweetedStatusResult *TweetResults `json:"retweeted_status_result,omitempty"`
 }
 
 func (tr *TweetResult) Text() string {
 	text := tr.FullText
+	if tr.NoteTweet != nil {
+		text = tr.NoteTweet.Html()
+	}
 
-	for _, hashtag := range tr.Entities.Hashtags {
+	for _, hashtag := range tr.ContentHashtags() {
 		re := regexp.MustCompile(`(#` + hashtag.Text + `)( |$|\s|[^\w])`)
 		text = re.ReplaceAllString(text, `<a class="text-teal-500" href="https://twitter.com/hashtag/`+hashtag.Text+`" target="_blank" rel="noreferrer">$0</a> `)
 	}
-	for _, mention := range tr.Entities.UserMentions {
+	for _, mention := range tr.ContentMentions() {
 		re := regexp.MustCompile(`(@` + mention.ScreenName + `)( |$|\s|[^\w])`)
 		text = re.ReplaceAllString(text, `<a class="text-teal-600" href="https://twitter.com/`+mention.ScreenName+`" target="_blank" rel="noreferrer">$0</a> `)
 	}
-	for _, _url := range tr.Entities.Urls {
+	for _, _url := range tr.ContentUrls() {
 		text = strings.ReplaceAll(text, _url.Url, `<a class="text-yellow-600" href="`+_url.ExpandedUrl+`" target="_blank" rel="noreferrer">`+_url.ExpandedUrl+`</a>`)
 	}
 	for _, _url := range tr.Entities.Media {
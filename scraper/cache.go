@@ -1,6 +1,10 @@
 package scraper
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"tbm/snapshot"
 	"time"
 )
 
@@ -10,12 +14,40 @@ type CachedTweet struct {
 	Tweet        TweetResult          `json:"tweet"`
 	Conversation ConversationResponse `json:"conversation"`
 
+	Tags        []string `json:"tags,omitempty"`
+	Collections []string `json:"collections,omitempty"`
+	Notes       []Note   `json:"notes,omitempty"`
+
+	// Accounts lists the names of all accounts which bookmarked the tweet
+	Accounts []string `json:"accounts,omitempty"`
+
+	// Incomplete lists the details missing for tweets which haven't been fetched from the api, such as imports
+	Incomplete []string `json:"incomplete,omitempty"`
+
+	// Raw holds the unparsed "tweet_results" of the bookmark timeline entry the tweet has been fetched from
+	Raw json.RawMessage `json:"-"`
+	// Linked holds the quoted tweet and retweeted original included within the fetched payload
+	Linked []*CachedTweet `json:"-"`
+
 	createdAt time.Time
 }
 
+const (
+	MissingUser         = "user"
+	MissingText         = "text"
+	MissingEntities     = "entities"
+	MissingCounts       = "counts"
+	MissingMedia        = "media"
+	MissingConversation = "conversation"
+)
+
 type ThreadItem struct {
-	Tweet TweetResult
-	User  ConversationUser
+	Tweet     TweetResult
+	User      ConversationUser
+	Notes     []Note
+	Quoted    *ThreadItem
+	Retweeted *ThreadItem
+	Snapshots []*snapshot.Snapshot
 }
 
 func (ct *CachedTweet) CreatedAt() time.Time {
@@ -25,6 +57,21 @@ func (ct *CachedTweet) CreatedAt() time.Time {
 	return ct.createdAt
 }
 
+// IsIncomplete checks if some details of the tweet are still missing
+func (ct *CachedTweet) IsIncomplete() bool {
+	return len(ct.Incomplete) > 0
+}
+
+// Lacks checks if a given detail is missing
+func (ct *CachedTweet) Lacks(detail string) bool {
+	return containsString(ct.Incomplete, detail)
+}
+
+// SetMissing marks a given detail as missing
+func (ct *CachedTweet) SetMissing(detail string) {
+	ct.Incomplete, _ = addString(ct.Incomplete, detail)
+}
+
 func (ct *CachedTweet) Thread() map[string]*ThreadItem {
 	thread := map[string]*ThreadItem{}
 	for tweetId, tweet := range ct.Conversation.GlobalObjects.Tweets {
@@ -36,8 +83,89 @@ func (ct *CachedTweet) Thread() map[string]*ThreadItem {
 		thread[tweetId] = &ThreadItem{
 			Tweet: tweet,
 			User:  user,
+			Notes: ct.NotesFor(tweetId),
 		}
 	}
 
 	return thread
 }
+
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+	return strings.Join(strings.Fields(tag), "-")
+}
+
+func NormalizeCollection(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// BookmarkedBy reports whether the given account bookmarked the tweet
+func (ct *CachedTweet) BookmarkedBy(account string) bool {
+	return containsString(ct.Accounts, account)
+}
+
+// AddAccount records an account which bookmarked the tweet and reports whether it hasn't been recorded before
+func (ct *CachedTweet) AddAccount(account string) bool {
+	added := false
+	ct.Accounts, added = addString(ct.Accounts, account)
+	return added
+}
+
+func (ct *CachedTweet) HasTag(tag string) bool {
+	return containsString(ct.Tags, NormalizeTag(tag))
+}
+
+func (ct *CachedTweet) AddTag(tag string) bool {
+	added := false
+	ct.Tags, added = addString(ct.Tags, NormalizeTag(tag))
+	return added
+}
+
+func (ct *CachedTweet) RemoveTag(tag string) bool {
+	removed := false
+	ct.Tags, removed = removeString(ct.Tags, NormalizeTag(tag))
+	return removed
+}
+
+func (ct *CachedTweet) InCollection(name string) bool {
+	return containsString(ct.Collections, NormalizeCollection(name))
+}
+
+func (ct *CachedTweet) AddToCollection(name string) bool {
+	added := false
+	ct.Collections, added = addString(ct.Collections, NormalizeCollection(name))
+	return added
+}
+
+func (ct *CachedTweet) RemoveFromCollection(name string) bool {
+	removed := false
+	ct.Collections, removed = removeString(ct.Collections, NormalizeCollection(name))
+	return removed
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func addString(items []string, value string) ([]string, bool) {
+	if value == "" || containsString(items, value) {
+		return items, false
+	}
+	items = append(items, value)
+	sort.Strings(items)
+	return items, true
+}
+
+func removeString(items []string, value string) ([]string, bool) {
+	for i, item := range items {
+		if strings.EqualFold(item, value) {
+			return append(items[:i], items[i+1:]...), true
+		}
+	}
+	return items, false
+}
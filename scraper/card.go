@@ -0,0 +1,180 @@
+package scraper
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Card is the link preview or poll attached to a tweet. Its content is a list of typed key value pairs, whose keys
+// depend on the name of the card, e.g. "summary_large_image" or "poll2choice_text_only".
+type Card struct {
+	RestId string `json:"rest_id"`
+	Legacy struct {
+		BindingValues []CardBindingValue `json:"binding_values"`
+		Name          string             `json:"name"`
+		Url           string             `json:"url"`
+	} `json:"legacy"`
+}
+
+type CardBindingValue struct {
+	Key   string    `json:"key"`
+	Value CardValue `json:"value"`
+}
+
+type CardValue struct {
+	Type         string     `json:"type"`
+	StringValue  string     `json:"string_value,omitempty"`
+	BooleanValue bool       `json:"boolean_value,omitempty"`
+	ImageValue   *CardImage `json:"image_value,omitempty"`
+}
+
+type CardImage struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Alt    string `json:"alt,omitempty"`
+}
+
+// Poll holds the options of a poll card and, once the poll has ended, its final results
+type Poll struct {
+	Options []PollOption
+	Votes   int
+	Final   bool
+	EndsAt  time.Time
+}
+
+type PollOption struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+// cardThumbnailKeys lists the image values used as thumbnail ordered by preference
+var cardThumbnailKeys = []string{
+	"thumbnail_image_large", "summary_photo_image_large", "player_image_large", "photo_image_full_size_large",
+	"thumbnail_image", "summary_photo_image", "player_image", "photo_image_full_size",
+}
+
+func (c *Card) value(key string) *CardValue {
+	for i := range c.Legacy.BindingValues {
+		if c.Legacy.BindingValues[i].Key == key {
+			return &c.Legacy.BindingValues[i].Value
+		}
+	}
+	return nil
+}
+
+// String returns the string value of a given key or an empty string if the card doesn't contain it
+func (c *Card) String(key string) string {
+	if v := c.value(key); v != nil {
+		return v.StringValue
+	}
+	return ""
+}
+
+func (c *Card) Title() string {
+	return c.String("title")
+}
+
+func (c *Card) Description() string {
+	return c.String("description")
+}
+
+// Domain returns the domain of the linked page
+func (c *Card) Domain() string {
+	if domain := c.String("vanity_url"); domain != "" {
+		return domain
+	}
+	return c.String("domain")
+}
+
+// Thumbnail returns the preferred preview image of the card or nil if the card doesn't have one
+func (c *Card) Thumbnail() *CardImage {
+	for _, key := range cardThumbnailKeys {
+		if v := c.value(key); v != nil && v.ImageValue != nil && v.ImageValue.Url != "" {
+			return v.ImageValue
+		}
+	}
+	return nil
+}
+
+// IsPoll reports whether the card is a poll
+func (c *Card) IsPoll() bool {
+	return strings.HasPrefix(c.Legacy.Name, "poll")
+}
+
+// Poll returns the options and current counts of a poll card or nil if the card isn't a poll
+func (c *Card) Poll() *Poll {
+	if !c.IsPoll() {
+		return nil
+	}
+	poll := &Poll{}
+	for i := 1; ; i++ {
+		label := c.value("choice" + strconv.Itoa(i) + "_label")
+		if label == nil {
+			break
+		}
+		count, _ := strconv.Atoi(c.String("choice" + strconv.Itoa(i) + "_count"))
+		poll.Options = append(poll.Options, PollOption{Label: label.StringValue, Count: count})
+		poll.Votes += count
+	}
+	if v := c.value("counts_are_final"); v != nil {
+		poll.Final = v.BooleanValue
+	}
+	poll.EndsAt, _ = time.Parse(time.RFC3339, c.String("end_datetime_utc"))
+	if poll.Votes > 0 {
+		for i := range poll.Options {
+			poll.Options[i].Percent = poll.Options[i].Count * 100 / poll.Votes
+		}
+	}
+	return poll
+}
+
+// Id returns the numeric id of a card image hosted as "/card_img/<id>/..." or an empty string
+func (ci *CardImage) Id() string {
+	u, err := url.Parse(ci.Url)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "card_img" {
+			if _, err := strconv.ParseUint(parts[i+1], 10, 64); err == nil {
+				return parts[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// Extension returns the file extension of a card image given by its "format" parameter. It becomes part of the file
+// name, therefore only known image formats are used and "jpg" otherwise.
+func (ci *CardImage) Extension() string {
+	u, err := url.Parse(ci.Url)
+	if err != nil {
+		return "jpg"
+	}
+	switch format := strings.ToLower(u.Query().Get("format")); format {
+	case "jpg", "png", "webp", "gif":
+		return format
+	}
+	return "jpg"
+}
+
+// CardUrl returns the expanded url of the page linked by the card of a tweet
+func (tr *TweetResult) CardUrl() string {
+	if tr.Card == nil {
+		return ""
+	}
+	for _, u := range tr.ContentUrls() {
+		if u.Url == tr.Card.Legacy.Url && u.ExpandedUrl != "" {
+			return u.ExpandedUrl
+		}
+	}
+	if cardUrl := tr.Card.String("card_url"); strings.HasPrefix(cardUrl, "http") {
+		return cardUrl
+	}
+	return tr.Card.Legacy.Url
+}
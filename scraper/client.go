@@ -0,0 +1,455 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"tbm/utils/log"
+	"time"
+)
+
+const (
+	EndpointBookmarks      = "Bookmarks"
+	EndpointTweetDetail    = "TweetDetail"
+	EndpointDeleteBookmark = "DeleteBookmark"
+
+	// RateLimitFallback is used if twitter responds with "429 Too Many Requests" without announcing a reset time
+	RateLimitFallback = 1 * time.Minute
+)
+
+// RateLimit is the request budget of an api endpoint as announced by the "x-rate-limit-*" response headers
+type RateLimit struct {
+	Endpoint  string    `json:"endpoint"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Client performs all http requests of the scraper. Api requests are scheduled using the configured delay and the
+// rate limits announced by twitter.
+type Client struct {
+	mx          sync.Mutex
+	timeout     time.Duration
+	proxy       string
+	configured  bool
+	transport   http.RoundTripper
+	base        http.RoundTripper
+	proxyErr    error
+	custom      http.RoundTripper
+	wrap        func(next http.RoundTripper) http.RoundTripper
+	api         *http.Client
+	download    *http.Client
+	page        *http.Client
+	lastRequest time.Time
+	limits      map[string]*RateLimit
+}
+
+func NewClient() *Client {
+	c := &Client{
+		limits: map[string]*RateLimit{},
+	}
+	c.build()
+	return c
+}
+
+// ParseProxy validates a proxy url. Supported are http, https and socks5 proxies.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.New("unsupported proxy scheme \"" + u.Scheme + "\"")
+	}
+	if u.Host == "" {
+		return nil, errors.New("proxy host missing")
+	}
+	return u, nil
+}
+
+// Configure applies a request timeout and proxy. The clients are only rebuilt if the settings have changed. An invalid
+// proxy is reported and all requests are refused until a valid one is configured, so they are never sent without it.
+func (c *Client) Configure(timeout time.Duration, proxy string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.configured && c.timeout == timeout && c.proxy == proxy {
+		return nil
+	}
+	c.timeout, c.proxy, c.configured = timeout, proxy, true
+	c.build()
+	return c.proxyErr
+}
+
+// SetTransport replaces the underlying transport, e.g. to record or replay requests. Passing nil restores the default
+// transport.
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.custom = rt
+	c.build()
+}
+
+// WrapTransport wraps the current transport, e.g. to record all responses while still honoring the proxy settings
+func (c *Client) WrapTransport(wrap func(next http.RoundTripper) http.RoundTripper) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.wrap = wrap
+	c.build()
+}
+
+func (c *Client) build() {
+	c.proxyErr = nil
+	if c.custom != nil {
+		c.transport = c.custom
+	} else {
+		proxy := http.ProxyFromEnvironment
+		if c.proxy != "" {
+			if u, err := ParseProxy(c.proxy); err == nil {
+				proxy = http.ProxyURL(u)
+			} else {
+				c.proxyErr = errors.New("invalid proxy \"" + c.proxy + "\": " + err.Error())
+			}
+		}
+		c.base = &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			ResponseHeaderTimeout: c.timeout,
+		}
+		c.transport = c.base
+		if c.proxyErr != nil {
+			c.base = refusingTransport{err: c.proxyErr}
+			c.transport = c.base
+		}
+	}
+	if c.wrap != nil {
+		c.transport = c.wrap(c.transport)
+	}
+	c.api = &http.Client{Transport: c.transport, Timeout: c.timeout}
+	// Downloads of large files must not be limited by the request timeout
+	c.download = &http.Client{Transport: c.transport}
+	c.page = &http.Client{
+		Transport: c.pageTransport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkPublicHost(req)
+		},
+	}
+}
+
+// refusingTransport fails every request, it replaces the transport while the configured proxy is invalid
+type refusingTransport struct {
+	err error
+}
+
+func (t refusingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return nil, t.err
+}
+
+// pageTransport returns the transport used for third party pages. Its dialer refuses local and private addresses
+// right before connecting, so a host can't resolve to a public address during the check and to a local one afterwards.
+// Proxies are dialed as is; they resolve the hosts of proxied pages themselves, which are only checked in advance.
+func (c *Client) pageTransport() http.RoundTripper {
+	t, ok := c.base.(*http.Transport)
+	if c.custom != nil || !ok {
+		return c.transport
+	}
+	t = t.Clone()
+
+	var proxies sync.Map
+	proxy := t.Proxy
+	t.Proxy = func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if u != nil {
+			proxies.Store(canonicalAddr(u), true)
+		}
+		return u, err
+	}
+	plain := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	guarded := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errors.New("refused to connect to local or private address \"" + host + "\"")
+			}
+			return nil
+		},
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if _, ok := proxies.Load(addr); ok {
+			return plain.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+	if c.wrap != nil {
+		return c.wrap(t)
+	}
+	return t
+}
+
+// canonicalAddr returns the host and port of a proxy url, using the default port of its scheme if none is given
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		case "socks5":
+			port = "1080"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Do sends a request using the configured timeout
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	c.mx.Lock()
+	client := c.api
+	c.mx.Unlock()
+
+	return client.Do(req)
+}
+
+// Download sends a request without an overall timeout, the body of the response might be read as long as it takes
+func (c *Client) Download(req *http.Request) (*http.Response, error) {
+	c.mx.Lock()
+	client := c.download
+	c.mx.Unlock()
+
+	return client.Do(req)
+}
+
+// FetchPage requests a third party web page without an overall timeout. Requests to local and private hosts are
+// refused, including redirects to them, so linked pages can't reach services within the local network.
+func (c *Client) FetchPage(req *http.Request) (*http.Response, error) {
+	if err := checkPublicHost(req); err != nil {
+		return nil, err
+	}
+	c.mx.Lock()
+	client := c.page
+	c.mx.Unlock()
+
+	return client.Do(req)
+}
+
+// checkPublicHost resolves the host of a request and fails if any of its addresses isn't public. The dialer of the
+// page transport checks the address actually connected to as well, this check covers proxied requests in advance.
+func checkPublicHost(req *http.Request) error {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return errors.New("unsupported scheme \"" + req.URL.Scheme + "\"")
+	}
+	host := req.URL.Hostname()
+	ips := make([]net.IP, 0)
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return errors.New("refused to request local or private host \"" + host + "\"")
+		}
+	}
+	return nil
+}
+
+var (
+	// nonPublicNetworks lists reserved networks not covered by the methods of net.IP
+	nonPublicNetworks = parseNetworks("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")
+	// nat64Prefix embeds ipv4 addresses within ipv6 addresses
+	nat64Prefix = parseNetworks("64:ff9b::/96")[0]
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, n)
+	}
+	return networks
+}
+
+// isPublicIP reports whether an address is neither a loopback, link-local, private, shared, multicast nor unspecified
+// address. IPv4 addresses mapped into or embedded within ipv6 addresses are checked as ipv4 addresses.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if nat64Prefix.Contains(ip) {
+		ip = ip[12:16]
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// DoApi waits until the given endpoint may be requested again, sends the request and updates the rate limit of the
+// endpoint from the response headers
+func (c *Client) DoApi(endpoint string, delay time.Duration, req *http.Request) (*http.Response, error) {
+	if err := c.wait(req.Context(), endpoint, delay); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.update(endpoint, resp)
+
+	return resp, nil
+}
+
+// wait blocks until the next request slot and reserves it, unless the context gets canceled first
+func (c *Client) wait(ctx context.Context, endpoint string, delay time.Duration) error {
+	for {
+		c.mx.Lock()
+		next := c.nextRequest(endpoint, delay)
+		now := time.Now()
+		if !next.After(now) {
+			c.lastRequest = now
+			c.mx.Unlock()
+			return nil
+		}
+		c.mx.Unlock()
+
+		d := next.Sub(now)
+		if d > 2*delay && d > time.Minute {
+			log.Warning("Rate limit of %s reached, next request at %s", endpoint, next.Format(time.RFC3339))
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// NextRequest returns the earliest time the given endpoint may be requested
+func (c *Client) NextRequest(endpoint string, delay time.Duration) time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.nextRequest(endpoint, delay)
+}
+
+// nextRequest keeps the configured delay between two requests. If the remaining budget of an endpoint is known, its
+// requests are spread evenly until the budget resets.
+func (c *Client) nextRequest(endpoint string, delay time.Duration) time.Time {
+	now := time.Now()
+	next := now
+	if !c.lastRequest.IsZero() {
+		next = c.lastRequest.Add(delay)
+	}
+
+	if l, ok := c.limits[endpoint]; ok && now.Before(l.Reset) {
+		var limited time.Time
+		if l.Remaining <= 0 {
+			limited = l.Reset
+		} else {
+			limited = l.UpdatedAt.Add(l.Reset.Sub(l.UpdatedAt) / time.Duration(l.Remaining))
+		}
+		if limited.After(next) {
+			next = limited
+		}
+	}
+	if next.Before(now) {
+		return now
+	}
+	return next
+}
+
+func (c *Client) update(endpoint string, resp *http.Response) {
+	now := time.Now()
+	limit, lErr := strconv.Atoi(resp.Header.Get("x-rate-limit-limit"))
+	remaining, rErr := strconv.Atoi(resp.Header.Get("x-rate-limit-remaining"))
+	reset, tErr := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	l, ok := c.limits[endpoint]
+	if !ok {
+		l = &RateLimit{Endpoint: endpoint}
+	}
+	if rErr == nil && tErr == nil {
+		if lErr == nil {
+			l.Limit = limit
+		}
+		l.Remaining = remaining
+		l.Reset = time.Unix(reset, 0)
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		l.Remaining = 0
+		l.Reset = now.Add(RateLimitFallback)
+	} else {
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.Remaining = 0
+	}
+	l.UpdatedAt = now
+	c.limits[endpoint] = l
+}
+
+// RateLimits returns the last known budget of all requested endpoints
+func (c *Client) RateLimits() []RateLimit {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	limits := make([]RateLimit, 0, len(c.limits))
+	for _, l := range c.limits {
+		limits = append(limits, *l)
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Endpoint < limits[j].Endpoint
+	})
+	return limits
+}
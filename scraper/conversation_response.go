@@ -1,78 +1,17 @@
 package scraper
 
+import "encoding/json"
+
 type ConversationResponse struct {
 	GlobalObjects struct {
 		Tweets map[string]TweetResult      `json:"tweets"`
 		Users  map[string]ConversationUser `json:"users"`
 	} `json:"globalObjects"`
-	Timeline struct {
-		Instructions []struct {
-			AddEntries struct {
-				Entries []struct {
-					Content struct {
-						Item struct {
-							Content struct {
-								Tweet struct {
-									ID string `json:"id"`
-								} `json:"tweet"`
-								User struct {
-									ID string `json:"id"`
-								} `json:"user"`
-							} `json:"content"`
-						} `json:"item"`
-						Operation struct {
-							Cursor struct {
-								Value      string `json:"value"`
-								CursorType string `json:"cursorType"`
-							} `json:"cursor"`
-						} `json:"operation"`
-						TimelineModule struct {
-							Items []struct {
-								Item struct {
-									ClientEventInfo struct {
-										Details struct {
-											GuideDetails struct {
-												TransparentGuideDetails struct {
-													TrendMetadata struct {
-														TrendName string `json:"trendName"`
-													} `json:"trendMetadata"`
-												} `json:"transparentGuideDetails"`
-											} `json:"guideDetails"`
-										} `json:"details"`
-									} `json:"clientEventInfo"`
-								} `json:"item"`
-							} `json:"items"`
-						} `json:"timelineModule"`
-					} `json:"content,omitempty"`
-				} `json:"entries"`
-			} `json:"addEntries"`
-			PinEntry struct {
-				Entry struct {
-					Content struct {
-						Item struct {
-							Content struct {
-								Tweet struct {
-									ID string `json:"id"`
-								} `json:"tweet"`
-							} `json:"content"`
-						} `json:"item"`
-					} `json:"content"`
-				} `json:"entry"`
-			} `json:"pinEntry,omitempty"`
-			ReplaceEntry struct {
-				Entry struct {
-					Content struct {
-						Operation struct {
-							Cursor struct {
-								Value      string `json:"value"`
-								CursorType string `json:"cursorType"`
-							} `json:"cursor"`
-						} `json:"operation"`
-					} `json:"content"`
-				} `json:"entry"`
-			} `json:"replaceEntry,omitempty"`
-		} `json:"instructions"`
-	} `json:"timeline"`
+
+	// Pages holds the raw TweetDetail responses the conversation has been built from
+	Pages []json.RawMessage `json:"-"`
+	// Linked holds all quoted tweets and retweeted originals included within the pages
+	Linked []*CachedTweet `json:"-"`
 }
 
 type ConversationUser struct {
@@ -121,3 +60,126 @@ func (c *ConversationResponse) GetUser(userId string) *ConversationUser {
 	}
 	return &ConversationUser{}
 }
+
+func NewConversationResponse() *ConversationResponse {
+	c := &ConversationResponse{}
+	c.GlobalObjects.Tweets = map[string]TweetResult{}
+	c.GlobalObjects.Users = map[string]ConversationUser{}
+	return c
+}
+
+func NewConversationUser(user UserResult) ConversationUser {
+	cu := ConversationUser{
+		CreatedAt:            user.Legacy.CreatedAt,
+		Description:          user.Legacy.Description,
+		FavouritesCount:      user.Legacy.FavouritesCount,
+		FollowersCount:       user.Legacy.FollowersCount,
+		FriendsCount:         user.Legacy.FriendsCount,
+		IdStr:                user.RestId,
+		ListedCount:          user.Legacy.ListedCount,
+		Name:                 user.Legacy.Name,
+		Location:             user.Legacy.Location,
+		PinnedTweetIdsStr:    user.Legacy.PinnedTweetIdsStr,
+		ProfileBannerUrl:     user.Legacy.ProfileBannerUrl,
+		ProfileImageUrlHttps: user.Legacy.ProfileImageUrlHttps,
+		Protected:            user.Legacy.Protected,
+		ScreenName:           user.Legacy.ScreenName,
+		StatusesCount:        user.Legacy.StatusesCount,
+		Verified:             user.Legacy.Verified,
+	}
+	for _, u := range user.Legacy.Entities.Url.Urls {
+		cu.Entities.Url.Urls = append(cu.Entities.Url.Urls, struct {
+			ExpandedUrl string `json:"expanded_url"`
+		}{ExpandedUrl: u.ExpandedUrl})
+	}
+	return cu
+}
+
+// NewUserResult converts a conversation user back into a user result. Only the basic profile details are available.
+func NewUserResult(cu ConversationUser) UserResult {
+	user := UserResult{
+		TypeName: "User",
+		RestId:   cu.IdStr,
+	}
+	user.Legacy.CreatedAt = cu.CreatedAt
+	user.Legacy.Description = cu.Description
+	user.Legacy.FavouritesCount = cu.FavouritesCount
+	user.Legacy.FollowersCount = cu.FollowersCount
+	user.Legacy.FriendsCount = cu.FriendsCount
+	user.Legacy.ListedCount = cu.ListedCount
+	user.Legacy.Name = cu.Name
+	user.Legacy.Location = cu.Location
+	user.Legacy.PinnedTweetIdsStr = cu.PinnedTweetIdsStr
+	user.Legacy.ProfileBannerUrl = cu.ProfileBannerUrl
+	user.Legacy.ProfileImageUrlHttps = cu.ProfileImageUrlHttps
+	user.Legacy.Protected = cu.Protected
+	user.Legacy.ScreenName = cu.ScreenName
+	user.Legacy.StatusesCount = cu.StatusesCount
+	user.Legacy.Verified = cu.Verified
+	return user
+}
+
+// AddTweet adds a single tweet and its author to the conversation
+func (c *ConversationResponse) AddTweet(results *TweetResults) bool {
+	block := results.Result.Block()
+	if block.Legacy.IdStr == "" {
+		return false
+	}
+	if c.GlobalObjects.Tweets == nil {
+		c.GlobalObjects.Tweets = map[string]TweetResult{}
+	}
+	if c.GlobalObjects.Users == nil {
+		c.GlobalObjects.Users = map[string]ConversationUser{}
+	}
+
+	tweet := block.TweetResult()
+	user := block.Core.UserResults.Result
+	c.Linked = append(c.Linked, block.LinkedTweets()...)
+	if tweet.UserIdStr == "" {
+		tweet.UserIdStr = user.RestId
+	}
+	c.GlobalObjects.Tweets[tweet.IdStr] = tweet
+	if user.RestId != "" {
+		c.GlobalObjects.Users[user.RestId] = NewConversationUser(user)
+	}
+	return true
+}
+
+// AddPage merges a TweetDetail page into the conversation and returns all
+// cursors pointing to replies which haven't been fetched yet
+func (c *ConversationResponse) AddPage(page *TweetDetailResponse) []string {
+	cursors := make([]string, 0)
+	addItem := func(ic *TweetDetailItemContent) {
+		if cursor := ic.Cursor(); cursor != "" {
+			cursors = append(cursors, cursor)
+		} else if ic.ItemType == "TimelineTweet" {
+			c.AddTweet(&ic.TweetResults)
+		}
+	}
+
+	for _, instruction := range page.Data.ThreadedConversation.Instructions {
+		switch instruction.Type {
+		case "TimelineAddEntries":
+			for _, entry := range instruction.Entries {
+				switch entry.Content.EntryType {
+				case "TimelineTimelineItem":
+					addItem(&entry.Content.ItemContent)
+				case "TimelineTimelineModule":
+					for _, item := range entry.Content.Items {
+						addItem(&item.Item.ItemContent)
+					}
+				case "TimelineTimelineCursor":
+					if isReplyCursor(entry.Content.CursorType) {
+						cursors = append(cursors, entry.Content.Value)
+					}
+				}
+			}
+		case "TimelineAddToModule":
+			for _, item := range instruction.ModuleItems {
+				addItem(&item.Item.ItemContent)
+			}
+		}
+	}
+
+	return cursors
+}
@@ -0,0 +1,70 @@
+package scraper
+
+// NewLinkedTweet builds a record of a quoted tweet or a retweeted original, whose conversation only consists of the
+// tweet itself. Nil is returned for unavailable tweets.
+func NewLinkedTweet(results *TweetResults) *CachedTweet {
+	if results == nil {
+		return nil
+	}
+	block := results.Result.Block()
+	if block.Legacy.IdStr == "" {
+		return nil
+	}
+	ct := &CachedTweet{
+		User:  block.Core.UserResults.Result,
+		Tweet: block.TweetResult(),
+	}
+	if ct.Tweet.UserIdStr == "" {
+		ct.Tweet.UserIdStr = ct.User.RestId
+	}
+	conversation := NewConversationResponse()
+	conversation.AddTweet(results)
+	ct.Conversation = *conversation
+	return ct
+}
+
+// LinkedTweets returns the quoted tweet and the retweeted original of a tweet, if they are included
+func (b *TweetResultBlock) LinkedTweets() []*CachedTweet {
+	linked := make([]*CachedTweet, 0)
+	for _, results := range []*TweetResults{b.QuotedStatusResult, b.Legacy.RetweetedStatusResult} {
+		if ct := NewLinkedTweet(results); ct != nil {
+			linked = append(linked, ct)
+		}
+	}
+	return linked
+}
+
+// LinkedIds returns the ids of all quoted tweets and retweeted originals referenced by the tweet and its conversation
+func (ct *CachedTweet) LinkedIds() []string {
+	ids := make([]string, 0)
+	add := func(tweet *TweetResult) {
+		for _, id := range []string{tweet.QuotedStatusIDStr, tweet.RetweetedStatusIDStr} {
+			if id != "" && id != ct.Tweet.IdStr {
+				ids, _ = addString(ids, id)
+			}
+		}
+	}
+	add(&ct.Tweet)
+	for _, tweet := range ct.Conversation.GlobalObjects.Tweets {
+		add(&tweet)
+	}
+	return ids
+}
+
+// EmbedLinked attaches the quoted tweet and the retweeted original to every thread item, if found within linked
+func EmbedLinked(thread map[string]*ThreadItem, linked map[string]*CachedTweet) {
+	item := func(id string) *ThreadItem {
+		l, ok := linked[id]
+		if !ok || id == "" {
+			return nil
+		}
+		return &ThreadItem{
+			Tweet: l.Tweet,
+			User:  NewConversationUser(l.User),
+		}
+	}
+	for _, ti := range thread {
+		ti.Quoted = item(ti.Tweet.QuotedStatusIDStr)
+		ti.Retweeted = item(ti.Tweet.RetweetedStatusIDStr)
+	}
+}
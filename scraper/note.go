@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Note is a personal markdown note attached to an archived tweet or to one of the replies in its thread
+type Note struct {
+	Id        string    `json:"id"`
+	TweetId   string    `json:"tweet_id"`
+	Highlight string    `json:"highlight,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HasThreadTweet checks if the given id belongs to the tweet itself or to a tweet within its conversation
+func (ct *CachedTweet) HasThreadTweet(tweetId string) bool {
+	if tweetId == ct.Tweet.IdStr {
+		return true
+	}
+	_, ok := ct.Conversation.GlobalObjects.Tweets[tweetId]
+	return ok
+}
+
+func (ct *CachedTweet) AddNote(tweetId, highlight, text string) *Note {
+	now := time.Now()
+	note := Note{
+		Id:        strconv.FormatInt(now.UnixNano(), 36),
+		TweetId:   tweetId,
+		Highlight: strings.TrimSpace(highlight),
+		Text:      strings.TrimSpace(text),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ct.Notes = append(ct.Notes, note)
+	return &ct.Notes[len(ct.Notes)-1]
+}
+
+func (ct *CachedTweet) GetNote(id string) *Note {
+	for i := range ct.Notes {
+		if ct.Notes[i].Id == id {
+			return &ct.Notes[i]
+		}
+	}
+	return nil
+}
+
+func (ct *CachedTweet) UpdateNote(id, highlight, text string) *Note {
+	note := ct.GetNote(id)
+	if note != nil {
+		note.Highlight = strings.TrimSpace(highlight)
+		note.Text = strings.TrimSpace(text)
+		note.UpdatedAt = time.Now()
+	}
+	return note
+}
+
+func (ct *CachedTweet) RemoveNote(id string) bool {
+	for i, note := range ct.Notes {
+		if note.Id == id {
+			ct.Notes = append(ct.Notes[:i], ct.Notes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// NotesFor returns all notes attached to a given tweet of the thread
+func (ct *CachedTweet) NotesFor(tweetId string) []Note {
+	var notes []Note
+	for _, note := range ct.Notes {
+		if note.TweetId == tweetId {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
@@ -0,0 +1,114 @@
+package scraper
+
+import (
+	"html"
+	"strings"
+)
+
+type TweetUrl struct {
+	DisplayUrl  string `json:"display_url"`
+	ExpandedUrl string `json:"expanded_url"`
+	Url         string `json:"url"`
+	Indices     []int  `json:"indices"`
+}
+
+type Hashtag struct {
+	Indices []int  `json:"indices"`
+	Text    string `json:"text"`
+}
+
+// NoteTweetResults wraps the content of a long-form tweet, whose legacy "full_text" is truncated
+type NoteTweetResults struct {
+	IsExpandable     bool `json:"is_expandable"`
+	NoteTweetResults struct {
+		Result NoteTweet `json:"result"`
+	} `json:"note_tweet_results"`
+}
+
+// NoteTweet is the complete text of a long-form tweet including its entities and formatting
+type NoteTweet struct {
+	Id        string `json:"id"`
+	Text      string `json:"text"`
+	EntitySet struct {
+		Hashtags     []Hashtag          `json:"hashtags"`
+		Urls         []TweetUrl         `json:"urls"`
+		UserMentions []ConversationUser `json:"user_mentions"`
+	} `json:"entity_set"`
+	Richtext struct {
+		RichtextTags []RichtextTag `json:"richtext_tags"`
+	} `json:"richtext"`
+}
+
+// RichtextTag formats the characters between both indices, e.g. as "Bold" or "Italic"
+type RichtextTag struct {
+	FromIndex     int      `json:"from_index"`
+	ToIndex       int      `json:"to_index"`
+	RichtextTypes []string `json:"richtext_types"`
+}
+
+var richtextElements = map[string]string{
+	"Bold":   "strong",
+	"Italic": "em",
+}
+
+// Html returns the escaped text including its formatting and line breaks
+func (nt *NoteTweet) Html() string {
+	opening := map[int][]string{}
+	closing := map[int][]string{}
+	for _, tag := range nt.Richtext.RichtextTags {
+		for _, t := range tag.RichtextTypes {
+			if element, ok := richtextElements[t]; ok && tag.FromIndex < tag.ToIndex {
+				opening[tag.FromIndex] = append(opening[tag.FromIndex], "<"+element+">")
+				closing[tag.ToIndex] = append([]string{"</" + element + ">"}, closing[tag.ToIndex]...)
+			}
+		}
+	}
+
+	buf := &strings.Builder{}
+	runes := []rune(html.UnescapeString(nt.Text))
+	for i := 0; i <= len(runes); i++ {
+		buf.WriteString(strings.Join(closing[i], ""))
+		if i == len(runes) {
+			break
+		}
+		buf.WriteString(strings.Join(opening[i], ""))
+		if runes[i] == '\n' {
+			buf.WriteString("<br>")
+		} else {
+			buf.WriteString(html.EscapeString(string(runes[i])))
+		}
+	}
+	return buf.String()
+}
+
+// Content returns the complete text of a tweet, which is the text of the note for long-form tweets
+func (tr *TweetResult) Content() string {
+	if tr.NoteTweet != nil {
+		return tr.NoteTweet.Text
+	}
+	return tr.FullText
+}
+
+// ContentUrls returns all urls within the complete text of a tweet
+func (tr *TweetResult) ContentUrls() []TweetUrl {
+	if tr.NoteTweet != nil {
+		return tr.NoteTweet.EntitySet.Urls
+	}
+	return tr.Entities.Urls
+}
+
+// ContentHashtags returns all hashtags within the complete text of a tweet
+func (tr *TweetResult) ContentHashtags() []Hashtag {
+	if tr.NoteTweet != nil {
+		return tr.NoteTweet.EntitySet.Hashtags
+	}
+	return tr.Entities.Hashtags
+}
+
+// ContentMentions returns all mentioned users within the complete text of a tweet
+func (tr *TweetResult) ContentMentions() []ConversationUser {
+	if tr.NoteTweet != nil {
+		return tr.NoteTweet.EntitySet.UserMentions
+	}
+	return tr.Entities.UserMentions
+}
@@ -0,0 +1,83 @@
+package scraper
+
+import "time"
+
+// Progress events reported while a run pages through the bookmark timeline
+const (
+	ProgressRunStarted     = "run.started"
+	ProgressPageStarted    = "page.started"
+	ProgressPageFinished   = "page.finished"
+	ProgressCursorAdvanced = "cursor.advanced"
+	ProgressApiError       = "api.error"
+	ProgressRunFinished    = "run.finished"
+)
+
+// Results of a finished run
+const (
+	ResultCompleted = "completed"
+	ResultCanceled  = "canceled"
+	ResultFailed    = "failed"
+)
+
+// Progress describes the latest step of the current or last run through the bookmark timeline
+type Progress struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	StartedAt time.Time `json:"started_at"`
+	Running   bool      `json:"running"`
+	// Page counts the pages requested by the run, Attempt the requests of the current page
+	Page    int    `json:"page"`
+	Attempt int    `json:"attempt"`
+	Cursor  string `json:"cursor"`
+	// Entries and Empty count the tweets of the last finished page, Total* those of the whole run
+	Entries      int `json:"entries"`
+	Empty        int `json:"empty"`
+	TotalEntries int `json:"total_entries"`
+	TotalEmpty   int `json:"total_empty"`
+	// Error is the api error of the current page or the error the run failed with, Result is set once the run is
+	// finished
+	Error  string `json:"error,omitempty"`
+	Result string `json:"result,omitempty"`
+}
+
+type ProgressFunc func(p Progress)
+
+// Progress returns the state of the current or last run
+func (s *Scraper) Progress() Progress {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.progress
+}
+
+// report applies fn to the progress of the current run and passes the resulting event to OnProgress
+func (s *Scraper) report(event string, fn func(p *Progress)) {
+	s.mx.Lock()
+	if fn != nil {
+		fn(&s.progress)
+	}
+	s.progress.Event = event
+	s.progress.Time = time.Now()
+	s.progress.Cursor = s.cursor
+	p := s.progress
+	s.mx.Unlock()
+
+	if s.OnProgress != nil {
+		s.OnProgress(p)
+	}
+}
+
+// finish records the result of the current run, reports it and marks the scraper as idle
+func (s *Scraper) finish(result string, err error) {
+	s.mx.Lock()
+	s.progress.Running = false
+	s.progress.Result = result
+	if err != nil {
+		s.progress.Error = err.Error()
+	}
+	s.record(time.Now())
+	s.mx.Unlock()
+
+	s.report(ProgressRunFinished, nil)
+	s.free()
+}
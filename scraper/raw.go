@@ -0,0 +1,77 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RawTweet holds the unparsed api payloads a tweet has been built from. Fields not modelled by CachedTweet remain
+// available this way and can be parsed once the model gets extended.
+type RawTweet struct {
+	Id string `json:"id"`
+	// Bookmark is the "tweet_results" object of the bookmark timeline entry
+	Bookmark json.RawMessage `json:"bookmark,omitempty"`
+	// Details are all TweetDetail pages of the conversation
+	Details   []json.RawMessage `json:"details,omitempty"`
+	FetchedAt time.Time         `json:"fetched_at"`
+}
+
+// Parse rebuilds the user, tweet and conversation of a tweet from its raw payloads. User and tweet are taken from the
+// conversation if the bookmark payload is missing, e.g. for enriched imports.
+func (r *RawTweet) Parse() (*CachedTweet, error) {
+	ct := &CachedTweet{}
+	if len(r.Bookmark) > 0 {
+		tr := &TweetResults{}
+		if err := json.Unmarshal(r.Bookmark, tr); err != nil {
+			return nil, err
+		}
+		block := tr.Result.Block()
+		ct.User = block.Core.UserResults.Result
+		ct.Tweet = block.TweetResult()
+		ct.Linked = block.LinkedTweets()
+	}
+
+	conversation := NewConversationResponse()
+	for _, raw := range r.Details {
+		page := &TweetDetailResponse{}
+		if err := json.Unmarshal(raw, page); err != nil {
+			return nil, err
+		}
+		conversation.AddPage(page)
+	}
+	ct.Conversation = *conversation
+	ct.Linked = append(ct.Linked, conversation.Linked...)
+
+	if ct.Tweet.IdStr == "" {
+		tweet, ok := conversation.GlobalObjects.Tweets[r.Id]
+		if !ok {
+			return nil, errors.New("tweet " + r.Id + " not found in raw payloads")
+		}
+		ct.Tweet = tweet
+	}
+	if ct.User.RestId == "" {
+		cu, ok := conversation.GlobalObjects.Users[ct.Tweet.UserIdStr]
+		if !ok {
+			return nil, errors.New("author of tweet " + r.Id + " not found in raw payloads")
+		}
+		ct.User = NewUserResult(cu)
+	}
+
+	return ct, nil
+}
+
+// rawTweetResults extracts the "tweet_results" object of a raw timeline entry
+func rawTweetResults(entry json.RawMessage) json.RawMessage {
+	e := &struct {
+		Content struct {
+			ItemContent struct {
+				TweetResults json.RawMessage `json:"tweet_results"`
+			} `json:"itemContent"`
+		} `json:"content"`
+	}{}
+	if err := json.Unmarshal(entry, e); err != nil {
+		return nil
+	}
+	return e.Content.ItemContent.TweetResults
+}
@@ -0,0 +1,195 @@
+package scraper
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"tbm/utils/log"
+	"time"
+)
+
+const (
+	DriftUnknownTypename = "unknown_typename"
+	DriftMissingField    = "missing_field"
+)
+
+// knownTypenames lists all "__typename" values the parser understands, by the path they appear at
+var knownTypenames = map[string][]string{
+	"content":                  {"TimelineTimelineItem", "TimelineTimelineCursor", "TimelineTimelineModule"},
+	"itemContent":              {"TimelineTweet", "TimelineTimelineCursor"},
+	"tweet_results.result":     {"Tweet", "TweetWithVisibilityResults", "TweetTombstone", "TweetUnavailable"},
+	"core.user_results.result": {"User", "UserUnavailable"},
+}
+
+// requiredTweetFields have to be present within every tweet, relative to the block carrying the tweet data
+var requiredTweetFields = []string{
+	"rest_id",
+	"legacy.id_str",
+	"legacy.full_text",
+	"legacy.created_at",
+	"core.user_results.result.rest_id",
+	"core.user_results.result.legacy.screen_name",
+	"core.user_results.result.legacy.name",
+}
+
+// Drift is a deviation of a twitter response from the schema known to the parser
+type Drift struct {
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Value     string    `json:"value,omitempty"`
+	EntryId   string    `json:"entry_id"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// DriftReport collects all schema deviations found since the start. Every deviation is only logged once.
+type DriftReport struct {
+	mx     sync.Mutex
+	drifts map[string]*Drift
+}
+
+func NewDriftReport() *DriftReport {
+	return &DriftReport{
+		drifts: map[string]*Drift{},
+	}
+}
+
+func (r *DriftReport) add(kind, path, value, entryId string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := time.Now()
+	key := kind + ":" + path + ":" + value
+	d, ok := r.drifts[key]
+	if !ok {
+		d = &Drift{Kind: kind, Path: path, Value: value, FirstSeen: now}
+		r.drifts[key] = d
+
+		if kind == DriftUnknownTypename {
+			log.Warning("twitter: unknown __typename \"%s\" at %s of %s, the response format might have changed", value, path, entryId)
+		} else {
+			log.Warning("twitter: required field %s missing in %s, the response format might have changed", path, entryId)
+		}
+	}
+	d.EntryId = entryId
+	d.Count++
+	d.LastSeen = now
+}
+
+// Drifts returns all deviations, the most recent first
+func (r *DriftReport) Drifts() []Drift {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	drifts := make([]Drift, 0, len(r.drifts))
+	for _, d := range r.drifts {
+		drifts = append(drifts, *d)
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if !drifts[i].LastSeen.Equal(drifts[j].LastSeen) {
+			return drifts[i].LastSeen.After(drifts[j].LastSeen)
+		}
+		return drifts[i].Path < drifts[j].Path
+	})
+	return drifts
+}
+
+// CheckEntry compares the raw json of a bookmark timeline entry against the known typenames and required fields and
+// records every deviation
+func (r *DriftReport) CheckEntry(raw json.RawMessage) {
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return
+	}
+	entryId, _ := entry["entryId"].(string)
+
+	content, _ := lookup(entry, "content").(map[string]interface{})
+	r.checkTypename("content", "content", content, entryId)
+	if entryType, _ := content["entryType"].(string); entryType != "TimelineTimelineItem" {
+		return
+	}
+
+	itemContent, _ := lookup(content, "itemContent").(map[string]interface{})
+	r.checkTypename("itemContent", "content.itemContent", itemContent, entryId)
+
+	result, ok := lookup(itemContent, "tweet_results.result").(map[string]interface{})
+	if !ok || len(result) == 0 {
+		// Deleted tweets come without any data
+		return
+	}
+	prefix := "content.itemContent.tweet_results.result."
+	r.checkTypename("tweet_results.result", strings.TrimSuffix(prefix, "."), result, entryId)
+
+	switch result["__typename"] {
+	case "TweetTombstone", "TweetUnavailable":
+		return
+	case "TweetWithVisibilityResults":
+		result, _ = result["tweet"].(map[string]interface{})
+		prefix += "tweet."
+	}
+	r.checkTypename("core.user_results.result", prefix+"core.user_results.result", lookup(result, "core.user_results.result"), entryId)
+
+	for _, field := range requiredTweetFields {
+		if v := lookup(result, field); v == nil || v == "" {
+			r.add(DriftMissingField, prefix+field, "", entryId)
+		}
+	}
+}
+
+// checkTypename looks up the known typenames by their schema location and reports deviations using the full path
+func (r *DriftReport) checkTypename(location, path string, v interface{}, entryId string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	typename, ok := m["__typename"].(string)
+	if !ok {
+		return
+	}
+	for _, known := range knownTypenames[location] {
+		if typename == known {
+			return
+		}
+	}
+	r.add(DriftUnknownTypename, path, typename, entryId)
+}
+
+// lookup returns the value at a dot separated path or nil if any part is missing
+func lookup(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[key]; !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+// rawBookmarkEntries extracts the raw json of every timeline entry, in the same order as they are parsed into a
+// BookmarkResponse
+func rawBookmarkEntries(body []byte) [][]json.RawMessage {
+	rb := &struct {
+		Data struct {
+			BookmarkTimeline struct {
+				Timeline struct {
+					Instructions []struct {
+						Entries []json.RawMessage `json:"entries"`
+					} `json:"instructions"`
+				} `json:"timeline"`
+			} `json:"bookmark_timeline_v2"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, rb); err != nil {
+		return nil
+	}
+	entries := make([][]json.RawMessage, 0, len(rb.Data.BookmarkTimeline.Timeline.Instructions))
+	for _, instruction := range rb.Data.BookmarkTimeline.Timeline.Instructions {
+		entries = append(entries, instruction.Entries)
+	}
+	return entries
+}
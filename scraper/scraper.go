@@ -2,6 +2,7 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,28 +19,56 @@ import (
 )
 
 const (
-	FetchInterval  = 1 * time.Minute
-	CursorFilename = ".cursor.tmp"
+	FetchInterval        = 1 * time.Minute
+	CursorFilename       = ".cursor.tmp"
+	MaxConversationPages = 50
+	DefaultDelay         = 30 * time.Second
+	DefaultTimeout       = 10 * time.Second
+
+	DefaultWebUrl    = "https://twitter.com"
+	DefaultAssetsUrl = "https://abs.twimg.com"
 )
 
+// ErrRunning is returned by operations which can't be performed during a run
+var ErrRunning = errors.New("the bookmark timeline is being fetched")
+
 type Scraper struct {
 	AccessToken string `json:"access_token"`
 	csrfToken   string
 	Cookie      string   `json:"cookie"`
 	Sections    Sections `json:"sections"`
+	Urls        Urls     `json:"urls"`
 	variables   map[string]interface{}
 	features    map[string]interface{}
 	cursor      string
 	jsAppendix  string
 
+	// StateFile persists the cursor of the bookmark timeline and the run history between restarts
+	StateFile string `json:"-"`
+	// LegacyCursorFile is the file former versions stored the cursor in. It is migrated into a new state file.
+	LegacyCursorFile string `json:"-"`
+	// OnProgress is called with every step of a run through the bookmark timeline
+	OnProgress ProgressFunc `json:"-"`
+
 	mx         sync.RWMutex
 	close      chan bool
+	stopped    chan bool
 	running    bool
+	canceled   bool
+	done       chan bool
+	ctx        context.Context
+	cancelRun  context.CancelFunc
+	paused     bool
+	state      State
+	nextRun    time.Time
+	progress   Progress
 	onNewTweet OnNewTweetFunc
+	drift      *DriftReport
 
-	Delay       time.Duration `json:"-"`
-	Timeout     time.Duration `json:"-"`
-	lastRequest time.Time
+	Delay   time.Duration `json:"-"`
+	Timeout time.Duration `json:"-"`
+	Proxy   string        `json:"proxy"`
+	client  *Client
 
 	RawTimeout string `json:"timeout"`
 	RawDelay   string `json:"delay"`
@@ -51,24 +80,36 @@ type Sections struct {
 	Detail string `json:"detail"`
 }
 
+// Urls point to twitter by default and can be changed to run the scraper against another server, e.g. in tests
+type Urls struct {
+	Web    string `json:"web"`
+	Assets string `json:"assets"`
+}
+
 type OnNewTweetFunc func(ct *CachedTweet) bool
 
 func NewScraper(onNewTweet OnNewTweetFunc) *Scraper {
 	return &Scraper{
-		AccessToken: "",
-		csrfToken:   "",
-		Cookie:      "",
-		cursor:      "",
-		jsAppendix:  "",
-		running:     false,
-		onNewTweet:  onNewTweet,
+		AccessToken:      "",
+		csrfToken:        "",
+		Cookie:           "",
+		cursor:           "",
+		jsAppendix:       "",
+		LegacyCursorFile: CursorFilename,
+		running:          false,
+		onNewTweet:       onNewTweet,
+		drift:            NewDriftReport(),
 		Sections: Sections{
 			Index:  "",
 			Remove: "",
 		},
-		Delay:       time.Second * 30,
-		Timeout:     time.Second * 10,
-		lastRequest: time.Time{},
+		Urls: Urls{
+			Web:    DefaultWebUrl,
+			Assets: DefaultAssetsUrl,
+		},
+		Delay:   DefaultDelay,
+		Timeout: DefaultTimeout,
+		client:  NewClient(),
 		variables: map[string]interface{}{
 			"count":                  20,
 			"cursor":                 "",
@@ -107,7 +148,7 @@ func NewScraper(onNewTweet OnNewTweetFunc) *Scraper {
 
 func (s *Scraper) Start(removeBookmarks bool) {
 	s.LoadCsrfToken()
-	if s.Sections.Index == "" || s.Sections.Remove == "" || s.AccessToken == "" {
+	if s.Sections.Index == "" || s.Sections.Remove == "" || s.Sections.Detail == "" || s.AccessToken == "" {
 		if err := s.LoadSections(); err != nil {
 			log.Error(err)
 			return
@@ -115,22 +156,30 @@ func (s *Scraper) Start(removeBookmarks bool) {
 	}
 	log.Info("Scraper started")
 
-	if b, err := os.ReadFile(CursorFilename); err == nil {
-		s.cursor = string(b)
+	if !s.IsPaused() {
+		s.Run(removeBookmarks)
 	}
-
-	go s.Run(removeBookmarks)
-	s.close = make(chan bool)
+	closed, stopped := make(chan bool), make(chan bool)
+	s.mx.Lock()
+	s.close, s.stopped = closed, stopped
+	s.mx.Unlock()
+	s.schedule()
 
 	ticker := time.NewTicker(FetchInterval)
 	go func() {
+		defer close(stopped)
 		for {
 			select {
 			case <-ticker.C:
-				s.Run(removeBookmarks)
-			case <-s.close:
+				s.schedule()
+				if !s.IsPaused() {
+					s.Run(removeBookmarks)
+				}
+			case <-closed:
 				ticker.Stop()
-				s.close = nil
+				s.mx.Lock()
+				s.nextRun = time.Time{}
+				s.mx.Unlock()
 				log.Warning("Scraper stopped")
 				return
 			}
@@ -138,35 +187,177 @@ func (s *Scraper) Start(removeBookmarks bool) {
 	}()
 }
 
+// Stop ends the scheduled runs, cancels the active run and waits until it is finished. Afterwards the settings of
+// the scraper can be changed safely and it can be started again right away.
 func (s *Scraper) Stop() {
-	if s.close != nil {
-		s.close <- true
+	s.mx.Lock()
+	closed, stopped := s.close, s.stopped
+	s.close, s.stopped = nil, nil
+	s.mx.Unlock()
+
+	if closed != nil {
+		close(closed)
+		<-stopped
 	}
+	s.Wait()
 }
 
-func (s *Scraper) delayRequest() {
-	if s.lastRequest.IsZero() {
-		return
+// Wait cancels the active run and blocks until it is finished
+func (s *Scraper) Wait() {
+	s.mx.Lock()
+	done := s.done
+	s.cancel()
+	s.mx.Unlock()
+
+	if done != nil {
+		<-done
 	}
-	delta := s.Delay - time.Now().Sub(s.lastRequest)
-	if delta > 0 {
-		time.Sleep(delta)
+}
+
+// schedule sets the time of the next scheduled run
+func (s *Scraper) schedule() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.nextRun = time.Now().Add(FetchInterval)
+}
+
+// Pause skips all scheduled runs until the scraper gets resumed. An active run isn't affected.
+func (s *Scraper) Pause() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.paused {
+		s.paused = true
+		log.Warning("Scraper paused")
 	}
 }
 
-func (s *Scraper) LoadCsrfToken() bool {
+// Resume continues with the next scheduled run
+func (s *Scraper) Resume() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.paused {
+		s.paused = false
+		log.Info("Scraper resumed")
+	}
+}
+
+func (s *Scraper) IsPaused() bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.paused
+}
+
+// NextRun returns the time of the next scheduled run, which is zero if the scraper is stopped or paused
+func (s *Scraper) NextRun() time.Time {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.paused {
+		return time.Time{}
+	}
+	return s.nextRun
+}
+
+// ResetCursor drops the stored cursor, so the next run fetches the whole bookmark timeline from its start again
+func (s *Scraper) ResetCursor() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.running {
+		return ErrRunning
+	}
+	s.setCursor("")
+	log.Info("Cursor reset, the next run fetches all bookmarks")
+	return nil
+}
+
+// webUrl returns the absolute url of a path on the twitter website
+func (s *Scraper) webUrl(path string) string {
+	if s.Urls.Web == "" {
+		return DefaultWebUrl + path
+	}
+	return strings.TrimSuffix(s.Urls.Web, "/") + path
+}
+
+// assetsUrl returns the absolute url of a path on the twitter asset host
+func (s *Scraper) assetsUrl(path string) string {
+	if s.Urls.Assets == "" {
+		return DefaultAssetsUrl + path
+	}
+	return strings.TrimSuffix(s.Urls.Assets, "/") + path
+}
+
+// httpClient returns the client using the current timeout and proxy settings
+func (s *Scraper) httpClient() *Client {
+	if err := s.client.Configure(s.Timeout, s.Proxy); err != nil {
+		log.Error("%s, all requests are refused", err.Error())
+	}
+	return s.client
+}
+
+// SetTransport replaces the http transport used for all requests
+func (s *Scraper) SetTransport(rt http.RoundTripper) {
+	s.client.SetTransport(rt)
+}
+
+// WrapTransport wraps the http transport used for all requests
+func (s *Scraper) WrapTransport(wrap func(next http.RoundTripper) http.RoundTripper) {
+	s.client.WrapTransport(wrap)
+}
+
+// Secrets returns all credentials which must not be stored, such as the csrf token and the session cookie values
+func (s *Scraper) Secrets() []string {
+	secrets := []string{s.csrfToken}
 	for _, p := range strings.Split(s.Cookie, ";") {
-		parts := strings.SplitN(p, "=", 2)
-		if strings.Trim(parts[0], " ") == "ct0" {
-			s.csrfToken = strings.Trim(parts[1], " ")
-			return true
+		parts := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		// Short values like a language code would render recordings useless
+		if len(parts) == 2 && len(parts[1]) >= 16 {
+			secrets = append(secrets, parts[1])
 		}
 	}
+	return secrets
+}
+
+// Drifts returns all deviations of the bookmark timeline from the known response schema
+func (s *Scraper) Drifts() []Drift {
+	return s.drift.Drifts()
+}
+
+// RateLimits returns the last known request budget of all api endpoints
+func (s *Scraper) RateLimits() []RateLimit {
+	return s.client.RateLimits()
+}
+
+// NextRequest returns the earliest time the bookmark timeline may be requested again
+func (s *Scraper) NextRequest() time.Time {
+	return s.client.NextRequest(EndpointBookmarks, s.Delay)
+}
+
+func (s *Scraper) LoadCsrfToken() bool {
+	if token := CsrfToken(s.Cookie); token != "" {
+		s.csrfToken = token
+		return true
+	}
 	return false
 }
 
+// CsrfToken returns the value of the "ct0" cookie, which twitter expects as csrf token
+func CsrfToken(cookie string) string {
+	for _, p := range strings.Split(cookie, ";") {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) == 2 && strings.Trim(parts[0], " ") == "ct0" {
+			return strings.Trim(parts[1], " ")
+		}
+	}
+	return ""
+}
+
 func (s *Scraper) LoadSections() error {
-	src := "https://twitter.com/i/bookmarks"
+	src := s.webUrl("/i/bookmarks")
 	req, err := http.NewRequest("GET", src, nil)
 	if err != nil {
 		return err
@@ -176,7 +367,7 @@ func (s *Scraper) LoadSections() error {
 	// Something similar might be required in the future, if the legacy version gets removed
 	//req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/113.0.0.0 Safari/537.36")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.httpClient().Do(req)
 
 	if err != nil {
 		return err
@@ -193,13 +384,13 @@ func (s *Scraper) LoadSections() error {
 	bookmarkHtml := string(b)
 
 	// Check if the legacy version is used
-	isLegacy := strings.Contains(bookmarkHtml, "https://abs.twimg.com/responsive-web/client-web-legacy/main")
+	isLegacy := strings.Contains(bookmarkHtml, s.assetsUrl("/responsive-web/client-web-legacy/main"))
 
 	if isLegacy {
-		if err := s.fetchMainJs(bookmarkHtml, `https://abs\.twimg\.com/responsive-web/client-web-legacy/main\.([0-9a-zA-Z]*)\.js`); err != nil {
+		if err := s.fetchMainJs(bookmarkHtml, regexp.QuoteMeta(s.assetsUrl("/responsive-web/client-web-legacy/main."))+`([0-9a-zA-Z]*)\.js`); err != nil {
 			return err
 		}
-	} else if err := s.fetchMainJs(bookmarkHtml, `https://abs\.twimg\.com/responsive-web/client-web/main\.([0-9a-zA-Z]*)\.js`); err != nil {
+	} else if err := s.fetchMainJs(bookmarkHtml, regexp.QuoteMeta(s.assetsUrl("/responsive-web/client-web/main."))+`([0-9a-zA-Z]*)\.js`); err != nil {
 		return err
 	}
 
@@ -209,10 +400,10 @@ func (s *Scraper) LoadSections() error {
 		apiJsFileToken := matches[1] + s.jsAppendix
 
 		if isLegacy {
-			if err := s.fetchApiJs("https://abs.twimg.com/responsive-web/client-web-legacy/api." + apiJsFileToken + ".js"); err != nil {
+			if err := s.fetchApiJs(s.assetsUrl("/responsive-web/client-web-legacy/api." + apiJsFileToken + ".js")); err != nil {
 				return err
 			}
-		} else if err := s.fetchApiJs("https://abs.twimg.com/responsive-web/client-web/api." + apiJsFileToken + ".js"); err != nil {
+		} else if err := s.fetchApiJs(s.assetsUrl("/responsive-web/client-web/api." + apiJsFileToken + ".js")); err != nil {
 			return err
 		}
 	} else {
@@ -228,7 +419,7 @@ func (s *Scraper) fetchApiJs(apiJsFile string) error {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.httpClient().Do(req)
 
 	if err != nil {
 		return err
@@ -278,7 +469,7 @@ func (s *Scraper) fetchMainJs(bookmarkHtml string, regex string) error {
 			return err
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := s.httpClient().Do(req)
 
 		if err != nil {
 			return err
@@ -344,7 +535,8 @@ func (s *Scraper) buildUrl() string {
 	fvb, _ := json.Marshal(s.features)
 
 	return fmt.Sprintf(
-		"https://twitter.com/i/api/graphql/%s/Bookmarks?variables=%s&features=%s",
+		"%s/i/api/graphql/%s/Bookmarks?variables=%s&features=%s",
+		s.webUrl(""),
 		s.Sections.Index,
 		url.QueryEscape(string(jvb)),
 		url.QueryEscape(string(fvb)),
@@ -358,14 +550,62 @@ func (s *Scraper) IsRunning() bool {
 	return s.running
 }
 
-func (s *Scraper) Run(keepCursor bool) {
+// Run fetches the bookmark timeline in the background, unless it is fetched already, and reports whether a new run
+// has been started
+func (s *Scraper) Run(keepCursor bool) bool {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 	if s.running {
-		return
+		return false
 	}
 	s.running = true
-	go s.run(keepCursor)
+	s.canceled = false
+	s.done = make(chan bool)
+	s.ctx, s.cancelRun = context.WithCancel(context.Background())
+	s.progress = Progress{StartedAt: time.Now(), Running: true}
+	go func() {
+		s.report(ProgressRunStarted, nil)
+		s.run(keepCursor)
+	}()
+	return true
+}
+
+// Cancel stops the active run before the next tweet or page is processed and reports whether a run was active. The
+// cursor stays at the last completed page, so the next run continues from there.
+func (s *Scraper) Cancel() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.cancel()
+}
+
+// cancel marks the active run as canceled and aborts its pending request. The caller has to hold the lock.
+func (s *Scraper) cancel() bool {
+	if !s.running {
+		return false
+	}
+	s.canceled = true
+	s.cancelRun()
+	return true
+}
+
+// runContext returns the context of the active run, which is canceled together with the run. Requests made outside
+// of a run, such as enriching imported tweets, use a background context.
+func (s *Scraper) runContext() context.Context {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *Scraper) isCanceled() bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.canceled
 }
 
 func (s *Scraper) GetCursor() string {
@@ -385,61 +625,68 @@ func (s *Scraper) SetCursor(cursor string) {
 func (s *Scraper) setCursor(cursor string) {
 	s.cursor = cursor
 
-	f, err := os.OpenFile(CursorFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		log.Fatal(err)
+	if err := s.saveState(); err != nil {
+		log.Error("Failed to save the sync state: %s", err)
 	}
-	defer f.Close()
-
-	_, _ = f.WriteString(s.cursor)
 }
 
 func (s *Scraper) run(keepCursor bool, attempts ...error) {
 	if len(attempts) > 10 {
 		log.Error("Api failed to many times: %s", attempts[len(attempts)-1].Error())
-		s.free()
+		s.finish(ResultFailed, attempts[len(attempts)-1])
 		return
 	}
+	if s.isCanceled() {
+		log.Warning("Sync canceled at cursor \"%s\"", s.GetCursor())
+		s.finish(ResultCanceled, nil)
+		return
+	}
+	s.report(ProgressPageStarted, func(p *Progress) {
+		if len(attempts) == 0 {
+			p.Page++
+		}
+		p.Attempt = len(attempts) + 1
+	})
 
-	req, err := http.NewRequest("GET", s.buildUrl(), nil)
+	req, err := http.NewRequestWithContext(s.runContext(), "GET", s.buildUrl(), nil)
 	if err != nil {
 		log.Error("client: error making http request: %s", err.Error())
-		s.free()
+		s.finish(ResultFailed, err)
 		return
 	}
 	req.Header.Set("Cookie", s.Cookie)
 	req.Header.Set("authorization", "Bearer "+s.AccessToken)
 	req.Header.Set("x-csrf-token", s.csrfToken)
 
-	s.delayRequest()
-	res, err := http.DefaultClient.Do(req)
-	s.mx.Lock()
-	s.lastRequest = time.Now()
-	s.mx.Unlock()
+	res, err := s.httpClient().DoApi(EndpointBookmarks, s.Delay, req)
 
-	if err != nil {
+	if err != nil && s.isCanceled() {
+		log.Warning("Sync canceled at cursor \"%s\"", s.GetCursor())
+		s.finish(ResultCanceled, nil)
+		return
+	} else if err != nil {
 		log.Error("client: error sending http request: %s", err.Error())
-		s.free()
+		s.finish(ResultFailed, err)
 		return
 	}
 
 	if res.StatusCode != 200 {
 		log.Error("twitter: failed to fetch response body: %s", res.Status)
-		s.free()
+		s.finish(ResultFailed, errors.New("unexpected response \""+res.Status+"\""))
 		return
 	}
 
 	resBody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		log.Error("client: could not read response body: %s", err)
-		s.free()
+		s.finish(ResultFailed, err)
 		return
 	}
 
 	rb := &BookmarkResponse{}
 	if err := json.Unmarshal(resBody, rb); err != nil {
 		log.Error("client: could not unmarshal response body: %s", err)
-		s.free()
+		s.finish(ResultFailed, err)
 		return
 	}
 
@@ -448,24 +695,33 @@ func (s *Scraper) run(keepCursor bool, attempts ...error) {
 		log.Warning("twitter: api error at cursor \"%s\" with %s", s.cursor, err.Message)
 
 		attempts = append(attempts, errors.New(err.Message))
+		s.report(ProgressApiError, func(p *Progress) {
+			p.Attempt = len(attempts)
+			p.Error = err.Message
+		})
 		go s.run(keepCursor, attempts...)
 		return
 	}
 
+	rawEntries := rawBookmarkEntries(resBody)
+
 	cursor := ""
 	count := 0
 	empty := 0
-	for _, instruction := range rb.Data.BookmarkTimeline.Timeline.Instructions {
-		for _, entry := range instruction.Entries {
+	for i, instruction := range rb.Data.BookmarkTimeline.Timeline.Instructions {
+		for j, entry := range instruction.Entries {
+			var raw json.RawMessage
+			if i < len(rawEntries) && j < len(rawEntries[i]) {
+				raw = rawEntries[i][j]
+				s.drift.CheckEntry(raw)
+			}
+
 			switch entry.Content.EntryType {
 			case "TimelineTimelineItem":
 				// Tweet
-				tweet := entry.Content.ItemContent.TweetResults.Result.Legacy
-				user := entry.Content.ItemContent.TweetResults.Result.Core.UserResults.Result
-				if tweet.IdStr == "" {
-					tweet = entry.Content.ItemContent.TweetResults.Result.Tweet.Legacy
-					user = entry.Content.ItemContent.TweetResults.Result.Tweet.Core.UserResults.Result
-				}
+				block := entry.Content.ItemContent.TweetResults.Result.Block()
+				tweet := block.TweetResult()
+				user := block.Core.UserResults.Result
 
 				if tweet.IdStr == "" {
 					log.Info("Empty tweet data. %s probably got deleted at some point", entry.EntryId)
@@ -475,9 +731,15 @@ func (s *Scraper) run(keepCursor bool, attempts ...error) {
 					//		  available at a later point. I'm assuming RestId equals IdStr, but I could be wrong..
 					empty++
 				} else {
+					if s.isCanceled() {
+						go s.run(keepCursor, attempts...)
+						return
+					}
 					if s.onNewTweet(&CachedTweet{
-						User:  user,
-						Tweet: tweet,
+						User:   user,
+						Tweet:  tweet,
+						Raw:    rawTweetResults(raw),
+						Linked: block.LinkedTweets(),
 					}) == false {
 						go s.run(keepCursor, attempts...)
 						return
@@ -493,32 +755,50 @@ func (s *Scraper) run(keepCursor bool, attempts ...error) {
 		}
 	}
 
-	s.mx.Lock()
-	defer s.mx.Unlock()
+	s.report(ProgressPageFinished, func(p *Progress) {
+		p.Entries = count
+		p.Empty = empty
+		p.Error = ""
+		p.TotalEntries += count
+		p.TotalEmpty += empty
+	})
 
+	s.mx.Lock()
+	advance, next := false, false
 	if keepCursor {
 		if c, ok := s.variables["count"].(int); ok && c <= count {
-			if count == empty {
-				s.setCursor(cursor)
-			}
-			go s.run(keepCursor)
-		} else {
-			s.free()
+			advance = count == empty
+			next = true
 		}
 	} else if cursor != "" {
+		advance, next = true, true
+	}
+	if advance {
 		s.setCursor(cursor)
+	}
+	s.mx.Unlock()
+
+	if advance {
+		s.report(ProgressCursorAdvanced, nil)
+	}
+	if next {
 		go s.run(keepCursor)
 	} else {
-		s.free()
+		s.finish(ResultCompleted, nil)
 	}
 }
 
+// free marks the scraper as idle and releases everyone waiting for the run to finish
 func (s *Scraper) free() {
-	go func() {
-		s.mx.Lock()
-		defer s.mx.Unlock()
-		s.running = false
-	}()
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.running = false
+	s.canceled = false
+	s.cancelRun()
+	s.ctx, s.cancelRun = nil, nil
+	close(s.done)
+	s.done = nil
 }
 
 func (s *Scraper) Download(src, target string) error {
@@ -545,7 +825,7 @@ func (s *Scraper) DeleteBookmarkDetail(id string) (*RemoveBookmarkResponse, erro
 		"queryId": s.Sections.Remove,
 	})
 
-	req, err := http.NewRequest("POST", "https://twitter.com/i/api/graphql/"+s.Sections.Remove+"/DeleteBookmark", bytes.NewReader(b))
+	req, err := http.NewRequest("POST", s.webUrl("/i/api/graphql/"+s.Sections.Remove+"/DeleteBookmark"), bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
@@ -554,9 +834,7 @@ func (s *Scraper) DeleteBookmarkDetail(id string) (*RemoveBookmarkResponse, erro
 	req.Header.Set("x-csrf-token", s.csrfToken)
 	req.Header.Set("content-type", "application/json")
 
-	s.delayRequest()
-	resp, err := http.DefaultClient.Do(req)
-	s.lastRequest = time.Now()
+	resp, err := s.httpClient().DoApi(EndpointDeleteBookmark, s.Delay, req)
 
 	if err != nil {
 		return nil, err
@@ -578,8 +856,40 @@ func (s *Scraper) DeleteBookmarkDetail(id string) (*RemoveBookmarkResponse, erro
 }
 
 func (s *Scraper) TweetDetail(id string) (*ConversationResponse, error) {
-	variables, err := json.Marshal(map[string]interface{}{
-		//"cursor":                               "",
+	conversation := NewConversationResponse()
+
+	cursors := []string{""}
+	seen := map[string]bool{}
+	for pages := 0; len(cursors) > 0; pages++ {
+		if pages >= MaxConversationPages {
+			log.Warning("Conversation %s exceeds %d pages; remaining replies skipped", id, MaxConversationPages)
+			break
+		}
+		cursor := cursors[0]
+		cursors = cursors[1:]
+
+		page, raw, err := s.fetchTweetDetail(id, cursor)
+		if err != nil {
+			return nil, err
+		}
+		conversation.Pages = append(conversation.Pages, raw)
+		for _, c := range conversation.AddPage(page) {
+			if c != "" && seen[c] == false {
+				seen[c] = true
+				cursors = append(cursors, c)
+			}
+		}
+	}
+
+	if _, ok := conversation.GlobalObjects.Tweets[id]; !ok {
+		return nil, errors.New("tweet " + id + " not found in conversation")
+	}
+
+	return conversation, nil
+}
+
+func (s *Scraper) fetchTweetDetail(id, cursor string) (*TweetDetailResponse, json.RawMessage, error) {
+	v := map[string]interface{}{
 		"focalTweetId":                           id,
 		"referrer":                               "bookmarks",
 		"with_rux_injections":                    false,
@@ -589,9 +899,13 @@ func (s *Scraper) TweetDetail(id string) (*ConversationResponse, error) {
 		"withBirdwatchNotes":                     true,
 		"withVoice":                              true,
 		"withV2Timeline":                         true,
-	})
+	}
+	if cursor != "" {
+		v["cursor"] = cursor
+	}
+	variables, err := json.Marshal(v)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	features, err := json.Marshal(map[string]interface{}{
@@ -617,51 +931,50 @@ func (s *Scraper) TweetDetail(id string) (*ConversationResponse, error) {
 		"responsive_web_enhance_cards_enabled":                                    false,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	fieldToggles, err := json.Marshal(map[string]interface{}{
 		"withArticleRichContentState": false,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	req, err := http.NewRequest("GET", "https://twitter.com/i/api/graphql/"+s.Sections.Detail+"/TweetDetail?variables="+
+	req, err := http.NewRequestWithContext(s.runContext(), "GET", s.webUrl("/i/api/graphql/"+s.Sections.Detail+"/TweetDetail?variables=")+
 		url.QueryEscape(string(variables))+"&features="+
 		url.QueryEscape(string(features))+"&fieldToggles="+
 		url.QueryEscape(string(fieldToggles)), nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	req.Header.Set("Cookie", s.Cookie)
 	req.Header.Set("authorization", "Bearer "+s.AccessToken)
 	req.Header.Set("x-csrf-token", s.csrfToken)
 	req.Header.Set("content-type", "application/json")
 
-	s.delayRequest()
-	resp, err := http.DefaultClient.Do(req)
-	s.lastRequest = time.Now()
+	resp, err := s.httpClient().DoApi(EndpointTweetDetail, s.Delay, req)
 
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, errors.New("failed to download resource with \"" + resp.Status + "\" from twitter.com")
+		return nil, nil, errors.New("failed to download resource with \"" + resp.Status + "\" from twitter.com")
 	}
 
-	// The following part won't work because the response structure has changed. Everything up to this point should work.
-	// This call has to be repeated until all conversations have been fetched. This can be accomplished by providing the previously received cursor.
-	// However, ConversationResponse has to be modified before continuing...
-	fmt.Println("Please see: https://github.com/Webklex/tbm/issues/31")
-	os.Exit(2)
-
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	v := &ConversationResponse{}
-	if err := json.Unmarshal(b, v); err != nil {
-		return nil, err
+	page := &TweetDetailResponse{}
+	if err := json.Unmarshal(b, page); err != nil {
+		return nil, nil, err
 	}
-	return v, nil
+	if len(page.Errors) > 0 && len(page.Data.ThreadedConversation.Instructions) == 0 {
+		return nil, nil, errors.New("twitter: api error: " + page.Errors[0].Message)
+	}
+	return page, b, nil
 }
 
 func (s *Scraper) Get(src string) ([]byte, error) {
@@ -673,7 +986,7 @@ func (s *Scraper) Get(src string) ([]byte, error) {
 	req.Header.Set("authorization", "Bearer "+s.AccessToken)
 	req.Header.Set("x-csrf-token", s.csrfToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.httpClient().Do(req)
 
 	if err != nil {
 		return nil, err
@@ -684,3 +997,33 @@ func (s *Scraper) Get(src string) ([]byte, error) {
 
 	return io.ReadAll(resp.Body)
 }
+
+// Fetch requests a resource starting at the given byte offset and leaves the response handling to the caller
+func (s *Scraper) Fetch(ctx context.Context, src string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Cookie", s.Cookie)
+	req.Header.Set("authorization", "Bearer "+s.AccessToken)
+	req.Header.Set("x-csrf-token", s.csrfToken)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	return s.httpClient().Download(req)
+}
+
+// FetchPage requests a third party web page. Unlike Fetch no twitter credentials are sent along, but the configured
+// proxy still applies. The request isn't limited by the scraper timeout, the context has to limit it instead. Local and
+// private hosts are refused.
+func (s *Scraper) FetchPage(ctx context.Context, src string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/113.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	return s.httpClient().FetchPage(req)
+}
@@ -0,0 +1,156 @@
+package scraper
+
+import (
+	"encoding/json"
+	"os"
+	"tbm/utils/filesystem"
+	"tbm/utils/log"
+	"time"
+)
+
+const (
+	StateFilename = "sync.json"
+	// MaxRuns limits the run history kept in the state file
+	MaxRuns = 100
+)
+
+// Run summarizes a finished run through the bookmark timeline
+type Run struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Result     string    `json:"result"`
+	Pages      int       `json:"pages"`
+	Entries    int       `json:"entries"`
+	Empty      int       `json:"empty"`
+	Cursor     string    `json:"cursor"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Totals sum up all runs recorded in the state file
+type Totals struct {
+	Runs      int `json:"runs"`
+	Completed int `json:"completed"`
+	Canceled  int `json:"canceled"`
+	Failed    int `json:"failed"`
+	Pages     int `json:"pages"`
+	Entries   int `json:"entries"`
+	Empty     int `json:"empty"`
+}
+
+// State is the sync state persisted between restarts. Runs holds the latest runs, oldest first.
+type State struct {
+	Cursor      string    `json:"cursor"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	Totals      Totals    `json:"totals"`
+	Runs        []Run     `json:"runs,omitempty"`
+}
+
+// LoadState restores the persisted sync state. The cursor of a legacy cursor file is migrated into a new state file.
+func (s *Scraper) LoadState() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.state = State{Runs: []Run{}}
+	b, err := os.ReadFile(s.StateFile)
+	if os.IsNotExist(err) {
+		return s.migrateCursorFile()
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &s.state); err != nil {
+		return err
+	}
+	if s.state.Runs == nil {
+		s.state.Runs = []Run{}
+	}
+	s.cursor = s.state.Cursor
+	return nil
+}
+
+// migrateCursorFile takes over the cursor stored by former versions and removes the legacy file afterwards
+func (s *Scraper) migrateCursorFile() error {
+	if s.LegacyCursorFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.LegacyCursorFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.cursor = string(b)
+	if err := s.saveState(); err != nil {
+		return err
+	}
+	log.Info("Cursor migrated from \"%s\" to \"%s\"", s.LegacyCursorFile, s.StateFile)
+	return os.Remove(s.LegacyCursorFile)
+}
+
+// State returns a copy of the sync state
+func (s *Scraper) State() State {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	state := s.state
+	state.Cursor = s.cursor
+	state.Runs = append([]Run{}, s.state.Runs...)
+	return state
+}
+
+// record adds the finished run to the history and updates the totals. The caller has to hold the lock.
+func (s *Scraper) record(finishedAt time.Time) {
+	p := s.progress
+	run := Run{
+		StartedAt:  p.StartedAt,
+		FinishedAt: finishedAt,
+		Result:     p.Result,
+		Pages:      p.Page,
+		Entries:    p.TotalEntries,
+		Empty:      p.TotalEmpty,
+		Cursor:     s.cursor,
+		Error:      p.Error,
+	}
+	s.state.Runs = append(s.state.Runs, run)
+	if len(s.state.Runs) > MaxRuns {
+		s.state.Runs = s.state.Runs[len(s.state.Runs)-MaxRuns:]
+	}
+
+	t := &s.state.Totals
+	t.Runs++
+	t.Pages += run.Pages
+	t.Entries += run.Entries
+	t.Empty += run.Empty
+	switch run.Result {
+	case ResultCompleted:
+		t.Completed++
+		s.state.LastSuccess = run.FinishedAt
+	case ResultCanceled:
+		t.Canceled++
+	case ResultFailed:
+		t.Failed++
+	}
+	if run.Error != "" {
+		s.state.LastError = run.Error
+		s.state.LastErrorAt = run.FinishedAt
+	}
+
+	if err := s.saveState(); err != nil {
+		log.Error("Failed to save the sync state: %s", err)
+	}
+}
+
+// saveState writes the state into a temporary file first, so a crash can't leave a truncated state behind. The
+// caller has to hold the lock.
+func (s *Scraper) saveState() error {
+	if s.StateFile == "" {
+		return nil
+	}
+	s.state.Cursor = s.cursor
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFileAtomic(s.StateFile, b, 0644)
+}
@@ -0,0 +1,71 @@
+package scraper
+
+type TweetDetailResponse struct {
+	Data struct {
+		ThreadedConversation struct {
+			Instructions []TweetDetailInstruction `json:"instructions"`
+		} `json:"threaded_conversation_with_injections_v2"`
+	} `json:"data"`
+
+	Errors []struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Kind    string `json:"kind"`
+		Name    string `json:"name"`
+	} `json:"errors"`
+}
+
+type TweetDetailInstruction struct {
+	Type          string                  `json:"type"`
+	Direction     string                  `json:"direction"`
+	Entries       []TweetDetailEntry      `json:"entries"`
+	ModuleItems   []TweetDetailModuleItem `json:"moduleItems"`
+	ModuleEntryId string                  `json:"moduleEntryId"`
+}
+
+type TweetDetailEntry struct {
+	EntryId   string `json:"entryId"`
+	SortIndex string `json:"sortIndex"`
+	Content   struct {
+		EntryType   string                  `json:"entryType"`
+		TypeName    string                  `json:"__typename"`
+		ItemContent TweetDetailItemContent  `json:"itemContent"`
+		Items       []TweetDetailModuleItem `json:"items"`
+		DisplayType string                  `json:"displayType"`
+		Value       string                  `json:"value"`
+		CursorType  string                  `json:"cursorType"`
+	} `json:"content"`
+}
+
+type TweetDetailModuleItem struct {
+	EntryId string `json:"entryId"`
+	Item    struct {
+		ItemContent TweetDetailItemContent `json:"itemContent"`
+	} `json:"item"`
+}
+
+type TweetDetailItemContent struct {
+	ItemType         string       `json:"itemType"`
+	TypeName         string       `json:"__typename"`
+	TweetResults     TweetResults `json:"tweet_results"`
+	TweetDisplayType string       `json:"tweetDisplayType"`
+	Value            string       `json:"value"`
+	CursorType       string       `json:"cursorType"`
+}
+
+// Cursor returns the cursor value if the item is a cursor pointing to further replies
+func (ic *TweetDetailItemContent) Cursor() string {
+	if ic.ItemType != "TimelineTimelineCursor" || !isReplyCursor(ic.CursorType) {
+		return ""
+	}
+	return ic.Value
+}
+
+// isReplyCursor reports whether a cursor of a TweetDetail page points to further replies
+func isReplyCursor(cursorType string) bool {
+	switch cursorType {
+	case "Bottom", "ShowMore", "ShowMoreThreads", "ShowMoreThreadsPrompt":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,662 @@
+// Package scrapertest provides a local server emulating the twitter endpoints used by the scraper, so the whole fetch
+// pipeline can be run in tests without a twitter account.
+package scrapertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"tbm/scraper"
+	"time"
+)
+
+const (
+	IndexSection  = "fakeBookmarksSection"
+	DetailSection = "fakeTweetDetailSection"
+	RemoveSection = "fakeDeleteBookmarkSection"
+	AccessToken   = "AAAAAAAAAAAAAAAfakeAccessToken"
+	CsrfToken     = "fakecsrftoken0123456789"
+	Cookie        = "ct0=" + CsrfToken + "; auth_token=fakeauthtoken0123456789"
+
+	mainJsHash = "fake0main1"
+	apiJsHash  = "fake0api"
+
+	// DeletedTweetError is returned by TweetDetail for deleted tweets
+	DeletedTweetError = "_Missing: No status found with that ID."
+)
+
+var graphqlPattern = regexp.MustCompile(`^/i/api/graphql/([^/]+)/([^/]+)$`)
+
+// Tweet is a tweet served by the fake server. Missing details are filled in with defaults.
+type Tweet struct {
+	Id         string
+	UserId     string
+	ScreenName string
+	Name       string
+	Text       string
+	CreatedAt  time.Time
+	ReplyTo    string
+	Media      []Media
+	// Typename overrides the "__typename" of the tweet result. "TweetWithVisibilityResults" wraps the tweet.
+	Typename string
+	// Note turns the tweet into a long-form tweet, Text is used as its truncated legacy text
+	Note string
+	// Quoted and Retweeted are embedded into the tweet result and served as tweets of their own
+	Quoted    *Tweet
+	Retweeted *Tweet
+	Card      *Card
+	// Urls are linked as shortened urls appended to the text
+	Urls []string
+}
+
+// Card is a link preview or poll attached to a tweet. Values are served as string values, Thumbnail as
+// "thumbnail_image_large" image value.
+type Card struct {
+	Name           string
+	Url            string
+	Values         map[string]string
+	CountsAreFinal bool
+	Thumbnail      *Media
+}
+
+// Media is a photo or video attached to a tweet. Videos are served with a preview image and a single variant.
+type Media struct {
+	Id      string
+	Type    string
+	Content []byte
+	Preview []byte
+}
+
+// Failure replaces the next response of an endpoint. Responses with status 200 contain the given api errors.
+type Failure struct {
+	Status int
+	Errors []string
+	// Reset is announced within the rate limit headers of "429 Too Many Requests" responses
+	Reset time.Duration
+}
+
+// Server emulates the bookmark page, the javascript bundles containing the api sections, the Bookmarks, TweetDetail
+// and DeleteBookmark endpoints and the media hosts
+type Server struct {
+	*httptest.Server
+
+	// PageSize limits the number of replies per TweetDetail page
+	PageSize int
+
+	mx        sync.Mutex
+	bookmarks []*Tweet
+	tweets    map[string]*Tweet
+	deleted   map[string]bool
+	removed   []string
+	failures  map[string][]Failure
+	requests  map[string]int
+	files     map[string][]byte
+}
+
+func NewServer() *Server {
+	s := &Server{
+		PageSize: 20,
+		tweets:   map[string]*Tweet{},
+		deleted:  map[string]bool{},
+		failures: map[string][]Failure{},
+		requests: map[string]int{},
+		files:    map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Configure points a scraper to the fake server and removes all request delays
+func (s *Server) Configure(sc *scraper.Scraper) {
+	sc.Urls.Web = s.URL
+	sc.Urls.Assets = s.URL
+	sc.Cookie = Cookie
+	sc.Delay = 0
+	sc.LoadCsrfToken()
+}
+
+// AddBookmark adds a tweet on top of the bookmark timeline
+func (s *Server) AddBookmark(t *Tweet) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.addTweet(t)
+	s.bookmarks = append([]*Tweet{t}, s.bookmarks...)
+}
+
+// AddReply adds a tweet to the conversation of the tweet it replies to
+func (s *Server) AddReply(t *Tweet) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.addTweet(t)
+}
+
+func (s *Server) addTweet(t *Tweet) {
+	if t.UserId == "" {
+		t.UserId = "1" + t.Id
+	}
+	if t.ScreenName == "" {
+		t.ScreenName = "user" + t.UserId
+	}
+	if t.Name == "" {
+		t.Name = "User " + t.UserId
+	}
+	if t.Text == "" {
+		t.Text = "Tweet " + t.Id
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if t.Card != nil && t.Card.Thumbnail != nil {
+		s.files["/card_img/"+t.Card.Thumbnail.Id+"/thumbnail"] = t.Card.Thumbnail.Content
+	}
+	for _, linked := range []*Tweet{t.Quoted, t.Retweeted} {
+		if linked != nil {
+			s.addTweet(linked)
+		}
+	}
+	s.tweets[t.Id] = t
+	s.files["/profile/"+t.UserId+".jpg"] = []byte("avatar " + t.UserId)
+	for _, m := range t.Media {
+		if m.Type == "video" {
+			s.files["/media/"+m.Id+".jpg"] = m.Preview
+			s.files["/video/"+m.Id+".mp4"] = m.Content
+		} else {
+			s.files["/media/"+m.Id+".jpg"] = m.Content
+		}
+	}
+}
+
+// DeleteTweet makes a tweet unavailable. Bookmarks of deleted tweets remain within the timeline without any content.
+func (s *Server) DeleteTweet(id string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.deleted[id] = true
+}
+
+// Fail replaces the next response of an endpoint such as "Bookmarks", "TweetDetail", "DeleteBookmark" or a path like
+// "/media/1.jpg". Multiple failures are returned in order.
+func (s *Server) Fail(endpoint string, f Failure) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.failures[endpoint] = append(s.failures[endpoint], f)
+}
+
+// Requests returns the number of requests received by an endpoint or path
+func (s *Server) Requests(endpoint string) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// RemovedBookmarks returns the ids of all bookmarks removed using DeleteBookmark
+func (s *Server) RemovedBookmarks() []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return append([]string{}, s.removed...)
+}
+
+// MediaUrl returns the url a media file of a tweet is served from
+func (s *Server) MediaUrl(m Media) string {
+	return s.URL + "/media/" + m.Id + ".jpg"
+}
+
+// VideoUrl returns the url the video variant of a media file is served from
+func (s *Server) VideoUrl(m Media) string {
+	return s.URL + "/video/" + m.Id + ".mp4"
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path
+	section := ""
+	if matches := graphqlPattern.FindStringSubmatch(r.URL.Path); len(matches) > 2 {
+		section, endpoint = matches[1], matches[2]
+	}
+
+	s.mx.Lock()
+	s.requests[endpoint]++
+	var failure *Failure
+	if failures := s.failures[endpoint]; len(failures) > 0 {
+		failure = &failures[0]
+		s.failures[endpoint] = failures[1:]
+	}
+	s.mx.Unlock()
+
+	if failure != nil {
+		s.fail(w, failure)
+		return
+	}
+
+	switch {
+	case endpoint == "/i/bookmarks":
+		s.bookmarkPage(w)
+	case endpoint == "/responsive-web/client-web/main."+mainJsHash+".js":
+		writeJs(w, fmt.Sprintf(`e.exports={queryId:"%s",operationName:"DeleteBookmark",operationType:"mutation"};const t="Bearer %s";`, RemoveSection, AccessToken))
+	case endpoint == "/responsive-web/client-web/api."+apiJsHash+mainJsHash[len(mainJsHash)-1:]+".js":
+		writeJs(w, fmt.Sprintf(`e.exports={queryId:"%s",operationName:"Bookmarks",operationType:"query"};e.exports={queryId:"%s",operationName:"TweetDetail",operationType:"query"};`, IndexSection, DetailSection))
+	case section != "":
+		if !authorized(r) {
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		switch {
+		case endpoint == scraper.EndpointBookmarks && section == IndexSection:
+			s.bookmarkTimeline(w, r)
+		case endpoint == scraper.EndpointTweetDetail && section == DetailSection:
+			s.tweetDetail(w, r)
+		case endpoint == scraper.EndpointDeleteBookmark && section == RemoveSection && r.Method == http.MethodPost:
+			s.deleteBookmark(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		s.mx.Lock()
+		content, ok := s.files[endpoint]
+		s.mx.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, endpoint, time.Time{}, strings.NewReader(string(content)))
+	}
+}
+
+func authorized(r *http.Request) bool {
+	return r.Header.Get("authorization") == "Bearer "+AccessToken &&
+		r.Header.Get("x-csrf-token") == CsrfToken &&
+		strings.Contains(r.Header.Get("Cookie"), "ct0="+CsrfToken)
+}
+
+func (s *Server) fail(w http.ResponseWriter, f *Failure) {
+	if f.Status == http.StatusTooManyRequests {
+		w.Header().Set("x-rate-limit-limit", "500")
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(f.Reset).Unix(), 10))
+	}
+	if f.Status != 0 && f.Status != http.StatusOK {
+		http.Error(w, http.StatusText(f.Status), f.Status)
+		return
+	}
+	errs := make([]map[string]interface{}, 0, len(f.Errors))
+	for _, message := range f.Errors {
+		errs = append(errs, map[string]interface{}{"message": message, "code": 0})
+	}
+	writeJson(w, map[string]interface{}{"errors": errs})
+}
+
+func (s *Server) bookmarkPage(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, `<!DOCTYPE html><html><head>`+
+		`<script>window.__SCRIPTS_LOADED__={};var chunks={",api:"%s",":1};</script>`+
+		`<link rel="preload" as="script" href="%s/responsive-web/client-web/main.%s.js">`+
+		`</head><body></body></html>`, apiJsHash, s.URL, mainJsHash)
+}
+
+func writeJs(w http.ResponseWriter, js string) {
+	w.Header().Set("Content-Type", "application/javascript")
+	_, _ = w.Write([]byte(js))
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func readVariables(r *http.Request) map[string]interface{} {
+	v := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(r.URL.Query().Get("variables")), &v)
+	return v
+}
+
+// cursorOffset parses cursors like "cursor-20"
+func cursorOffset(v interface{}) int {
+	cursor, _ := v.(string)
+	n, _ := strconv.Atoi(cursor[strings.LastIndex(cursor, "-")+1:])
+	return n
+}
+
+// bookmarkTimeline serves a page of bookmarks. A bottom cursor is only included if more bookmarks are available.
+func (s *Server) bookmarkTimeline(w http.ResponseWriter, r *http.Request) {
+	v := readVariables(r)
+	count := 20
+	if c, ok := v["count"].(float64); ok && c > 0 {
+		count = int(c)
+	}
+	offset := cursorOffset(v["cursor"])
+
+	s.mx.Lock()
+	entries := make([]interface{}, 0)
+	end := offset + count
+	if end > len(s.bookmarks) {
+		end = len(s.bookmarks)
+	}
+	for i := offset; i < end; i++ {
+		t := s.bookmarks[i]
+		result := map[string]interface{}{}
+		if !s.deleted[t.Id] {
+			result = s.tweetResult(t)
+		}
+		entries = append(entries, map[string]interface{}{
+			"entryId":   "tweet-" + t.Id,
+			"sortIndex": t.Id,
+			"content": map[string]interface{}{
+				"entryType":  "TimelineTimelineItem",
+				"__typename": "TimelineTimelineItem",
+				"itemContent": map[string]interface{}{
+					"itemType":      "TimelineTweet",
+					"__typename":    "TimelineTweet",
+					"tweet_results": map[string]interface{}{"result": result},
+				},
+			},
+		})
+	}
+	if end < len(s.bookmarks) {
+		entries = append(entries, cursorEntry("Bottom", fmt.Sprintf("cursor-%d", end)))
+	}
+	s.mx.Unlock()
+
+	writeJson(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"bookmark_timeline_v2": map[string]interface{}{
+				"timeline": map[string]interface{}{
+					"instructions": []interface{}{
+						map[string]interface{}{"type": "TimelineAddEntries", "entries": entries},
+					},
+				},
+			},
+		},
+	})
+}
+
+// tweetDetail serves the focal tweet and its replies, paginated by PageSize using "ShowMore" cursors
+func (s *Server) tweetDetail(w http.ResponseWriter, r *http.Request) {
+	v := readVariables(r)
+	id, _ := v["focalTweetId"].(string)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	focal, ok := s.tweets[id]
+	if !ok || s.deleted[id] {
+		writeJson(w, map[string]interface{}{
+			"data":   map[string]interface{}{"threaded_conversation_with_injections_v2": map[string]interface{}{"instructions": []interface{}{}}},
+			"errors": []interface{}{map[string]interface{}{"message": DeletedTweetError, "code": 144}},
+		})
+		return
+	}
+
+	replies := make([]*Tweet, 0)
+	for _, t := range s.tweets {
+		if t.ReplyTo == id && !s.deleted[t.Id] {
+			replies = append(replies, t)
+		}
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		if len(replies[i].Id) != len(replies[j].Id) {
+			return len(replies[i].Id) < len(replies[j].Id)
+		}
+		return replies[i].Id < replies[j].Id
+	})
+
+	entries := make([]interface{}, 0)
+	offset := 0
+	if cursor, ok := v["cursor"]; ok {
+		offset = cursorOffset(cursor)
+	} else {
+		entries = append(entries, s.tweetEntry(focal))
+	}
+	end := offset + s.PageSize
+	if end > len(replies) || s.PageSize <= 0 {
+		end = len(replies)
+	}
+	for _, t := range replies[offset:end] {
+		entries = append(entries, map[string]interface{}{
+			"entryId": "conversationthread-" + t.Id,
+			"content": map[string]interface{}{
+				"entryType":  "TimelineTimelineModule",
+				"__typename": "TimelineTimelineModule",
+				"items": []interface{}{
+					map[string]interface{}{
+						"entryId": "conversationthread-" + t.Id + "-tweet-" + t.Id,
+						"item": map[string]interface{}{
+							"itemContent": map[string]interface{}{
+								"itemType":      "TimelineTweet",
+								"__typename":    "TimelineTweet",
+								"tweet_results": map[string]interface{}{"result": s.tweetResult(t)},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+	if end < len(replies) {
+		entries = append(entries, cursorEntry("ShowMore", fmt.Sprintf("replies-%d", end)))
+	}
+
+	writeJson(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"threaded_conversation_with_injections_v2": map[string]interface{}{
+				"instructions": []interface{}{
+					map[string]interface{}{"type": "TimelineAddEntries", "entries": entries},
+				},
+			},
+		},
+	})
+}
+
+func (s *Server) deleteBookmark(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Variables struct {
+			TweetId string `json:"tweet_id"`
+		} `json:"variables"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mx.Lock()
+	found := false
+	for i, t := range s.bookmarks {
+		if t.Id == body.Variables.TweetId {
+			s.bookmarks = append(s.bookmarks[:i], s.bookmarks[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found {
+		s.removed = append(s.removed, body.Variables.TweetId)
+	}
+	s.mx.Unlock()
+
+	status := ""
+	if found {
+		status = "Done"
+	}
+	writeJson(w, map[string]interface{}{
+		"data": map[string]interface{}{"tweet_bookmark_delete": status},
+	})
+}
+
+func cursorEntry(cursorType, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"entryId": "cursor-" + strings.ToLower(cursorType) + "-" + value,
+		"content": map[string]interface{}{
+			"entryType":  "TimelineTimelineCursor",
+			"__typename": "TimelineTimelineCursor",
+			"value":      value,
+			"cursorType": cursorType,
+		},
+	}
+}
+
+func (s *Server) tweetEntry(t *Tweet) map[string]interface{} {
+	return map[string]interface{}{
+		"entryId": "tweet-" + t.Id,
+		"content": map[string]interface{}{
+			"entryType":  "TimelineTimelineItem",
+			"__typename": "TimelineTimelineItem",
+			"itemContent": map[string]interface{}{
+				"itemType":      "TimelineTweet",
+				"__typename":    "TimelineTweet",
+				"tweet_results": map[string]interface{}{"result": s.tweetResult(t)},
+			},
+		},
+	}
+}
+
+// card renders the card of a tweet the way the graphql api does
+func (s *Server) card(c *Card) map[string]interface{} {
+	values := make([]interface{}, 0, len(c.Values)+2)
+	keys := make([]string, 0, len(c.Values))
+	for key := range c.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values = append(values, map[string]interface{}{
+			"key":   key,
+			"value": map[string]interface{}{"type": "STRING", "string_value": c.Values[key]},
+		})
+	}
+	if strings.HasPrefix(c.Name, "poll") {
+		values = append(values, map[string]interface{}{
+			"key":   "counts_are_final",
+			"value": map[string]interface{}{"type": "BOOLEAN", "boolean_value": c.CountsAreFinal},
+		})
+	}
+	if c.Thumbnail != nil {
+		values = append(values, map[string]interface{}{
+			"key": "thumbnail_image_large",
+			"value": map[string]interface{}{"type": "IMAGE", "image_value": map[string]interface{}{
+				"url": s.URL + "/card_img/" + c.Thumbnail.Id + "/thumbnail?format=jpg&name=800x419", "width": 800, "height": 419,
+			}},
+		})
+	}
+	return map[string]interface{}{
+		"rest_id": c.Url,
+		"legacy": map[string]interface{}{
+			"binding_values": values,
+			"name":           c.Name,
+			"url":            c.Url,
+		},
+	}
+}
+
+// tweetResult renders a tweet the way the graphql api does
+func (s *Server) tweetResult(t *Tweet) map[string]interface{} {
+	media := make([]interface{}, 0, len(t.Media))
+	for _, m := range t.Media {
+		item := map[string]interface{}{
+			"id_str":          m.Id,
+			"media_key":       "3_" + m.Id,
+			"media_url_https": s.MediaUrl(m),
+			"type":            "photo",
+			"url":             "https://t.co/" + m.Id,
+			"display_url":     "pic.twitter.com/" + m.Id,
+			"expanded_url":    "https://twitter.com/" + t.ScreenName + "/status/" + t.Id + "/photo/1",
+		}
+		if m.Type == "video" {
+			item["type"] = "video"
+			item["video_info"] = map[string]interface{}{
+				"variants": []interface{}{
+					map[string]interface{}{"bitrate": 832000, "content_type": "video/mp4", "url": s.VideoUrl(m) + "?tag=10"},
+				},
+			}
+		}
+		media = append(media, item)
+	}
+
+	text := t.Text
+	urls := make([]interface{}, 0, len(t.Urls))
+	for i, u := range t.Urls {
+		short := "https://t.co/" + t.Id + strconv.Itoa(i)
+		urls = append(urls, map[string]interface{}{
+			"url":          short,
+			"expanded_url": u,
+			"display_url":  strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://"),
+			"indices":      []int{len(text) + 1, len(text) + 1 + len(short)},
+		})
+		text += " " + short
+	}
+
+	legacy := map[string]interface{}{
+		"id_str":              t.Id,
+		"user_id_str":         t.UserId,
+		"full_text":           text,
+		"created_at":          t.CreatedAt.Format("Mon Jan 02 15:04:05 -0700 2006"),
+		"conversation_id_str": t.Id,
+		"lang":                "en",
+		"entities":            map[string]interface{}{"hashtags": []interface{}{}, "urls": urls, "user_mentions": []interface{}{}, "media": media},
+		"extended_entities":   map[string]interface{}{"media": media},
+	}
+	if t.ReplyTo != "" {
+		legacy["in_reply_to_status_id_str"] = t.ReplyTo
+		legacy["conversation_id_str"] = t.ReplyTo
+	}
+	if t.Retweeted != nil {
+		legacy["retweeted_status_result"] = map[string]interface{}{"result": s.tweetResult(t.Retweeted)}
+	}
+	if t.Quoted != nil {
+		legacy["quoted_status_id_str"] = t.Quoted.Id
+		legacy["is_quote_status"] = true
+	}
+
+	result := map[string]interface{}{
+		"__typename": "Tweet",
+		"rest_id":    t.Id,
+		"core": map[string]interface{}{
+			"user_results": map[string]interface{}{
+				"result": map[string]interface{}{
+					"__typename": "User",
+					"id":         "VXNlcjo" + t.UserId,
+					"rest_id":    t.UserId,
+					"legacy": map[string]interface{}{
+						"name":                    t.Name,
+						"screen_name":             t.ScreenName,
+						"profile_image_url_https": s.URL + "/profile/" + t.UserId + ".jpg",
+					},
+				},
+			},
+		},
+		"legacy": legacy,
+	}
+	if t.Card != nil {
+		result["card"] = s.card(t.Card)
+	}
+	if t.Quoted != nil {
+		result["quoted_status_result"] = map[string]interface{}{"result": s.tweetResult(t.Quoted)}
+	}
+	if t.Note != "" {
+		result["note_tweet"] = map[string]interface{}{
+			"is_expandable": true,
+			"note_tweet_results": map[string]interface{}{
+				"result": map[string]interface{}{
+					"id":         "Tm90ZVR3ZWV0Oj" + t.Id,
+					"text":       t.Note,
+					"entity_set": map[string]interface{}{"hashtags": []interface{}{}, "urls": []interface{}{}, "user_mentions": []interface{}{}},
+				},
+			},
+		}
+	}
+	switch t.Typename {
+	case "":
+	case "TweetWithVisibilityResults":
+		return map[string]interface{}{"__typename": t.Typename, "tweet": result}
+	default:
+		result["__typename"] = t.Typename
+	}
+	return result
+}
@@ -0,0 +1,249 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	FieldText       = "text"
+	FieldFrom       = "from"
+	FieldUrl        = "url"
+	FieldHashtag    = "hashtag"
+	FieldLang       = "lang"
+	FieldTag        = "tag"
+	FieldCollection = "collection"
+	FieldNote       = "note"
+	FieldQuote      = "quote"
+	FieldSnapshot   = "snapshot"
+)
+
+// DefaultFields are searched if a term doesn't specify a field
+var DefaultFields = []string{FieldText, FieldFrom, FieldUrl, FieldHashtag, FieldTag, FieldCollection, FieldNote, FieldQuote, FieldSnapshot}
+
+var fieldBoost = map[string]float64{
+	FieldText:       1.0,
+	FieldFrom:       2.0,
+	FieldUrl:        0.8,
+	FieldHashtag:    1.5,
+	FieldLang:       0.1,
+	FieldTag:        2.0,
+	FieldCollection: 1.5,
+	FieldNote:       1.2,
+	FieldQuote:      0.6,
+	FieldSnapshot:   0.3,
+}
+
+type Document struct {
+	Id     string
+	Fields map[string][]string
+}
+
+type Result struct {
+	Id    string
+	Score float64
+}
+
+// posting holds the positions of a term within a single document field
+type posting []int
+
+type Index struct {
+	mx       sync.RWMutex
+	ready    chan struct{}
+	once     sync.Once
+	docs     map[string]map[string][]string
+	postings map[string]map[string]map[string]posting
+}
+
+func NewIndex() *Index {
+	return &Index{
+		ready:    make(chan struct{}),
+		docs:     map[string]map[string][]string{},
+		postings: map[string]map[string]map[string]posting{},
+	}
+}
+
+// SetReady marks the index as built and releases everyone waiting for it
+func (idx *Index) SetReady() {
+	idx.once.Do(func() {
+		close(idx.ready)
+	})
+}
+
+func (idx *Index) Ready() bool {
+	select {
+	case <-idx.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the index has been built
+func (idx *Index) Wait() {
+	<-idx.ready
+}
+
+func (idx *Index) Count() int {
+	idx.mx.RLock()
+	defer idx.mx.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Add indexes a document and replaces a previously indexed version of it
+func (idx *Index) Add(doc *Document) {
+	idx.mx.Lock()
+	defer idx.mx.Unlock()
+
+	idx.remove(doc.Id)
+
+	terms := map[string][]string{}
+	for field, values := range doc.Fields {
+		position := 0
+		for _, value := range values {
+			for _, term := range Tokenize(value) {
+				fp, ok := idx.postings[field]
+				if !ok {
+					fp = map[string]map[string]posting{}
+					idx.postings[field] = fp
+				}
+				tp, ok := fp[term]
+				if !ok {
+					tp = map[string]posting{}
+					fp[term] = tp
+				}
+				tp[doc.Id] = append(tp[doc.Id], position)
+				terms[field] = append(terms[field], term)
+				position++
+			}
+			// Prevent phrases from matching across separate values
+			position++
+		}
+	}
+	idx.docs[doc.Id] = terms
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mx.Lock()
+	defer idx.mx.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	terms, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for field, fieldTerms := range terms {
+		for _, term := range fieldTerms {
+			if tp, ok := idx.postings[field][term]; ok {
+				delete(tp, id)
+				if len(tp) == 0 {
+					delete(idx.postings[field], term)
+				}
+			}
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Search evaluates a query and returns all matching documents ordered by relevance
+func (idx *Index) Search(query string) []Result {
+	node := parse(query)
+	if node == nil {
+		return []Result{}
+	}
+
+	idx.mx.RLock()
+	scores := node.eval(idx)
+	idx.mx.RUnlock()
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{Id: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].Id > results[j].Id
+		}
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// phrase returns the score of all documents containing the given terms in the given order
+func (idx *Index) phrase(field string, terms []string) map[string]float64 {
+	scores := map[string]float64{}
+	if len(terms) == 0 {
+		return scores
+	}
+	fp := idx.postings[field]
+	first, ok := fp[terms[0]]
+	if !ok {
+		return scores
+	}
+
+	for id, positions := range first {
+		tf := 0
+		for _, start := range positions {
+			match := true
+			for offset, term := range terms[1:] {
+				if containsPosition(fp[term][id], start+offset+1) == false {
+					match = false
+					break
+				}
+			}
+			if match {
+				tf++
+			}
+		}
+		if tf > 0 {
+			scores[id] = idx.score(field, tf, len(first), len(idx.docs[id][field]))
+		}
+	}
+	return scores
+}
+
+// prefix returns the score of all documents containing a term starting with the given prefix
+func (idx *Index) prefix(field, prefix string) map[string]float64 {
+	scores := map[string]float64{}
+	for term, tp := range idx.postings[field] {
+		if len(term) < len(prefix) || term[:len(prefix)] != prefix {
+			continue
+		}
+		for id, positions := range tp {
+			scores[id] += idx.score(field, len(positions), len(tp), len(idx.docs[id][field]))
+		}
+	}
+	return scores
+}
+
+// score calculates a tf-idf based relevance, normalized by the field length
+func (idx *Index) score(field string, tf, df, length int) float64 {
+	idf := math.Log(1 + float64(len(idx.docs))/float64(df))
+	boost, ok := fieldBoost[field]
+	if !ok {
+		boost = 1
+	}
+	return boost * idf * math.Sqrt(float64(tf)) / math.Sqrt(float64(length+1))
+}
+
+func (idx *Index) all() map[string]float64 {
+	scores := make(map[string]float64, len(idx.docs))
+	for id := range idx.docs {
+		scores[id] = 0
+	}
+	return scores
+}
+
+func containsPosition(positions posting, position int) bool {
+	for _, p := range positions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
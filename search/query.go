@@ -0,0 +1,336 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+var fieldAliases = map[string]string{
+	"from":       FieldFrom,
+	"user":       FieldFrom,
+	"author":     FieldFrom,
+	"url":        FieldUrl,
+	"link":       FieldUrl,
+	"hashtag":    FieldHashtag,
+	"lang":       FieldLang,
+	"text":       FieldText,
+	"tag":        FieldTag,
+	"collection": FieldCollection,
+	"note":       FieldNote,
+	"notes":      FieldNote,
+	"quote":      FieldQuote,
+	"quoted":     FieldQuote,
+	"snapshot":   FieldSnapshot,
+	"archived":   FieldSnapshot,
+}
+
+type node interface {
+	eval(idx *Index) map[string]float64
+}
+
+type termNode struct {
+	field  string
+	value  string
+	phrase bool
+}
+
+type andNode struct {
+	nodes []node
+}
+
+type orNode struct {
+	nodes []node
+}
+
+type notNode struct {
+	node node
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	term *termNode
+}
+
+// parse parses a query string into an executable node tree
+//
+// Supported query syntax:
+//
+//	foo bar             both terms have to match (implicit AND)
+//	foo OR bar          either term has to match
+//	NOT foo, -foo       the term must not match
+//	"foo bar"           phrase
+//	foo*                prefix
+//	(foo OR bar) baz    grouping
+//	from:name, url:github.com, hashtag:golang, lang:en, #golang, @name
+//	tag:todo, collection:"reading list", note:idea
+func parse(query string) node {
+	p := &parser{tokens: lex(query)}
+	return p.parseOr()
+}
+
+func lex(query string) []token {
+	tokens := make([]token, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot})
+			i++
+		case r == '"':
+			value, next := readPhrase(runes, i+1)
+			tokens = append(tokens, token{kind: tokenTerm, term: &termNode{value: value, phrase: true}})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+			switch word {
+			case "AND", "&&":
+				tokens = append(tokens, token{kind: tokenAnd})
+				continue
+			case "OR", "||":
+				tokens = append(tokens, token{kind: tokenOr})
+				continue
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot})
+				continue
+			}
+
+			term := newTermNode(word)
+			if strings.HasSuffix(word, ":") && term.field != "" && i < len(runes) && runes[i] == '"' {
+				term.value, i = readPhrase(runes, i+1)
+				term.phrase = true
+			}
+			tokens = append(tokens, token{kind: tokenTerm, term: term})
+		}
+	}
+	return tokens
+}
+
+func readPhrase(runes []rune, start int) (string, int) {
+	end := start
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+	next := end
+	if next < len(runes) {
+		next++
+	}
+	return string(runes[start:end]), next
+}
+
+func newTermNode(word string) *termNode {
+	if strings.HasPrefix(word, "#") && len(word) > 1 {
+		return &termNode{field: FieldHashtag, value: word[1:]}
+	}
+	if strings.HasPrefix(word, "@") && len(word) > 1 {
+		return &termNode{field: FieldFrom, value: word[1:]}
+	}
+	if pos := strings.Index(word, ":"); pos > 0 {
+		if field, ok := fieldAliases[strings.ToLower(word[:pos])]; ok {
+			return &termNode{field: field, value: word[pos+1:]}
+		}
+	}
+	return &termNode{value: word}
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// depth counts the open groups, closing brackets outside of any group are skipped
+	depth int
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) parseOr() node {
+	nodes := make([]node, 0)
+	for {
+		if n := p.parseAnd(); n != nil {
+			nodes = append(nodes, n)
+		}
+		t := p.peek()
+		if t == nil || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return &orNode{nodes: nodes}
+}
+
+func (p *parser) parseAnd() node {
+	nodes := make([]node, 0)
+	for {
+		t := p.peek()
+		if t == nil || t.kind == tokenOr {
+			break
+		}
+		if t.kind == tokenClose {
+			if p.depth > 0 {
+				break
+			}
+			// Skip unbalanced closing brackets, the following terms would be dropped otherwise
+			p.pos++
+			continue
+		}
+		if t.kind == tokenAnd {
+			p.pos++
+			continue
+		}
+		if n := p.parseNot(); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return &andNode{nodes: nodes}
+}
+
+func (p *parser) parseNot() node {
+	t := p.peek()
+	if t != nil && t.kind == tokenNot {
+		p.pos++
+		if n := p.parseNot(); n != nil {
+			return &notNode{node: n}
+		}
+		return nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() node {
+	t := p.peek()
+	if t == nil {
+		return nil
+	}
+	p.pos++
+	switch t.kind {
+	case tokenOpen:
+		p.depth++
+		n := p.parseOr()
+		p.depth--
+		if c := p.peek(); c != nil && c.kind == tokenClose {
+			p.pos++
+		}
+		return n
+	case tokenTerm:
+		// Terms without any word, e.g. a dash, would match nothing and empty the whole search
+		if len(Tokenize(t.term.value)) == 0 {
+			return nil
+		}
+		return t.term
+	}
+	return nil
+}
+
+func (n *termNode) eval(idx *Index) map[string]float64 {
+	fields := DefaultFields
+	if n.field != "" {
+		fields = []string{n.field}
+	}
+
+	value := strings.ToLower(n.value)
+	prefix := n.phrase == false && strings.HasSuffix(value, "*")
+	terms := Tokenize(value)
+
+	scores := map[string]float64{}
+	for _, field := range fields {
+		var matches map[string]float64
+		if prefix && len(terms) == 1 {
+			matches = idx.prefix(field, terms[0])
+		} else {
+			matches = idx.phrase(field, terms)
+		}
+		for id, score := range matches {
+			scores[id] += score
+		}
+	}
+	return scores
+}
+
+func (n *andNode) eval(idx *Index) map[string]float64 {
+	var scores map[string]float64
+	excluded := make([]map[string]float64, 0)
+	for _, child := range n.nodes {
+		if not, ok := child.(*notNode); ok {
+			excluded = append(excluded, not.node.eval(idx))
+			continue
+		}
+		matches := child.eval(idx)
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for id, score := range scores {
+			if s, ok := matches[id]; ok {
+				scores[id] = score + s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	if scores == nil {
+		scores = idx.all()
+	}
+	for _, matches := range excluded {
+		for id := range matches {
+			delete(scores, id)
+		}
+	}
+	return scores
+}
+
+func (n *orNode) eval(idx *Index) map[string]float64 {
+	scores := map[string]float64{}
+	for _, child := range n.nodes {
+		for id, score := range child.eval(idx) {
+			scores[id] += score
+		}
+	}
+	return scores
+}
+
+func (n *notNode) eval(idx *Index) map[string]float64 {
+	scores := idx.all()
+	for id := range n.node.eval(idx) {
+		delete(scores, id)
+	}
+	return scores
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+// format renders a node tree, e.g. and(or(foo bar) not(text:"baz qux"))
+func format(n node) string {
+	switch n := n.(type) {
+	case nil:
+		return ""
+	case *termNode:
+		value := n.value
+		if n.phrase {
+			value = `"` + value + `"`
+		}
+		if n.field != "" {
+			return n.field + ":" + value
+		}
+		return value
+	case *andNode:
+		return "and(" + formatAll(n.nodes) + ")"
+	case *orNode:
+		return "or(" + formatAll(n.nodes) + ")"
+	case *notNode:
+		return "not(" + format(n.node) + ")"
+	}
+	return "?"
+}
+
+func formatAll(nodes []node) string {
+	parts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		parts = append(parts, format(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"term", "foo", "foo"},
+		{"implicit and", "foo bar", "and(foo bar)"},
+		{"explicit and", "foo AND bar && baz", "and(foo bar baz)"},
+		{"or", "foo OR bar || baz", "or(foo bar baz)"},
+		{"and binds tighter than or", "foo bar OR baz", "or(and(foo bar) baz)"},
+		{"or after and", "foo OR bar baz", "or(foo and(bar baz))"},
+		{"group", "(foo OR bar) baz", "and(or(foo bar) baz)"},
+		{"nested groups", "((foo))", "foo"},
+		{"unclosed group", "(foo OR bar", "or(foo bar)"},
+		{"empty group", "() foo", "foo"},
+		{"not", "NOT foo", "not(foo)"},
+		{"minus", "-foo bar", "and(not(foo) bar)"},
+		{"double not", "NOT -foo", "not(not(foo))"},
+		{"not group", "-(foo OR bar)", "not(or(foo bar))"},
+		{"minus with space", "foo - bar", "and(foo bar)"},
+		{"terms without words", "foo & — bar", "and(foo bar)"},
+		{"phrase", `"foo bar"`, `"foo bar"`},
+		{"unclosed phrase", `"foo bar`, `"foo bar"`},
+		{"not phrase", `-"foo bar"`, `not("foo bar")`},
+		{"prefix", "foo*", "foo*"},
+		{"field", "from:jack", "from:jack"},
+		{"field alias", "user:jack author:jane", "and(from:jack from:jane)"},
+		{"field alias case", "URL:github.com", "url:github.com"},
+		{"field phrase", `collection:"reading list"`, `collection:"reading list"`},
+		{"hashtag", "#golang", "hashtag:golang"},
+		{"mention", "@jack", "from:jack"},
+		{"lone hash", "#", ""},
+		{"unknown field", "foo:bar", "foo:bar"},
+		{"notes alias", "notes:idea quoted:yes archived:go", "and(note:idea quote:yes snapshot:go)"},
+		{"stray closing bracket", "foo ) bar", "and(foo bar)"},
+		{"leading closing bracket", ") foo", "foo"},
+		{"stray closing bracket in or", "foo OR bar ) baz", "or(foo and(bar baz))"},
+		{"closing bracket after group", "(foo) ) bar", "and(foo bar)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format(parse(tt.query)); got != tt.want {
+				t.Errorf("parse(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIgnoresTermsWithoutWords(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(&Document{Id: "1", Fields: map[string][]string{FieldText: {"foo bar"}}})
+	idx.Add(&Document{Id: "2", Fields: map[string][]string{FieldText: {"foo"}}})
+	idx.SetReady()
+
+	for _, query := range []string{"foo - bar", "foo & bar", "foo — bar", "NOT - foo bar"} {
+		results := idx.Search(query)
+		if len(results) != 1 || results[0].Id != "1" {
+			t.Errorf("Search(%q) = %v, want document 1", query, results)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits a text into lower case words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//
+// SameOrigin
+// @Description: Check whether a request has been sent by a page served by this server. The Origin header, or the
+// Referer header if no origin is given, has to point to the host the request has been sent to. The host itself has
+// to be the configured host, localhost or an ip address, so pages of other domains resolving to this server are
+// rejected as well. Requests without both headers are rejected.
+// @receiver s *Server
+// @param r *http.Request
+// @return bool
+func (s *Server) SameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Host, r.Host) {
+		return false
+	}
+	return s.knownHost(r.Host)
+}
+
+// knownHost reports whether the host of a request addresses this server directly
+func (s *Server) knownHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return strings.EqualFold(host, s.Host) || strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
@@ -1,6 +1,7 @@
 package response
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 )
@@ -29,3 +30,10 @@ func NewErrorFromString(message string, status ...int) *Error {
 func NewErrorFromStatus(status int) *Error {
 	return NewErrorFromString(http.StatusText(status), status)
 }
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"error":  e.Error.Error(),
+		"status": e.Status,
+	})
+}
@@ -17,6 +17,13 @@ func NewJsonResponse(w http.ResponseWriter, r *http.Request, p httprouter.Params
 }
 
 func (jr *JsonResponse) Render() {
+	if jr.Status == http.StatusOK {
+		for _, err := range jr.Errors {
+			if err.Status > jr.Status {
+				jr.Status = err.Status
+			}
+		}
+	}
 	b, err := json.Marshal(jr.DefaultResponse)
 	if err != nil {
 		jr.AddError(NewErrorFromString("500 invalid data", http.StatusInternalServerError))
@@ -24,6 +31,8 @@ func (jr *JsonResponse) Render() {
 		return
 	}
 
+	jr.writer.Header().Set("Content-Type", "application/json")
+	jr.writer.WriteHeader(jr.Status)
 	_, _ = jr.writer.Write(b)
 }
 
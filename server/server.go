@@ -7,6 +7,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"html/template"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -65,18 +66,34 @@ func (s *Server) renderHtml(str string) template.HTML {
 	return template.HTML(str)
 }
 
-func (s *Server) setRoutes() {
-	var staticFS = fs.FS(s.assets)
-	htmlContent, err := fs.Sub(staticFS, "static/public")
+// PublicFS returns the embedded public assets such as stylesheets, scripts and fonts
+func (s *Server) PublicFS() (fs.FS, error) {
+	return fs.Sub(fs.FS(s.assets), "static/public")
+}
+
+// ParseTemplates parses a new set of all view templates. The given functions override the default template functions.
+func (s *Server) ParseTemplates(funcMap template.FuncMap) (*template.Template, error) {
+	templates, err := fs.Sub(fs.FS(s.assets), "static/template")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	templates, err := fs.Sub(staticFS, "static/template")
 
 	tmpl := template.New("")
 	tmpl.Funcs(s.funcMap)
+	if funcMap != nil {
+		tmpl.Funcs(funcMap)
+	}
 
-	tmpl, err = tmpl.ParseFS(templates, "*.tmpl")
+	return tmpl.ParseFS(templates, "*.tmpl")
+}
+
+func (s *Server) setRoutes() {
+	htmlContent, err := s.PublicFS()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tmpl, err := s.ParseTemplates(nil)
 	if err != nil {
 		log.Fatal(err)
 	} else {
@@ -100,6 +117,39 @@ func (s *Server) Start() error {
 	return nil
 }
 
+//
+// Restart
+// @Description: Restart the http server on the current address. The new address is bound before the previous server
+// is closed, so the previous server keeps running if the address is unavailable. The websocket hub and its clients
+// are kept.
+// @receiver s *Server
+// @return error
+func (s *Server) Restart() error {
+	if s.server != nil && s.server.Addr == s.Address() {
+		// The address is still bound by the running server, which has to be closed first
+		if err := s.server.Close(); err != nil {
+			return err
+		}
+		s.server = nil
+	}
+	listener, err := net.Listen("tcp", s.Address())
+	if err != nil {
+		return err
+	}
+	if s.server != nil {
+		if err := s.server.Close(); err != nil {
+			_ = listener.Close()
+			return err
+		}
+	}
+	log.Info("Server restarted on: http://%s", s.Address())
+
+	s.server = &http.Server{Addr: s.Address(), Handler: s.router}
+	go s.server.Serve(listener)
+
+	return nil
+}
+
 func (s *Server) Stop() error {
 	s.websocketHub.Close()
 	if s.server != nil {
@@ -122,14 +172,25 @@ func (s *Server) Hub() *WebsocketHub {
 }
 
 func (s *Server) websocketEndpoint(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	// The websocket accepts commands reading and deleting tweets, so pages of other origins must not connect
+	if !s.SameOrigin(r) {
+		log.Warning("Websocket connection from foreign origin \"%s\" rejected", r.Header.Get("Origin"))
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error("Failed to upgrade websocket connection: %s", err.Error())
 		return
 	}
-	client := &WebsocketClient{hub: s.websocketHub, conn: conn, send: make(chan []byte, maxMessageSize)}
-	s.websocketHub.register <- client
+	client := &WebsocketClient{hub: s.websocketHub, conn: conn, send: make(chan []byte, maxMessageSize), topics: map[string]bool{}}
+	client.Subscribe(s.websocketHub.DefaultTopics...)
+	select {
+	case s.websocketHub.register <- client:
+	case <-s.websocketHub.done:
+		_ = conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -164,12 +225,17 @@ func (s *Server) CreateViewHandler(name string, handler func(resp *response.View
 	}
 }
 
+var (
+	ImageExtensions = []string{"jpg", "jpeg", "png", "gif"}
+	VideoExtensions = []string{"mp4", "avi", "wav", "gif"}
+)
+
 func (s *Server) videoEndpoint(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.Error {
-	return s.serveMediaFile([]string{"mp4", "avi", "wav", "gif"}, w, r, ps)
+	return s.serveMediaFile(VideoExtensions, w, r, ps)
 }
 
 func (s *Server) mediaEndpoint(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *response.Error {
-	return s.serveMediaFile([]string{"jpg", "jpeg", "png", "gif"}, w, r, ps)
+	return s.serveMediaFile(ImageExtensions, w, r, ps)
 }
 
 //
@@ -2,6 +2,8 @@ package server
 
 import (
 	"github.com/gorilla/websocket"
+	"sort"
+	"sync"
 	"tbm/utils/log"
 	"time"
 )
@@ -34,6 +36,10 @@ type WebsocketClient struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Topics of published events the client receives.
+	topics map[string]bool
+	mx     sync.RWMutex
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -43,7 +49,10 @@ type WebsocketClient struct {
 // reads from this goroutine.
 func (c *WebsocketClient) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		_ = c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -62,20 +71,78 @@ func (c *WebsocketClient) readPump() {
 			}
 			break
 		}
-		c.hub.receive <- &Message{
-			Content: message,
-			Client:  c,
+		select {
+		case c.hub.receive <- &Message{Content: message, Client: c}:
+		case <-c.hub.done:
+			return
 		}
 	}
 }
 
 //
 // Send
-// @Description: Queue a given message to be sent
+// @Description: Queue a given message to be sent, unless the client got disconnected in the meantime
 // @receiver c *WebsocketClient
 // @param msg []byte
 func (c *WebsocketClient) Send(msg []byte) {
-	c.send <- msg
+	select {
+	case c.hub.direct <- &Message{Content: msg, Client: c}:
+	case <-c.hub.done:
+	}
+}
+
+//
+// Subscribe
+// @Description: Receive all events published on the given topics
+// @receiver c *WebsocketClient
+// @param topics ...string
+func (c *WebsocketClient) Subscribe(topics ...string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+}
+
+//
+// Unsubscribe
+// @Description: Stop receiving events published on the given topics
+// @receiver c *WebsocketClient
+// @param topics ...string
+func (c *WebsocketClient) Unsubscribe(topics ...string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+//
+// Subscribed
+// @Description: Check if the client is subscribed to a given topic
+// @receiver c *WebsocketClient
+// @param topic string
+// @return bool
+func (c *WebsocketClient) Subscribed(topic string) bool {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.topics[topic]
+}
+
+//
+// Topics
+// @Description: Get all subscribed topics in alphabetical order
+// @receiver c *WebsocketClient
+// @return []string
+func (c *WebsocketClient) Topics() []string {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
 }
 
 // writePump pumps messages from the hub to the websocket connection.
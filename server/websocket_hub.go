@@ -1,5 +1,7 @@
 package server
 
+import "sync"
+
 // WebsocketHub maintains the set of active clients and broadcasts messages to the
 // clients.
 type WebsocketHub struct {
@@ -10,6 +12,13 @@ type WebsocketHub struct {
 	broadcast chan []byte
 	receive   chan *Message
 
+	// Outbound messages to a single client or to all clients subscribed to a topic.
+	direct  chan *Message
+	publish chan *event
+
+	// Topics every client is subscribed to once connected.
+	DefaultTopics []string
+
 	// Register requests from the clients.
 	register chan *WebsocketClient
 
@@ -18,7 +27,9 @@ type WebsocketHub struct {
 
 	onReceive func(m *Message)
 
-	close chan bool
+	// done is closed once the hub stops, so nobody blocks on the channels above afterwards.
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 type Message struct {
@@ -26,6 +37,11 @@ type Message struct {
 	Client  *WebsocketClient
 }
 
+type event struct {
+	topic   string
+	content []byte
+}
+
 //
 // NewWebsocketHub
 // @Description: Create a new WebsocketHub instance
@@ -34,9 +50,12 @@ func NewWebsocketHub() *WebsocketHub {
 	return &WebsocketHub{
 		broadcast:  make(chan []byte),
 		receive:    make(chan *Message),
+		direct:     make(chan *Message),
+		publish:    make(chan *event),
 		register:   make(chan *WebsocketClient),
 		unregister: make(chan *WebsocketClient),
 		clients:    make(map[*WebsocketClient]bool),
+		done:       make(chan struct{}),
 		onReceive: func(m *Message) {
 
 		},
@@ -48,10 +67,9 @@ func NewWebsocketHub() *WebsocketHub {
 // @Description: Monitor all channels for incoming changes
 // @receiver h *WebsocketHub
 func (h *WebsocketHub) run() {
-	h.close = make(chan bool)
 	for {
 		select {
-		case <-h.close:
+		case <-h.done:
 			return
 		case client := <-h.register:
 			h.clients[client] = true
@@ -61,29 +79,72 @@ func (h *WebsocketHub) run() {
 				close(client.send)
 			}
 		case message := <-h.receive:
-			h.onReceive(message)
-		case message := <-h.broadcast:
+			// Commands may take a while and send messages on their own, so they must not block the hub
+			go h.onReceive(message)
+		case message := <-h.direct:
+			if _, ok := h.clients[message.Client]; ok {
+				h.send(message.Client, message.Content)
+			}
+		case e := <-h.publish:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if client.Subscribed(e.topic) {
+					h.send(client, e.content)
 				}
 			}
+		case message := <-h.broadcast:
+			for client := range h.clients {
+				h.send(client, message)
+			}
 		}
 	}
 }
 
+//
+// send
+// @Description: Queue a message for a registered client and drop the client if it can't keep up
+// @receiver h *WebsocketHub
+// @param client *WebsocketClient
+// @param message []byte
+func (h *WebsocketHub) send(client *WebsocketClient, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
 //
 // Broadcast
 // @Description: Broadcast a given message to all connected clients
 // @receiver h *WebsocketHub
 // @param message []byte
 func (h *WebsocketHub) Broadcast(message []byte) {
-	h.broadcast <- message
+	select {
+	case h.broadcast <- message:
+	case <-h.done:
+	}
+}
+
+//
+// Publish
+// @Description: Send a given message to all clients subscribed to a topic
+// @receiver h *WebsocketHub
+// @param topic string
+// @param message []byte
+func (h *WebsocketHub) Publish(topic string, message []byte) {
+	select {
+	case h.publish <- &event{topic: topic, content: message}:
+	case <-h.done:
+	}
 }
 
+//
+// Close
+// @Description: Stop the hub. Messages sent afterwards are dropped.
+// @receiver h *WebsocketHub
 func (h *WebsocketHub) Close() {
-	h.close <- true
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
 }
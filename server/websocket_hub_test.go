@@ -0,0 +1,26 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClosedHubDropsMessages(t *testing.T) {
+	h := NewWebsocketHub()
+	go h.run()
+	h.Close()
+	h.Close()
+
+	sent := make(chan bool)
+	go func() {
+		h.Publish("sync", []byte("message"))
+		h.Broadcast([]byte("message"))
+		(&WebsocketClient{hub: h}).Send([]byte("message"))
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a closed hub blocks")
+	}
+}
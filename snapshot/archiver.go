@@ -0,0 +1,251 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"tbm/utils/log"
+	"time"
+)
+
+// FetchFunc requests a web page. The response status isn't checked.
+type FetchFunc func(ctx context.Context, src string) (*http.Response, error)
+
+// Archiver fetches every queued url once and stores a snapshot of it. Pending urls aren't persisted; they are queued
+// again by scanning all tweets for links without a snapshot after a restart.
+type Archiver struct {
+	Enabled     bool          `json:"enabled"`
+	MaxSize     int64         `json:"max_size"`
+	Timeout     time.Duration `json:"-"`
+	RawTimeout  string        `json:"timeout"`
+	SkipDomains []string      `json:"skip_domains"`
+
+	Dir string `json:"-"`
+	// OnArchived is called with the ids of all tweets linking a url, once its snapshot has been stored
+	OnArchived func(s *Snapshot, tweetIds []string) `json:"-"`
+
+	fetch   FetchFunc
+	mx      sync.Mutex
+	pending []string
+	tweets  map[string][]string
+	wake    chan bool
+	close   chan bool
+	wg      sync.WaitGroup
+	running bool
+}
+
+var errUnsupportedType = errors.New("unsupported content type")
+
+func NewArchiver(fetch FetchFunc) *Archiver {
+	return &Archiver{
+		Enabled:     false,
+		MaxSize:     5 * 1024 * 1024,
+		Timeout:     30 * time.Second,
+		SkipDomains: []string{"twitter.com", "x.com", "t.co"},
+		fetch:       fetch,
+		tweets:      map[string][]string{},
+		wake:        make(chan bool, 1),
+	}
+}
+
+// Add queues a url linked by the given tweet unless it has been archived already or its domain is skipped. It
+// reports whether the url has been queued.
+func (a *Archiver) Add(tweetId, link string) bool {
+	if !a.Enabled || a.skipped(link) {
+		return false
+	}
+	if _, err := a.Get(link); err == nil {
+		return false
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if _, ok := a.tweets[link]; !ok {
+		a.pending = append(a.pending, link)
+	}
+	for _, id := range a.tweets[link] {
+		if id == tweetId {
+			return true
+		}
+	}
+	a.tweets[link] = append(a.tweets[link], tweetId)
+
+	select {
+	case a.wake <- true:
+	default:
+	}
+	return true
+}
+
+// Pending returns the number of queued urls
+func (a *Archiver) Pending() int {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return len(a.pending)
+}
+
+func (a *Archiver) skipped(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range a.SkipDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start launches the archiver, if it is enabled
+func (a *Archiver) Start() {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if a.running || !a.Enabled {
+		return
+	}
+	a.running = true
+	a.close = make(chan bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.wg.Add(1)
+	go a.work(ctx)
+	go func(closed chan bool) {
+		<-closed
+		cancel()
+	}(a.close)
+
+	log.Info("Link archiver started")
+}
+
+// Stop cancels the active request and waits for the archiver to exit
+func (a *Archiver) Stop() {
+	a.mx.Lock()
+	if !a.running {
+		a.mx.Unlock()
+		return
+	}
+	a.running = false
+	close(a.close)
+	a.mx.Unlock()
+
+	a.wg.Wait()
+}
+
+func (a *Archiver) work(ctx context.Context) {
+	defer a.wg.Done()
+
+	for {
+		link := a.next()
+		if link == "" {
+			select {
+			case <-a.wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		s := a.archive(ctx, link)
+
+		a.mx.Lock()
+		tweetIds := a.tweets[link]
+		delete(a.tweets, link)
+		a.mx.Unlock()
+
+		if ctx.Err() != nil {
+			// Interrupted by a shutdown, the url is queued again by the scan of all tweets after the next start
+			return
+		}
+
+		if s.Status == StatusDone {
+			log.Success("Link archived: %s", link)
+			if a.OnArchived != nil {
+				a.OnArchived(s, tweetIds)
+			}
+		} else {
+			log.Warning("Failed to archive link %s: %s", link, s.Error)
+		}
+	}
+}
+
+func (a *Archiver) next() string {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if len(a.pending) == 0 {
+		return ""
+	}
+	link := a.pending[0]
+	a.pending = a.pending[1:]
+	return link
+}
+
+// archive fetches a url and stores its snapshot. Failures are stored as well, unless the request got canceled.
+func (a *Archiver) archive(ctx context.Context, link string) *Snapshot {
+	s := &Snapshot{
+		Id:        Id(link),
+		Url:       link,
+		FetchedAt: time.Now(),
+	}
+	document, text, err := a.download(ctx, s)
+	if ctx.Err() != nil {
+		return s
+	}
+	if err != nil {
+		s.Status = StatusFailed
+		s.Error = err.Error()
+	} else {
+		s.Status = StatusDone
+	}
+	if err := a.save(s, document, text); err != nil {
+		log.Error("Failed to save snapshot of %s: %s", link, err.Error())
+	}
+	return s
+}
+
+func (a *Archiver) download(ctx context.Context, s *Snapshot) (string, string, error) {
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+	resp, err := a.fetch(ctx, s.Url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", "", errors.New("unexpected response \"" + resp.Status + "\"")
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", "", errUnsupportedType
+	}
+	if resp.Request != nil && resp.Request.URL.String() != s.Url {
+		s.FinalUrl = resp.Request.URL.String()
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, a.MaxSize+1))
+	if err != nil {
+		return "", "", err
+	}
+	if int64(len(body)) > a.MaxSize {
+		return "", "", errors.New("page exceeds the maximum size")
+	}
+	s.Size = int64(len(body))
+
+	title, text, err := extract(body)
+	if err != nil {
+		return "", "", err
+	}
+	s.Title = title
+	return sanitize(body, s), text, nil
+}
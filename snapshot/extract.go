@@ -0,0 +1,163 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+	"time"
+)
+
+// maxTextLength limits the extracted text of a single page
+const maxTextLength = 256 * 1024
+
+var (
+	policy = bluemonday.UGCPolicy()
+
+	// skippedElements never contain readable text
+	skippedElements = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Svg: true,
+		atom.Iframe: true, atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Form: true, atom.Button: true,
+	}
+	// blockElements are separated by line breaks within the extracted text
+	blockElements = map[atom.Atom]bool{
+		atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Section: true, atom.Article: true,
+		atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Tr: true,
+		atom.Blockquote: true, atom.Pre: true, atom.Header: true, atom.Figcaption: true, atom.Dt: true, atom.Dd: true,
+	}
+)
+
+// extract returns the title and readable text of a html document. The text is taken from the first "article" or
+// "main" element if present and from the whole body otherwise.
+func extract(document []byte) (string, string, error) {
+	root, err := html.Parse(bytes.NewReader(document))
+	if err != nil {
+		return "", "", err
+	}
+
+	title := ""
+	if n := find(root, atom.Title); n != nil {
+		title = collapse(textOf(n))
+	}
+	if title == "" {
+		title = metaContent(root, "og:title")
+	}
+
+	content := find(root, atom.Article)
+	if content == nil {
+		content = find(root, atom.Main)
+	}
+	if content == nil {
+		content = find(root, atom.Body)
+	}
+	if content == nil {
+		return title, "", nil
+	}
+
+	buf := &strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			buf.WriteString(n.Data)
+		case html.ElementNode:
+			if skippedElements[n.DataAtom] {
+				return
+			}
+			if blockElements[n.DataAtom] {
+				buf.WriteString("\n")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && blockElements[n.DataAtom] {
+			buf.WriteString("\n")
+		}
+	}
+	walk(content)
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = collapse(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	if len(text) > maxTextLength {
+		text = strings.ToValidUTF8(text[:maxTextLength], "")
+	}
+	return title, text, nil
+}
+
+// sanitize strips all scripts, styles and active content of a html document and wraps the remaining body into a
+// document referring to the archived url
+func sanitize(document []byte, s *Snapshot) string {
+	source := s.FinalUrl
+	if source == "" {
+		source = s.Url
+	}
+	buf := &strings.Builder{}
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	buf.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(s.Title)))
+	buf.WriteString(fmt.Sprintf("<base href=\"%s\">\n", html.EscapeString(source)))
+	buf.WriteString("</head>\n<body>\n")
+	buf.WriteString(fmt.Sprintf("<p><small>Archived copy of <a href=\"%s\">%s</a> from %s</small></p>\n<hr>\n",
+		html.EscapeString(source), html.EscapeString(source), s.FetchedAt.Format(time.RFC1123)))
+	buf.Write(policy.SanitizeBytes(document))
+	buf.WriteString("\n</body>\n</html>\n")
+	return buf.String()
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	buf := &strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		buf.WriteString(textOf(c))
+	}
+	return buf.String()
+}
+
+// metaContent returns the content of the first meta element with the given property or name
+func metaContent(n *html.Node, property string) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Meta {
+		matches, content := false, ""
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "property", "name":
+				matches = matches || attr.Val == property
+			case "content":
+				content = attr.Val
+			}
+		}
+		if matches {
+			return collapse(content)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if content := metaContent(c, property); content != "" {
+			return content
+		}
+	}
+	return ""
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
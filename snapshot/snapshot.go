@@ -0,0 +1,126 @@
+// Package snapshot archives the web pages linked by tweets as sanitized html documents along with their readable
+// text, so linked articles remain available and searchable once the original page is gone.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"tbm/utils/filesystem"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusDone   Status = "done"
+	StatusFailed Status = "failed"
+
+	Directory = "snapshots"
+
+	metaFilename = "snapshot.json"
+	htmlFilename = "index.html"
+	textFilename = "text.txt"
+)
+
+// Snapshot describes the archived copy of a single url. Failed snapshots are kept as well, so every url is only
+// requested once.
+type Snapshot struct {
+	Id        string    `json:"id"`
+	Url       string    `json:"url"`
+	FinalUrl  string    `json:"final_url,omitempty"`
+	Title     string    `json:"title"`
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var (
+	ErrNotFound = errors.New("snapshot not found")
+
+	idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// Id returns the identifier of the snapshot of a given url
+func Id(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ValidId reports whether the given string is a well-formed snapshot id
+func ValidId(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func (a *Archiver) dir(id string) string {
+	return path.Join(a.Dir, id[:2], id)
+}
+
+// Get returns the snapshot of a given url
+func (a *Archiver) Get(url string) (*Snapshot, error) {
+	return a.GetById(Id(url))
+}
+
+// GetById returns the snapshot with the given id
+func (a *Archiver) GetById(id string) (*Snapshot, error) {
+	if !ValidId(id) {
+		return nil, ErrNotFound
+	}
+	content, err := ioutil.ReadFile(path.Join(a.dir(id), metaFilename))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Text returns the readable text of a successfully archived url
+func (a *Archiver) Text(url string) (string, error) {
+	s, err := a.Get(url)
+	if err != nil {
+		return "", err
+	}
+	if s.Status != StatusDone {
+		return "", ErrNotFound
+	}
+	content, err := ioutil.ReadFile(path.Join(a.dir(s.Id), textFilename))
+	return string(content), err
+}
+
+// HtmlFile returns the path of the sanitized html document of a snapshot
+func (a *Archiver) HtmlFile(id string) string {
+	return path.Join(a.dir(id), htmlFilename)
+}
+
+// save writes the snapshot description and, for successful snapshots, its html document and text. The description
+// is written last, so a snapshot only exists once all its files are complete.
+func (a *Archiver) save(s *Snapshot, document, text string) error {
+	dir := a.dir(s.Id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if s.Status == StatusDone {
+		if err := filesystem.WriteFileAtomic(path.Join(dir, htmlFilename), []byte(document), 0644); err != nil {
+			return err
+		}
+		if err := filesystem.WriteFileAtomic(path.Join(dir, textFilename), []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFileAtomic(path.Join(dir, metaFilename), content, 0644)
+}
@@ -23,7 +23,98 @@ for (let i = 0; i < items.length; i++) {
     }
 }
 
+/**
+ * Simple actions such as retrying failed downloads or controlling the scraper
+ */
+document.querySelectorAll("[data-post]").forEach(link => {
+    link.addEventListener("click", e => {
+        e.preventDefault();
+        if (link.dataset.confirm && !confirm(link.dataset.confirm)) {
+            return;
+        }
+        fetch(link.dataset.post, {method: "POST"}).then(() => location.reload());
+    });
+});
+
+/**
+ * Tags & collections
+ */
+document.querySelectorAll("form[data-label-form]").forEach(form => {
+    form.addEventListener("submit", e => {
+        e.preventDefault();
+        fetch(form.getAttribute("action"), {
+            method: "POST",
+            body: new URLSearchParams(new FormData(form)),
+        }).then(() => location.reload());
+    });
+});
+document.querySelectorAll("[data-label-remove]").forEach(link => {
+    link.addEventListener("click", e => {
+        e.preventDefault();
+        fetch(link.dataset.labelRemove, {
+            method: "DELETE",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({[link.dataset.labelType]: link.dataset.labelValue}),
+        }).then(() => location.reload());
+    });
+});
+
+// The collection suggestions require a scan of all tweets, so they are only loaded once they are needed
+document.querySelectorAll("[data-collections-url]").forEach(list => {
+    const input = document.querySelector("input[list='" + list.id + "']");
+    input.addEventListener("focus", () => {
+        fetch(list.dataset.collectionsUrl).then(r => r.json()).then(r => {
+            list.replaceChildren(...(r.data.Collections || []).map(collection => new Option(collection.name)));
+        });
+    }, {once: true});
+});
+
+/**
+ * Notes & highlights
+ */
+document.querySelectorAll("[data-notes-url]").forEach(thread => {
+    const notesUrl = thread.dataset.notesUrl;
+    thread.querySelectorAll("form[data-note-form]").forEach(form => {
+        form.addEventListener("submit", e => {
+            e.preventDefault();
+            fetch(notesUrl, {
+                method: "POST",
+                body: new URLSearchParams(new FormData(form)),
+            }).then(() => location.reload());
+        });
+    });
+    thread.querySelectorAll("[data-note-remove]").forEach(link => {
+        link.addEventListener("click", e => {
+            e.preventDefault();
+            if (confirm("Delete this note?")) {
+                fetch(notesUrl + "/" + link.dataset.noteRemove, {method: "DELETE"}).then(() => location.reload());
+            }
+        });
+    });
+});
+document.addEventListener("mouseup", () => {
+    const selection = window.getSelection();
+    const text = selection.toString().trim();
+    if (text === "" || selection.anchorNode === null) {
+        return;
+    }
+    const anchor = selection.anchorNode.nodeType === Node.TEXT_NODE ? selection.anchorNode.parentElement : selection.anchorNode;
+    const content = anchor.closest(".status-content");
+    if (content === null) {
+        return;
+    }
+    const notes = content.parentElement.querySelector("[data-notes]");
+    if (notes !== null) {
+        notes.querySelector("details").open = true;
+        notes.querySelector("input[name=highlight]").value = text;
+    }
+});
+
 (function() {
+    if (location.protocol !== "http:" && location.protocol !== "https:") {
+        // Static exports are opened without a running server
+        return;
+    }
     const notificationHolder = document.getElementById("notification-holder");
     const socket = new WebSocket(`ws://${location.host}/ws`);
 
@@ -50,7 +141,70 @@ for (let i = 0; i < items.length; i++) {
         setTimeout(() => tdiv.remove(), 6000);
     }
 
-    socket.onopen = function(e) {};
+    const progressPanel = document.querySelector("[data-sync-progress]");
+    const progressStatus = {
+        completed: ["Completed", "text-green-600"],
+        canceled: ["Canceled", "text-slate-400"],
+        failed: ["Failed", "text-red-600"],
+    };
+
+    const setProgress = (row, key, text, className) => {
+        const cell = row.querySelector(`[data-progress="${key}"]`);
+        if (cell) {
+            cell.textContent = text;
+            cell.className = "pr-4 " + (className || "");
+        }
+    }
+
+    // Update the sync progress panel of the status page and append the event to its log
+    const updateProgress = (response) => {
+        const data = response.data;
+        if (data.media) {
+            Object.keys(data.media).forEach(key => {
+                const counter = document.querySelector(`[data-media="${key}"]`);
+                if (counter) {
+                    counter.textContent = data.media[key];
+                }
+            });
+        }
+
+        const progress = data.progress;
+        const row = progress ? progressPanel.querySelector(`[data-progress-account="${progress.account}"]`) : null;
+        if (row) {
+            const [status, className] = progress.running ? ["Running", "text-green-600"] : (progressStatus[progress.result] || ["-", ""]);
+            setProgress(row, "status", progress.error ? `${status} ${progress.error}` : status, className);
+            setProgress(row, "page", progress.attempt > 1 ? `${progress.page} (attempt ${progress.attempt})` : progress.page);
+            setProgress(row, "total_entries", progress.total_entries);
+            setProgress(row, "new", progress.new);
+            setProgress(row, "total_empty", progress.total_empty);
+            setProgress(row, "media_queued", progress.media_queued);
+            setProgress(row, "event", `${response.event} ${new Date(progress.time).toLocaleTimeString()}`);
+        }
+
+        const log = progressPanel.querySelector("[data-sync-log]");
+        const entry = document.createElement("li");
+        let details = "";
+        if (data.job) {
+            details = `${data.job.target} ${data.job.status}${data.job.error ? ": " + data.job.error : ""}`;
+        } else if (data.tweet_id) {
+            details = `tweet ${data.tweet_id}${data.queued ? ", " + data.queued + " files" : ""}`;
+        } else if (data.message) {
+            details = `${data.message}${data.error ? ": " + data.error : ""}`;
+        } else if (progress) {
+            details = `page ${progress.page}, ${progress.entries} entries, cursor ${progress.cursor || "-"}${progress.error ? ", " + progress.error : ""}`;
+        }
+        entry.textContent = `${new Date().toLocaleTimeString()} ${progress ? progress.account : ""} ${response.event} ${details}`;
+        log.insertBefore(entry, log.firstChild);
+        while (log.children.length > 50) {
+            log.removeChild(log.lastChild);
+        }
+    }
+
+    socket.onopen = function(e) {
+        if (progressPanel) {
+            socket.send(JSON.stringify({id: "progress", command: "subscribe", payload: {topic: "sync"}}));
+        }
+    };
 
     // Check if the websocket got closed correctly
     socket.onclose = function(event) {
@@ -68,21 +222,20 @@ for (let i = 0; i < items.length; i++) {
     socket.onmessage = function(event) {
         try {
             const response = JSON.parse(event.data);
-            const keys = Object.keys(response.data);
             const data = response.data;
 
-            if (response.errors.length > 0) {
+            if (response.errors.length > 0 || response.id) {
                 return
             }
+            if (response.topic === "sync") {
+                return progressPanel && updateProgress(response)
+            }
 
-            for (let i = 0; i < keys.length; i++) {
-                switch (keys[i]) {
-                    case "tweet":
-                        return addTweet(data.tweet)
-                    default:
-                        console.log("response key not implemented:", keys[i])
-
-                }
+            switch (response.event) {
+                case "tweet.new":
+                    return addTweet(data.tweet)
+                default:
+                    console.log("event not implemented:", response.event)
             }
         }catch (e) {
             console.log(e)
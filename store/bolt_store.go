@@ -0,0 +1,263 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go.etcd.io/bbolt"
+	"path"
+	"tbm/scraper"
+	"tbm/utils/filesystem"
+	"time"
+)
+
+const (
+	BoltFilename     = "tbm.db"
+	iterateBatchSize = 100
+)
+
+var (
+	tweetBucket  = []byte("tweets")
+	rawBucket    = []byte("raw")
+	linkedBucket = []byte("linked")
+)
+
+// BoltStore keeps all tweets inside a single embedded database file
+type BoltStore struct {
+	filename string
+	db       *bbolt.DB
+}
+
+func NewBoltStore(dir string) *BoltStore {
+	return &BoltStore{
+		filename: path.Join(dir, BoltFilename),
+	}
+}
+
+func (bs *BoltStore) Open() error {
+	filesystem.CreateDirectory(path.Dir(bs.filename))
+	db, err := bbolt.Open(bs.filename, 0644, &bbolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		if err == bbolt.ErrTimeout {
+			return errors.New("database " + bs.filename + " is locked by another process")
+		}
+		return err
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{tweetBucket, rawBucket, linkedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return err
+	}
+	bs.db = db
+	return nil
+}
+
+func (bs *BoltStore) Close() error {
+	if bs.db == nil {
+		return nil
+	}
+	err := bs.db.Close()
+	bs.db = nil
+	return err
+}
+
+func (bs *BoltStore) Get(id string) (*scraper.CachedTweet, error) {
+	ct := &scraper.CachedTweet{}
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(tweetBucket).Get([]byte(sortKey(id)))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, ct)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+func (bs *BoltStore) Put(ct *scraper.CachedTweet) error {
+	if isTweetId(ct.Tweet.IdStr) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(ct)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(tweetBucket).Put([]byte(sortKey(ct.Tweet.IdStr)), d)
+	})
+}
+
+func (bs *BoltStore) Delete(id string) error {
+	if isTweetId(id) == false {
+		return ErrInvalidId
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(rawBucket).Delete([]byte(sortKey(id))); err != nil {
+			return err
+		}
+		return tx.Bucket(tweetBucket).Delete([]byte(sortKey(id)))
+	})
+}
+
+func (bs *BoltStore) GetRaw(id string) (*scraper.RawTweet, error) {
+	raw := &scraper.RawTweet{}
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(rawBucket).Get([]byte(sortKey(id)))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (bs *BoltStore) PutRaw(raw *scraper.RawTweet) error {
+	if isTweetId(raw.Id) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(rawBucket).Put([]byte(sortKey(raw.Id)), d)
+	})
+}
+
+func (bs *BoltStore) GetLinked(id string) (*scraper.CachedTweet, error) {
+	ct := &scraper.CachedTweet{}
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(linkedBucket).Get([]byte(sortKey(id)))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, ct)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+func (bs *BoltStore) PutLinked(ct *scraper.CachedTweet) error {
+	if isTweetId(ct.Tweet.IdStr) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(ct)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(linkedBucket).Put([]byte(sortKey(ct.Tweet.IdStr)), d)
+	})
+}
+
+func (bs *BoltStore) Has(id string) bool {
+	found := false
+	_ = bs.db.View(func(tx *bbolt.Tx) error {
+		found = tx.Bucket(tweetBucket).Get([]byte(sortKey(id))) != nil
+		return nil
+	})
+	return found
+}
+
+func (bs *BoltStore) Count() int {
+	count := 0
+	_ = bs.db.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(tweetBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+func (bs *BoltStore) List(order Order, offset, limit int) ([]*scraper.CachedTweet, error) {
+	tweets := make([]*scraper.CachedTweet, 0)
+	index := 0
+	err := bs.each(order, func(v []byte) (bool, error) {
+		if index < offset {
+			index++
+			return true, nil
+		}
+		ct := &scraper.CachedTweet{}
+		if err := json.Unmarshal(v, ct); err != nil {
+			return false, err
+		}
+		tweets = append(tweets, ct)
+		return limit <= 0 || len(tweets) < limit, nil
+	})
+	return tweets, err
+}
+
+func (bs *BoltStore) Iterate(order Order, fn func(ct *scraper.CachedTweet) bool) error {
+	return bs.each(order, func(v []byte) (bool, error) {
+		ct := &scraper.CachedTweet{}
+		if err := json.Unmarshal(v, ct); err != nil {
+			return false, err
+		}
+		return fn(ct), nil
+	})
+}
+
+// each walks the bucket in batches, so fn is never called inside a read
+// transaction and may safely write to the store
+func (bs *BoltStore) each(order Order, fn func(v []byte) (bool, error)) error {
+	var last []byte
+	for {
+		values := make([][]byte, 0, iterateBatchSize)
+		err := bs.db.View(func(tx *bbolt.Tx) error {
+			c := tx.Bucket(tweetBucket).Cursor()
+			var k, v []byte
+			next := c.Next
+			if order == Descending {
+				next = c.Prev
+			}
+			switch {
+			case last == nil && order == Descending:
+				k, v = c.Last()
+			case last == nil:
+				k, v = c.First()
+			default:
+				k, v = c.Seek(last)
+				if order == Descending {
+					if k == nil {
+						k, v = c.Last()
+					} else {
+						k, v = c.Prev()
+					}
+				} else if k != nil && bytes.Equal(k, last) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(values) < iterateBatchSize; k, v = next() {
+				values = append(values, append([]byte{}, v...))
+				last = append([]byte{}, k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			if ok, err := fn(v); err != nil {
+				return err
+			} else if ok == false {
+				return nil
+			}
+		}
+		if len(values) < iterateBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"tbm/scraper"
+	"tbm/utils/filesystem"
+)
+
+const (
+	rawDirectory    = "raw"
+	linkedDirectory = "linked"
+)
+
+// JsonStore keeps one "<id>.json" file per tweet inside the data directory, its raw payloads within "raw/<id>.json"
+// and linked tweets within "linked/<id>.json"
+type JsonStore struct {
+	dir string
+	mx  sync.RWMutex
+	ids []string
+}
+
+func NewJsonStore(dir string) *JsonStore {
+	return &JsonStore{
+		dir: dir,
+		ids: make([]string, 0),
+	}
+}
+
+func (js *JsonStore) Open() error {
+	js.mx.Lock()
+	defer js.mx.Unlock()
+
+	filesystem.CreateDirectory(js.dir)
+	items, err := ioutil.ReadDir(js.dir)
+	if err != nil {
+		return err
+	}
+
+	js.ids = make([]string, 0, len(items))
+	for _, item := range items {
+		if item.IsDir() || strings.HasSuffix(item.Name(), ".json") == false {
+			continue
+		}
+		id := strings.TrimSuffix(item.Name(), ".json")
+		if isTweetId(id) {
+			js.ids = append(js.ids, id)
+		}
+	}
+	sort.Slice(js.ids, func(i, j int) bool {
+		return sortKey(js.ids[i]) < sortKey(js.ids[j])
+	})
+
+	return nil
+}
+
+func (js *JsonStore) Close() error {
+	return nil
+}
+
+func (js *JsonStore) filename(id string) string {
+	return path.Join(js.dir, id+".json")
+}
+
+func (js *JsonStore) Get(id string) (*scraper.CachedTweet, error) {
+	if isTweetId(id) == false {
+		return nil, ErrNotFound
+	}
+	dat, err := os.ReadFile(js.filename(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	ct := &scraper.CachedTweet{}
+	if err := json.Unmarshal(dat, ct); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+func (js *JsonStore) Put(ct *scraper.CachedTweet) error {
+	if isTweetId(ct.Tweet.IdStr) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(ct)
+	if err != nil {
+		return err
+	}
+	if err := filesystem.WriteFileAtomic(js.filename(ct.Tweet.IdStr), d, 0644); err != nil {
+		return err
+	}
+
+	js.mx.Lock()
+	defer js.mx.Unlock()
+
+	key := sortKey(ct.Tweet.IdStr)
+	i := sort.Search(len(js.ids), func(i int) bool {
+		return sortKey(js.ids[i]) >= key
+	})
+	if i < len(js.ids) && js.ids[i] == ct.Tweet.IdStr {
+		return nil
+	}
+	js.ids = append(js.ids, "")
+	copy(js.ids[i+1:], js.ids[i:])
+	js.ids[i] = ct.Tweet.IdStr
+
+	return nil
+}
+
+func (js *JsonStore) Delete(id string) error {
+	if isTweetId(id) == false {
+		return ErrInvalidId
+	}
+	if err := os.Remove(js.filename(id)); err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	if err := os.Remove(js.rawFilename(id)); err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+
+	js.mx.Lock()
+	defer js.mx.Unlock()
+
+	for i, _id := range js.ids {
+		if _id == id {
+			js.ids = append(js.ids[:i], js.ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (js *JsonStore) Has(id string) bool {
+	return isTweetId(id) && filesystem.Exist(js.filename(id))
+}
+
+func (js *JsonStore) Count() int {
+	js.mx.RLock()
+	defer js.mx.RUnlock()
+
+	return len(js.ids)
+}
+
+func (js *JsonStore) keys(order Order) []string {
+	js.mx.RLock()
+	defer js.mx.RUnlock()
+
+	ids := make([]string, len(js.ids))
+	if order == Descending {
+		for i, id := range js.ids {
+			ids[len(js.ids)-1-i] = id
+		}
+	} else {
+		copy(ids, js.ids)
+	}
+	return ids
+}
+
+func (js *JsonStore) List(order Order, offset, limit int) ([]*scraper.CachedTweet, error) {
+	tweets := make([]*scraper.CachedTweet, 0)
+	ids := js.keys(order)
+	if offset >= len(ids) {
+		return tweets, nil
+	}
+	ids = ids[offset:]
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	for _, id := range ids {
+		ct, err := js.Get(id)
+		if err != nil {
+			return tweets, err
+		}
+		tweets = append(tweets, ct)
+	}
+	return tweets, nil
+}
+
+func (js *JsonStore) Iterate(order Order, fn func(ct *scraper.CachedTweet) bool) error {
+	for _, id := range js.keys(order) {
+		ct, err := js.Get(id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if fn(ct) == false {
+			break
+		}
+	}
+	return nil
+}
+
+func (js *JsonStore) rawFilename(id string) string {
+	return path.Join(js.dir, rawDirectory, id+".json")
+}
+
+func (js *JsonStore) GetRaw(id string) (*scraper.RawTweet, error) {
+	if isTweetId(id) == false {
+		return nil, ErrNotFound
+	}
+	dat, err := os.ReadFile(js.rawFilename(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	raw := &scraper.RawTweet{}
+	if err := json.Unmarshal(dat, raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (js *JsonStore) PutRaw(raw *scraper.RawTweet) error {
+	if isTweetId(raw.Id) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	filesystem.CreateDirectory(path.Join(js.dir, rawDirectory))
+	return filesystem.WriteFileAtomic(js.rawFilename(raw.Id), d, 0644)
+}
+
+func (js *JsonStore) linkedFilename(id string) string {
+	return path.Join(js.dir, linkedDirectory, id+".json")
+}
+
+func (js *JsonStore) GetLinked(id string) (*scraper.CachedTweet, error) {
+	if isTweetId(id) == false {
+		return nil, ErrNotFound
+	}
+	dat, err := os.ReadFile(js.linkedFilename(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	ct := &scraper.CachedTweet{}
+	if err := json.Unmarshal(dat, ct); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+func (js *JsonStore) PutLinked(ct *scraper.CachedTweet) error {
+	if isTweetId(ct.Tweet.IdStr) == false {
+		return ErrInvalidId
+	}
+	d, err := json.Marshal(ct)
+	if err != nil {
+		return err
+	}
+	filesystem.CreateDirectory(path.Join(js.dir, linkedDirectory))
+	return filesystem.WriteFileAtomic(js.linkedFilename(ct.Tweet.IdStr), d, 0644)
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tbm/scraper"
+)
+
+type Order int
+
+const (
+	Ascending Order = iota
+	Descending
+)
+
+const (
+	JsonDriver = "json"
+	BoltDriver = "bolt"
+)
+
+var (
+	ErrNotFound  = errors.New("tweet not found")
+	ErrInvalidId = errors.New("invalid tweet id")
+)
+
+// Store persists CachedTweet records. Iteration always happens in the order of
+// the tweet ids, which equals the order in which the tweets were created.
+type Store interface {
+	Open() error
+	Close() error
+
+	Get(id string) (*scraper.CachedTweet, error)
+	Put(ct *scraper.CachedTweet) error
+	Delete(id string) error
+	Has(id string) bool
+	Count() int
+
+	List(order Order, offset, limit int) ([]*scraper.CachedTweet, error)
+	Iterate(order Order, fn func(ct *scraper.CachedTweet) bool) error
+
+	// GetRaw and PutRaw keep the raw api payloads of a tweet, which are removed together with the tweet
+	GetRaw(id string) (*scraper.RawTweet, error)
+	PutRaw(raw *scraper.RawTweet) error
+
+	// GetLinked and PutLinked keep quoted tweets and retweeted originals, which may be shared by multiple tweets and
+	// are therefore kept if a tweet gets removed
+	GetLinked(id string) (*scraper.CachedTweet, error)
+	PutLinked(ct *scraper.CachedTweet) error
+}
+
+func New(driver, dataDir string) (Store, error) {
+	switch strings.ToLower(driver) {
+	case JsonDriver, "":
+		return NewJsonStore(dataDir), nil
+	case BoltDriver:
+		return NewBoltStore(dataDir), nil
+	}
+	return nil, fmt.Errorf("unknown storage driver \"%s\"", driver)
+}
+
+// Migrate copies every tweet, its raw payloads and linked tweets from src into dst and returns the number of copied tweets
+func Migrate(src, dst Store) (int, error) {
+	count := 0
+	var err error
+	iErr := src.Iterate(Ascending, func(ct *scraper.CachedTweet) bool {
+		if err = dst.Put(ct); err != nil {
+			return false
+		}
+		var raw *scraper.RawTweet
+		if raw, err = src.GetRaw(ct.Tweet.IdStr); err == nil {
+			if err = dst.PutRaw(raw); err != nil {
+				return false
+			}
+		} else if err != ErrNotFound {
+			return false
+		}
+		for _, id := range ct.LinkedIds() {
+			var linked *scraper.CachedTweet
+			if linked, err = src.GetLinked(id); err == nil {
+				if err = dst.PutLinked(linked); err != nil {
+					return false
+				}
+			} else if err != ErrNotFound {
+				return false
+			}
+		}
+		err = nil
+		count++
+		return true
+	})
+	if iErr != nil {
+		return count, iErr
+	}
+	return count, err
+}
+
+// sortKey pads a tweet id so lexical and numerical order are identical
+func sortKey(id string) string {
+	if len(id) >= 20 {
+		return id
+	}
+	return strings.Repeat("0", 20-len(id)) + id
+}
+
+func isTweetId(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"tbm/scraper"
+	"testing"
+)
+
+func tweet(id, text string) *scraper.CachedTweet {
+	ct := &scraper.CachedTweet{}
+	ct.Tweet.IdStr = id
+	ct.Tweet.FullText = text
+	return ct
+}
+
+func openStore(t *testing.T, driver string) Store {
+	s, err := New(driver, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+func ids(tweets []*scraper.CachedTweet) []string {
+	result := make([]string, len(tweets))
+	for i, ct := range tweets {
+		result[i] = ct.Tweet.IdStr
+	}
+	return result
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStore(t *testing.T) {
+	for _, driver := range []string{JsonDriver, BoltDriver} {
+		t.Run(driver, func(t *testing.T) {
+			s := openStore(t, driver)
+
+			// ids of different length must still be sorted numerically
+			for _, id := range []string{"20", "3", "100", "1"} {
+				if err := s.Put(tweet(id, "text "+id)); err != nil {
+					t.Fatalf("Put(%s): %s", id, err)
+				}
+			}
+			ct, err := s.Get("100")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct.Tweet.FullText != "text 100" {
+				t.Errorf("Get returned text %q", ct.Tweet.FullText)
+			}
+			if _, err := s.Get("2"); err != ErrNotFound {
+				t.Errorf("Get of a missing tweet returned %v", err)
+			}
+			if s.Count() != 4 || !s.Has("3") || s.Has("2") {
+				t.Errorf("Count = %d, Has(3) = %t, Has(2) = %t", s.Count(), s.Has("3"), s.Has("2"))
+			}
+
+			tests := []struct {
+				order         Order
+				offset, limit int
+				want          []string
+			}{
+				{Ascending, 0, 0, []string{"1", "3", "20", "100"}},
+				{Descending, 0, 0, []string{"100", "20", "3", "1"}},
+				{Ascending, 1, 2, []string{"3", "20"}},
+				{Descending, 3, 2, []string{"1"}},
+				{Ascending, 4, 2, []string{}},
+			}
+			for _, tt := range tests {
+				tweets, err := s.List(tt.order, tt.offset, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(tweets); !equal(got, tt.want) {
+					t.Errorf("List(%d, %d, %d) = %v, want %v", tt.order, tt.offset, tt.limit, got, tt.want)
+				}
+			}
+
+			if err := s.PutRaw(&scraper.RawTweet{Id: "3"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.PutLinked(tweet("3", "linked")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete("3"); err != nil {
+				t.Fatal(err)
+			}
+			if s.Has("3") || s.Count() != 3 {
+				t.Error("tweet not deleted")
+			}
+			if _, err := s.GetRaw("3"); err != ErrNotFound {
+				t.Errorf("raw payload kept after delete: %v", err)
+			}
+			if _, err := s.GetLinked("3"); err != nil {
+				t.Errorf("linked tweet removed with the tweet: %v", err)
+			}
+			var iterated []string
+			if err := s.Iterate(Descending, func(ct *scraper.CachedTweet) bool {
+				iterated = append(iterated, ct.Tweet.IdStr)
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"100", "20", "1"}; !equal(iterated, want) {
+				t.Errorf("Iterate = %v, want %v", iterated, want)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsInvalidIds(t *testing.T) {
+	for _, driver := range []string{JsonDriver, BoltDriver} {
+		t.Run(driver, func(t *testing.T) {
+			s := openStore(t, driver)
+
+			for _, id := range []string{"", "../1", "1a", "-1"} {
+				if err := s.Put(tweet(id, "")); err != ErrInvalidId {
+					t.Errorf("Put(%q) returned %v", id, err)
+				}
+				if err := s.PutRaw(&scraper.RawTweet{Id: id}); err != ErrInvalidId {
+					t.Errorf("PutRaw(%q) returned %v", id, err)
+				}
+				if err := s.PutLinked(tweet(id, "")); err != ErrInvalidId {
+					t.Errorf("PutLinked(%q) returned %v", id, err)
+				}
+				if err := s.Delete(id); err != ErrInvalidId {
+					t.Errorf("Delete(%q) returned %v", id, err)
+				}
+			}
+			if s.Count() != 0 {
+				t.Errorf("%d tweets stored", s.Count())
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package filesystem
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// WriteFileAtomic writes data into a temporary file next to filename and renames it afterwards, so a crash can't
+// leave a truncated file behind
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return CopyFileAtomic(filename, bytes.NewReader(data), perm)
+}
+
+// CopyFileAtomic is like WriteFileAtomic, but reads the content from src
+func CopyFileAtomic(filename string, src io.Reader, perm os.FileMode) error {
+	// The temporary name is unique, so concurrent writers of the same file can't interfere with each other
+	f, err := ioutil.TempFile(path.Dir(filename), "."+path.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("file contains %q, want %q", b, content)
+		}
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("unexpected mode %v: %v", info.Mode(), err)
+	}
+	if items, _ := ioutil.ReadDir(dir); len(items) != 1 {
+		t.Errorf("%d files left in the directory, want 1", len(items))
+	}
+}
+
+func TestWriteFileAtomicKeepsFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteFileAtomic(path.Join(dir, "missing", "state.json"), []byte("data"), 0644); err == nil {
+		t.Error("write into a missing directory succeeded")
+	}
+	if items, _ := ioutil.ReadDir(dir); len(items) != 0 {
+		t.Errorf("%d files left in the directory, want 0", len(items))
+	}
+}
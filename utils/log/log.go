@@ -3,6 +3,7 @@ package log
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"io"
 	"os"
 )
 
@@ -16,6 +17,9 @@ const (
 
 var Mode = LogAll
 
+// Output receives all log lines, e.g. os.Stderr if stdout is used for other output
+var Output io.Writer = os.Stdout
+
 //
 // Info
 // @Description: Print an info line
@@ -96,7 +100,7 @@ func Log(c color.Attribute, kind, format string, args ...interface{}) {
 
 func Printf(c color.Attribute, space int, kind, format string, args ...interface{}) {
 	kind = color.New(c).Sprintf("%s", kind)
-	fmt.Printf(fmt.Sprintf("%%-%ds %%s\n", space), kind, fmt.Sprintf(format, args...))
+	_, _ = fmt.Fprintf(Output, fmt.Sprintf("%%-%ds %%s\n", space), kind, fmt.Sprintf(format, args...))
 }
 
 func BoolString(b bool) string {